@@ -0,0 +1,365 @@
+package bazelmake
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-wasmbind-tools/wasmbind"
+)
+
+// Artifact is an output linked from the shared objects of a project.
+type Artifact struct {
+	Config *ArtifactConfig
+	// Targets are Config.Targets and the targets of the artifact.
+	Targets []*CCLibrary
+	// Libraries are the transitive closure of Targets in the order their sources are compiled.
+	Libraries []*CCLibrary
+	// Objects are the object files linked into the artifact. Config.Sources and the sources of the artifact come first.
+	Objects []*Object
+	// Archives are the archives of Libraries in link order. They are created only in LinkArchives mode.
+	Archives []*Archive
+	// LinkOptions are the linkopts of Libraries filtered by Config.LinkOptions in link order.
+	LinkOptions []string
+
+	project     *Project
+	sources     []*Object
+	wasm        *WasmLinkConfig
+	stubs       *Object
+	postLink    *PostLinkConfig
+	wasmOptions []string
+	bind        *BindConfig
+	idl         *wasmbind.IDL
+	idlWarnings []string
+	bindOptions []string
+	// exceptionOptions link the exception models of the artifact and its libraries.
+	exceptionOptions []string
+}
+
+func (a *Artifact) init() error {
+	visited := make(map[*CCLibrary]struct{})
+	var visit func(lib *CCLibrary)
+	visit = func(lib *CCLibrary) {
+		if _, exists := visited[lib]; exists {
+			return
+		}
+		visited[lib] = struct{}{}
+		a.Libraries = append(a.Libraries, lib)
+		for _, dep := range lib.ResolvedDependencies {
+			visit(dep)
+		}
+	}
+	for _, lib := range a.Targets {
+		visit(lib)
+	}
+	for _, obj := range a.project.Objects {
+		if obj.Library == nil && obj.Artifact == nil {
+			a.Objects = append(a.Objects, obj)
+		}
+	}
+	a.Objects = append(a.Objects, a.sources...)
+	libObjects := a.project.libraryObjects()
+	for _, lib := range a.Libraries {
+		a.Objects = append(a.Objects, libObjects[lib]...)
+	}
+	for _, archive := range a.project.Archives {
+		if _, exists := visited[archive.Library]; exists {
+			a.Archives = append(a.Archives, archive)
+		}
+	}
+	a.LinkOptions = a.collectLinkOptions()
+	if !a.IsStaticLibrary() {
+		a.exceptionOptions = a.exceptionLinkerOptions()
+	}
+	a.wasm = a.wasmConfig()
+	if a.wasm != nil && !a.IsStaticLibrary() {
+		opts, err := wasmLinkerOptions(a.project.Config, a.wasm, a.Kind())
+		if err != nil {
+			return fmt.Errorf("artifact %s: %w", a.Name(), err)
+		}
+		if path := a.MapPath(); path != "" {
+			opts = append(opts, "-Wl,-Map="+path)
+		}
+		a.wasmOptions = opts
+		a.postLink = a.wasm.PostLink
+		if a.project.Config.postLink != nil {
+			a.postLink = a.project.Config.postLink
+		}
+	}
+	a.bind = a.Config.Bind
+	if a.bind == nil {
+		a.bind = a.project.Config.Bind
+	}
+	if a.IsStaticLibrary() {
+		a.bind = nil
+	}
+	if a.bind != nil && a.bind.usesIDL() {
+		idl, warnings, err := a.bindIDL(a.bind)
+		if err != nil {
+			return fmt.Errorf("artifact %s: %w", a.Name(), err)
+		}
+		a.idl = idl
+		a.idlWarnings = warnings
+		a.bindOptions = bindExports(idl, a.bind)
+	}
+	return nil
+}
+
+// wasmConfig returns the wasm config of the artifact, which falls back to the config of the project.
+func (a *Artifact) wasmConfig() *WasmLinkConfig {
+	if a.Config.Wasm != nil {
+		return a.Config.Wasm
+	}
+	return a.project.Config.Wasm
+}
+
+func (a *Artifact) imports() []*ImportConfig {
+	if a.wasm == nil {
+		return nil
+	}
+	return a.wasm.Imports
+}
+
+// Name returns the name of the artifact.
+func (a *Artifact) Name() string {
+	return a.Config.Name
+}
+
+// Kind returns the kind of the artifact. It defaults to ArtifactExecutable.
+func (a *Artifact) Kind() ArtifactKind {
+	if a.Config.Kind == "" {
+		return ArtifactExecutable
+	}
+	return a.Config.Kind
+}
+
+// IsStaticLibrary reports whether the artifact is archived instead of linked.
+func (a *Artifact) IsStaticLibrary() bool {
+	return a.Kind() == ArtifactStaticLibrary
+}
+
+// Path returns the path of the artifact.
+func (a *Artifact) Path() string {
+	output := a.Config.Output
+	if output == "" {
+		output = a.Config.Name
+	}
+	return filepath.Join(a.project.Config.OutputDirectory(), output)
+}
+
+// LinkedPath returns the path the linker writes. It differs from Path if the module is processed by the post-link steps.
+func (a *Artifact) LinkedPath() string {
+	if a.postLink == nil {
+		return a.Path()
+	}
+	return a.Path() + ".linked"
+}
+
+// PostLink returns the post-link config of the artifact or nil.
+func (a *Artifact) PostLink() *PostLinkConfig {
+	return a.postLink
+}
+
+// PostLinkArguments returns the command line processing LinkedPath into Path.
+// The export list of metadce is the exports of the wasm config and the bind config, and ExportsPath.
+func (a *Artifact) PostLinkArguments() []string {
+	args := []string{"bazel2makefile", "postlink", "-o", a.Path()}
+	args = append(args, PostLinkArguments(a.postLink)...)
+	if a.postLink.MetaDCE {
+		for _, export := range a.exportList() {
+			args = append(args, "--keep-export", export)
+		}
+		if exports := a.ExportsPath(); exports != "" {
+			args = append(args, "--exports-file", exports)
+		}
+	}
+	return append(args, a.LinkedPath())
+}
+
+// exportList returns the symbols exported by the linker options generated from the config.
+func (a *Artifact) exportList() []string {
+	var ret []string
+	for _, opt := range append(append([]string{}, a.wasmOptions...), a.bindOptions...) {
+		if export := strings.TrimPrefix(opt, "-Wl,--export="); export != opt {
+			ret = append(ret, export)
+		}
+	}
+	return ret
+}
+
+// linkedObjects returns the objects linked directly, which are not archived. The stubs follow the objects.
+func (a *Artifact) linkedObjects() []*Object {
+	if len(a.Archives) == 0 || a.IsStaticLibrary() {
+		if a.stubs == nil {
+			return a.Objects
+		}
+		return append(append([]*Object{}, a.Objects...), a.stubs)
+	}
+	var ret []*Object
+	for _, obj := range a.Objects {
+		if obj.Library == nil {
+			ret = append(ret, obj)
+		}
+	}
+	if a.stubs != nil {
+		ret = append(ret, a.stubs)
+	}
+	return ret
+}
+
+// LinkInputs returns the object files and archives linked into Path.
+func (a *Artifact) LinkInputs() []string {
+	var ret []string
+	for _, obj := range a.linkedObjects() {
+		ret = append(ret, obj.Path())
+	}
+	if a.IsStaticLibrary() {
+		return ret
+	}
+	for _, archive := range a.Archives {
+		ret = append(ret, archive.Path())
+	}
+	return ret
+}
+
+// LinkLibraries returns LinkInputs as linker arguments.
+// The archives of libraries with alwayslink are wrapped by --whole-archive so that static registrations are kept.
+func (a *Artifact) LinkLibraries() []string {
+	var ret []string
+	for _, obj := range a.linkedObjects() {
+		ret = append(ret, obj.Path())
+	}
+	if a.IsStaticLibrary() {
+		return ret
+	}
+	for _, archive := range a.Archives {
+		if archive.Library.AlwaysLink {
+			ret = append(ret, "-Wl,--whole-archive", archive.Path(), "-Wl,--no-whole-archive")
+			continue
+		}
+		ret = append(ret, archive.Path())
+	}
+	return ret
+}
+
+// LinkerOptions returns the options required by the kind, the options generated by the wasm config,
+// the exports of the functions bound from the IDL, the options of the exception models and the linker options of the artifact.
+// They follow Config.LinkerOptions.
+func (a *Artifact) LinkerOptions() []string {
+	var ret []string
+	if a.wasm != nil {
+		ret = append(ret, a.wasmOptions...)
+	} else if a.Kind() == ArtifactWasmReactor {
+		ret = append(ret, "-mexec-model=reactor")
+	}
+	ret = append(ret, a.bindOptions...)
+	ret = append(ret, a.exceptionOptions...)
+	ret = append(ret, a.Config.LinkerOptions...)
+	if exports := a.ExportsPath(); exports != "" {
+		ret = append(ret, "@"+exports)
+	}
+	return ret
+}
+
+// ExportsPath returns the path of the response file exporting the symbols matching the export patterns.
+// It is empty without export patterns.
+func (a *Artifact) ExportsPath() string {
+	if a.wasm == nil || len(a.wasm.ExportPatterns) == 0 || a.IsStaticLibrary() {
+		return ""
+	}
+	return a.Path() + ".exports"
+}
+
+// ExportsArguments returns the command line writing ExportsPath from the objects of the artifact.
+func (a *Artifact) ExportsArguments() []string {
+	args := []string{"bazel2makefile", "exports", "-o", a.ExportsPath()}
+	for _, pattern := range a.wasm.ExportPatterns {
+		args = append(args, "--pattern", pattern)
+	}
+	return append(args, a.ExportedObjects()...)
+}
+
+// ExportedObjects returns the objects searched for the symbols matching the export patterns.
+func (a *Artifact) ExportedObjects() []string {
+	ret := make([]string, 0, len(a.Objects))
+	for _, obj := range a.Objects {
+		ret = append(ret, obj.Path())
+	}
+	return ret
+}
+
+// Stubs returns the object of the C stubs of the imports or nil if no import is stubbed.
+func (a *Artifact) Stubs() *Object {
+	return a.stubs
+}
+
+// StubsArguments returns the command line writing the source of Stubs from the objects of the artifact.
+func (a *Artifact) StubsArguments() []string {
+	args := []string{"bazel2makefile", "stubs", "-o", a.stubs.Source}
+	args = append(args, ImportArguments(a.wasm.Imports)...)
+	return append(args, a.ExportedObjects()...)
+}
+
+// ExportPatterns returns the export patterns of the wasm config.
+func (a *Artifact) ExportPatterns() []string {
+	if a.wasm == nil {
+		return nil
+	}
+	return a.wasm.ExportPatterns
+}
+
+// LinkArguments returns the command line linking LinkInputs into Path.
+// In LinkArchives mode, the linker options follow the archives so that libraries like -lm resolve their symbols.
+// A static library is created by the archiver, and the artifact must be removed before running it.
+func (a *Artifact) LinkArguments() []string {
+	if a.IsStaticLibrary() {
+		return append([]string{a.project.Archiver(), "rcs", a.Path()}, a.LinkInputs()...)
+	}
+	p := a.project
+	args := []string{p.Config.Compiler}
+	args = append(args, p.Config.CompilerOptions...)
+	for _, includePath := range p.IncludePaths {
+		args = append(args, "-I"+includePath)
+	}
+	if len(a.Archives) != 0 {
+		args = append(args, "-o", a.LinkedPath())
+		args = append(args, a.LinkLibraries()...)
+		args = append(args, a.LinkOptions...)
+		args = append(args, p.Config.LinkerOptions...)
+		return append(args, a.LinkerOptions()...)
+	}
+	args = append(args, p.Config.LinkerOptions...)
+	args = append(args, a.LinkerOptions()...)
+	args = append(args, "-o", a.LinkedPath())
+	args = append(args, a.LinkLibraries()...)
+	return append(args, a.LinkOptions...)
+}
+
+// collectLinkOptions returns the linkopts of the libraries in link order followed by the linker options of their compat rules.
+// As Bazel does, the same options of different libraries are linked once at the first occurrence.
+func (a *Artifact) collectLinkOptions() []string {
+	var ret, compatOptions []string
+	seen := make(map[string]struct{})
+	seenCompat := make(map[string]struct{})
+	for _, lib := range linkOrder(a.Targets) {
+		if compat := a.project.compats[lib]; compat != nil {
+			for _, opt := range compat.linkerOptions {
+				if _, exists := seenCompat[opt]; !exists {
+					seenCompat[opt] = struct{}{}
+					compatOptions = append(compatOptions, opt)
+				}
+			}
+		}
+		opts := a.project.LibraryLinkOptions(lib)
+		if len(opts) == 0 {
+			continue
+		}
+		key := strings.Join(opts, "\x00")
+		if _, exists := seen[key]; exists {
+			continue
+		}
+		seen[key] = struct{}{}
+		ret = append(ret, opts...)
+	}
+	return append(ret, compatOptions...)
+}
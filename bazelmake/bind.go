@@ -0,0 +1,255 @@
+package bazelmake
+
+import (
+	"fmt"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/goccy/go-wasmbind-tools/cheader"
+	"github.com/goccy/go-wasmbind-tools/wasm"
+	"github.com/goccy/go-wasmbind-tools/wasmbind"
+)
+
+// BindConfig generates a Go package calling the exports of the linked module with wazero.
+type BindConfig struct {
+	// Package is the name of the Go package. It defaults to the artifact name.
+	Package string `yaml:"package"`
+	// Output is the directory of the package. It defaults to Package.
+	Output string `yaml:"output"`
+	// Malloc and Free are the exports managing the memory of string and bytes parameters.
+	Malloc string `yaml:"malloc"`
+	Free   string `yaml:"free"`
+	// Functions are the bound exports. They replace the functions of the same name in the IDL.
+	// Every exported function is bound with the types of the module if there are neither Functions nor the IDL.
+	Functions []*wasmbind.Function `yaml:"functions"`
+	// IDL is the IDL file in YAML written by the idl command, relative to the config file.
+	IDL string `yaml:"idl"`
+	// ParseHeaders derives the IDL from the hdrs of the targets of the artifact.
+	ParseHeaders bool `yaml:"parse_headers"`
+	// Headers are the binding headers parsed instead of the hdrs, relative to the config file.
+	Headers []string `yaml:"headers"`
+	// StripMacros are identifiers removed from the declarations of the headers like MYLIB_API.
+	StripMacros []string `yaml:"strip_macros"`
+}
+
+// usesIDL reports whether the functions are derived from the IDL, whose functions are exported by the linker.
+func (c *BindConfig) usesIDL() bool {
+	return c.IDL != "" || c.ParseHeaders || len(c.Headers) != 0
+}
+
+func (c *BindConfig) validate() error {
+	if c.Package != "" && !token.IsIdentifier(c.Package) {
+		return fmt.Errorf("invalid package name: %q", c.Package)
+	}
+	for _, fn := range c.Functions {
+		if fn.Name == "" {
+			return fmt.Errorf("bound functions require name")
+		}
+	}
+	if c.IDL != "" && (c.ParseHeaders || len(c.Headers) != 0) {
+		return fmt.Errorf("idl cannot be specified with headers")
+	}
+	return nil
+}
+
+// bindIDL returns the IDL of the artifact and the warnings of the declarations skipped in the headers.
+func (a *Artifact) bindIDL(bind *BindConfig) (*wasmbind.IDL, []string, error) {
+	cfg := a.project.Config
+	var (
+		idl      *wasmbind.IDL
+		warnings []string
+	)
+	if bind.IDL != "" {
+		v, err := wasmbind.ReadIDL(cfg.resolvePath(bind.IDL))
+		if err != nil {
+			return nil, nil, err
+		}
+		idl = v
+	} else {
+		var headers []string
+		for _, header := range bind.Headers {
+			headers = append(headers, cfg.resolvePath(header))
+		}
+		if len(headers) == 0 {
+			for _, lib := range a.Targets {
+				headers = append(headers, lib.DeclaredHeaderPaths(cfg.Root)...)
+			}
+		}
+		if len(headers) == 0 {
+			return nil, nil, fmt.Errorf("no headers to parse")
+		}
+		parser := cheader.NewParser(&cheader.Options{StripMacros: bind.StripMacros})
+		for _, header := range headers {
+			if err := parser.ParseFile(header); err != nil {
+				return nil, nil, err
+			}
+		}
+		idl = parser.IDL()
+		warnings = parser.Warnings()
+	}
+	replaced := make(map[string]*wasmbind.Function)
+	for _, fn := range bind.Functions {
+		replaced[fn.Name] = fn
+	}
+	ret := &wasmbind.IDL{Structs: idl.Structs, Enums: idl.Enums}
+	for _, fn := range idl.Functions {
+		if r, exists := replaced[fn.Name]; exists {
+			fn = r
+			delete(replaced, fn.Name)
+		}
+		ret.Functions = append(ret.Functions, fn)
+	}
+	for _, fn := range bind.Functions {
+		if _, exists := replaced[fn.Name]; exists {
+			ret.Functions = append(ret.Functions, fn)
+		}
+	}
+	return ret, warnings, nil
+}
+
+// bindExports returns the linker options exporting the functions of the IDL and the allocator they use.
+func bindExports(idl *wasmbind.IDL, bind *BindConfig) []string {
+	names := idl.FunctionNames()
+	if idl.UsesMemory() {
+		malloc, free := bind.Malloc, bind.Free
+		if malloc == "" {
+			malloc = "malloc"
+		}
+		if free == "" {
+			free = "free"
+		}
+		names = append(names, malloc, free)
+	}
+	ret := make([]string, 0, len(names))
+	for _, name := range names {
+		ret = append(ret, "-Wl,--export="+name)
+	}
+	return ret
+}
+
+// IDL returns the IDL of the bind config of the artifact and the warnings of the declarations skipped in the headers.
+// It returns nil if the artifact derives no IDL.
+func (a *Artifact) IDL() (*wasmbind.IDL, []string) {
+	return a.idl, a.idlWarnings
+}
+
+// bindPackageName converts the name of an artifact to a package name.
+func bindPackageName(name string) string {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		}
+	}
+	ret := b.String()
+	if ret == "" || !unicode.IsLetter(rune(ret[0])) || token.IsKeyword(ret) {
+		ret = "wasm" + ret
+	}
+	return ret
+}
+
+// WriteBindings generates the Go packages of the linked artifacts with the bind config.
+// names selects the artifacts. Every artifact with the bind config is selected if names is empty.
+// The module is copied into the package to be embedded, and host.go implements the imports with the host action.
+func WriteBindings(cfg *Config, names []string) error {
+	project, err := NewProject(cfg)
+	if err != nil {
+		return err
+	}
+	selected := make(map[string]struct{})
+	for _, name := range names {
+		selected[name] = struct{}{}
+	}
+	var found bool
+	for _, artifact := range project.Artifacts {
+		if len(selected) != 0 {
+			if _, exists := selected[artifact.Name()]; !exists {
+				continue
+			}
+			delete(selected, artifact.Name())
+		}
+		bind := artifact.bind
+		if bind == nil {
+			if len(names) != 0 {
+				return fmt.Errorf("artifact %s has no bind config", artifact.Name())
+			}
+			continue
+		}
+		found = true
+		if err := writeBinding(artifact, bind); err != nil {
+			return fmt.Errorf("artifact %s: %w", artifact.Name(), err)
+		}
+	}
+	for name := range selected {
+		return fmt.Errorf("unknown artifact: %s", name)
+	}
+	if !found {
+		return fmt.Errorf("no bindings are configured")
+	}
+	return nil
+}
+
+func writeBinding(artifact *Artifact, bind *BindConfig) error {
+	content, err := os.ReadFile(artifact.Path())
+	if err != nil {
+		return err
+	}
+	m, err := wasm.Decode(content)
+	if err != nil {
+		return fmt.Errorf("%s: %w", artifact.Path(), err)
+	}
+	pkg := bind.Package
+	if pkg == "" {
+		pkg = bindPackageName(artifact.Name())
+	}
+	output := bind.Output
+	if output == "" {
+		output = pkg
+	}
+	wasmFile := filepath.Base(artifact.Path())
+	if filepath.Ext(wasmFile) != ".wasm" {
+		wasmFile += ".wasm"
+	}
+	opts := &wasmbind.Options{
+		Package:   pkg,
+		WasmFile:  wasmFile,
+		Functions: bind.Functions,
+		Malloc:    bind.Malloc,
+		Free:      bind.Free,
+	}
+	if artifact.idl != nil {
+		for _, warning := range artifact.idlWarnings {
+			log.Printf("%s: %s", artifact.Name(), warning)
+		}
+		opts.Functions = artifact.idl.Functions
+		opts.Structs = artifact.idl.Structs
+		opts.Enums = artifact.idl.Enums
+	}
+	src, err := wasmbind.Generate(m, opts)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(output, wasmFile), content); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(output, "bind.go"), src); err != nil {
+		return err
+	}
+	hosts, err := hostFunctions(m, artifact.imports())
+	if err != nil {
+		return err
+	}
+	if len(hosts) == 0 {
+		return nil
+	}
+	hostSrc, err := wasmbind.GenerateHost(pkg, hosts)
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(output, "host.go"), hostSrc)
+}
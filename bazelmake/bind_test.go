@@ -0,0 +1,75 @@
+package bazelmake_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+	"github.com/goccy/go-wasmbind-tools/wasmbind"
+)
+
+func TestWriteBindings(t *testing.T) {
+	cfg := createWorkspace(t)
+	cfg.OutputDir = t.TempDir()
+	output := filepath.Join(t.TempDir(), "example")
+	cfg.Bind = &bazelmake.BindConfig{Output: output}
+	if err := bazelmake.WriteBindings(cfg, nil); err == nil {
+		t.Fatal("expected error of the missing module")
+	}
+	// exports add (i32, i32) -> (i32).
+	module := []byte{
+		0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+		0x01, 0x07, 0x01, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f,
+		0x03, 0x02, 0x01, 0x00,
+		0x07, 0x07, 0x01, 0x03, 'a', 'd', 'd', 0x00, 0x00,
+	}
+	if err := os.WriteFile(filepath.Join(cfg.OutputDir, "example"), module, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := bazelmake.WriteBindings(cfg, []string{"example"}); err != nil {
+		t.Fatal(err)
+	}
+	src, err := os.ReadFile(filepath.Join(output, "bind.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"package example\n",
+		"//go:embed example.wasm",
+		"func (m *Module) Add(ctx context.Context, p0 int32, p1 int32) (int32, error) {",
+	} {
+		if !strings.Contains(string(src), expected) {
+			t.Fatalf("failed to find %q in\n%s", expected, src)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(output, "example.wasm")); err != nil {
+		t.Fatal(err)
+	}
+	if err := bazelmake.WriteBindings(cfg, []string{"unknown"}); err == nil {
+		t.Fatal("expected error of the unknown artifact")
+	}
+}
+
+func TestBindHeaders(t *testing.T) {
+	cfg := createWorkspace(t)
+	header := "#pragma once\n#include <stddef.h>\nint lib_count(const char* text, size_t len);\nint lib_add(int a, int b);\nint lib_log(const char* fmt, ...);\n"
+	if err := os.WriteFile(filepath.Join(cfg.Root, "a", "lib", "lib.h"), []byte(header), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Bind = &bazelmake.BindConfig{ParseHeaders: true}
+	project := newProject(t, cfg)
+	artifact := project.Artifacts[0]
+	expected := "-Wl,--export=lib_count -Wl,--export=lib_add -Wl,--export=malloc -Wl,--export=free"
+	if got := strings.Join(artifact.LinkerOptions(), " "); got != expected {
+		t.Fatalf("unexpected linker options:\nexpected %s\ngot      %s", expected, got)
+	}
+	idl, warnings := artifact.IDL()
+	if len(idl.Functions) != 2 || idl.Functions[0].Params[0].Type != wasmbind.TypeString {
+		t.Fatalf("unexpected functions: %+v", idl.Functions)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "skipped lib_log") {
+		t.Fatalf("unexpected warnings: %v", warnings)
+	}
+}
@@ -0,0 +1,389 @@
+package bazelmake
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxManifestEntries is the number of header sets remembered for the same command and source.
+const maxManifestEntries = 16
+
+// ActionCache is a content-addressed store of action outputs on the local disk.
+//
+// The key of an action is the digest of its command line, the compiler binary and the contents of every input.
+// The headers included by a compile action are known only after it ran,
+// so the sets of headers seen for the same command and source are recorded in a manifest
+// and the key is computed for each of them on lookup.
+type ActionCache struct {
+	dir     string
+	maxSize int64
+
+	compilerDigests sync.Map
+}
+
+// NewActionCache creates a cache in dir. If maxSize is positive, Trim removes the least recently used entries beyond it.
+func NewActionCache(dir string, maxSize int64) *ActionCache {
+	return &ActionCache{dir: dir, maxSize: maxSize}
+}
+
+type manifestEntry struct {
+	Headers []string `json:"headers"`
+	Key     string   `json:"key"`
+}
+
+// Restore writes the cached outputs of action. It reports false if the action is not cached.
+func (c *ActionCache) Restore(action *Action) (bool, error) {
+	primary, err := c.primaryKey(action)
+	if err != nil {
+		return false, err
+	}
+	if action.Depfile == "" {
+		return c.restore(primary, action)
+	}
+	entries, err := c.readManifest(primary)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		key, err := c.key(primary, entry.Headers)
+		if err != nil {
+			// a header was removed or is unreadable.
+			continue
+		}
+		if key != entry.Key {
+			continue
+		}
+		found, err := c.restore(key, action)
+		if err != nil {
+			return false, err
+		}
+		if found {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Store saves the outputs of action after it succeeded.
+func (c *ActionCache) Store(action *Action) error {
+	primary, err := c.primaryKey(action)
+	if err != nil {
+		return err
+	}
+	if action.Depfile == "" {
+		return c.store(primary, action)
+	}
+	headers, err := readDepfile(action.Depfile)
+	if err != nil {
+		return err
+	}
+	key, err := c.key(primary, headers)
+	if err != nil {
+		return err
+	}
+	if err := c.store(key, action); err != nil {
+		return err
+	}
+	entries, err := c.readManifest(primary)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Key == key {
+			return nil
+		}
+	}
+	entries = append(entries, &manifestEntry{Headers: headers, Key: key})
+	if len(entries) > maxManifestEntries {
+		entries = entries[len(entries)-maxManifestEntries:]
+	}
+	content, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return writeFile(c.path("manifests", primary), content)
+}
+
+// primaryKey is the digest of the command line, the compiler binary and the declared inputs.
+func (c *ActionCache) primaryKey(action *Action) (string, error) {
+	compiler, err := c.compilerDigest(action.Arguments[0])
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "compiler\x00%s\x00", compiler)
+	for _, arg := range action.Arguments {
+		fmt.Fprintf(h, "arg\x00%s\x00", arg)
+	}
+	for _, input := range action.Inputs {
+		if err := hashFile(h, input); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *ActionCache) key(primary string, headers []string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "primary\x00%s\x00", primary)
+	for _, header := range headers {
+		if err := hashFile(h, header); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *ActionCache) compilerDigest(compiler string) (string, error) {
+	if digest, exists := c.compilerDigests.Load(compiler); exists {
+		return digest.(string), nil
+	}
+	path, err := exec.LookPath(compiler)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if err := hashFile(h, path); err != nil {
+		return "", err
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	c.compilerDigests.Store(compiler, digest)
+	return digest, nil
+}
+
+func hashFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fmt.Fprintf(w, "file\x00%s\x00", path)
+	if _, err := io.Copy(w, f); err != nil {
+		return err
+	}
+	_, err = w.Write([]byte{0})
+	return err
+}
+
+func (c *ActionCache) restore(key string, action *Action) (bool, error) {
+	cached := c.path("cas", key)
+	if _, err := os.Stat(cached); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	if action.Depfile != "" {
+		if err := copyFile(cached+".d", action.Depfile); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+	if err := copyFile(cached, action.Output); err != nil {
+		return false, err
+	}
+	// the modification time orders entries for Trim.
+	now := time.Now()
+	if err := os.Chtimes(cached, now, now); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *ActionCache) store(key string, action *Action) error {
+	cached := c.path("cas", key)
+	if action.Depfile != "" {
+		if err := copyFile(action.Depfile, cached+".d"); err != nil {
+			return err
+		}
+	}
+	return copyFile(action.Output, cached)
+}
+
+func (c *ActionCache) readManifest(primary string) ([]*manifestEntry, error) {
+	content, err := os.ReadFile(c.path("manifests", primary))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entries []*manifestEntry
+	if err := json.Unmarshal(content, &entries); err != nil {
+		// a broken manifest is overwritten by the next Store.
+		return nil, nil
+	}
+	return entries, nil
+}
+
+func (c *ActionCache) path(kind, key string) string {
+	return filepath.Join(c.dir, kind, key[:2], key)
+}
+
+// writeFile writes content to path atomically.
+func writeFile(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// copyFile copies src to dst atomically so that concurrent builds never see a partial file.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	// keep the executable bit of linked outputs.
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// Trim removes the least recently used outputs until the cache fits in maxSize.
+// It returns the number of removed outputs and their total size.
+func (c *ActionCache) Trim(maxSize int64) (int, int64, error) {
+	type entry struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var (
+		entries []*entry
+		total   int64
+	)
+	casDir := filepath.Join(c.dir, "cas")
+	if err := filepath.WalkDir(casDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".d") || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size := info.Size()
+		if depInfo, err := os.Stat(path + ".d"); err == nil {
+			size += depInfo.Size()
+		}
+		entries = append(entries, &entry{path: path, size: size, modTime: info.ModTime()})
+		total += size
+		return nil
+	}); err != nil {
+		return 0, 0, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+	var (
+		removed int
+		freed   int64
+	)
+	for _, e := range entries {
+		if total-freed <= maxSize {
+			break
+		}
+		if err := os.Remove(e.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, freed, err
+		}
+		if err := os.Remove(e.path + ".d"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, freed, err
+		}
+		removed++
+		freed += e.size
+	}
+	return removed, freed, nil
+}
+
+// TrimToLimit trims the cache to the size given to NewActionCache. It does nothing without a limit.
+func (c *ActionCache) TrimToLimit() error {
+	if c.maxSize <= 0 {
+		return nil
+	}
+	_, _, err := c.Trim(c.maxSize)
+	return err
+}
+
+// ParseSize parses a size like 512MB, 10GiB or 1024. K, M, G and T are powers of 1024.
+func ParseSize(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "B"), "I")
+	unit := int64(1)
+	if v != "" {
+		switch v[len(v)-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		case 'T':
+			unit = 1 << 40
+		}
+		if unit != 1 {
+			v = v[:len(v)-1]
+		}
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	return n * unit, nil
+}
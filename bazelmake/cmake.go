@@ -0,0 +1,97 @@
+package bazelmake
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// CMakeLists renders the project as CMake targets.
+// The compilers are chosen by the CMake toolchain, so Config.Compiler and Config.CCompiler are not written.
+type CMakeLists struct {
+	*Project
+}
+
+// ProjectName returns the name of the CMake project, which is the target of the first artifact.
+func (c *CMakeLists) ProjectName() string {
+	return cmakeArtifactTarget(c.Artifacts[0])
+}
+
+// CSources returns the C sources of the objects.
+func (c *CMakeLists) CSources() []string {
+	var ret []string
+	for _, obj := range c.Objects {
+		if obj.IsC() {
+			ret = append(ret, obj.Source)
+		}
+	}
+	return ret
+}
+
+//go:embed templates/CMakeLists.txt.tmpl
+var cmakeListsData []byte
+
+var cmakeFuncs = template.FuncMap{
+	"quote": cmakeArgument,
+	"target": func(lib *CCLibrary) string {
+		return cmakeTargetName(lib.ObjectFileName())
+	},
+	"artifact": cmakeArtifactTarget,
+	"base":     filepath.Base,
+}
+
+func cmakeArtifactTarget(artifact *Artifact) string {
+	name := filepath.Base(artifact.Path())
+	return cmakeTargetName(strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+var cmakeInvalidTargetChar = regexp.MustCompile(`[^A-Za-z0-9_.+-]`)
+
+func cmakeTargetName(name string) string {
+	return cmakeInvalidTargetChar.ReplaceAllString(name, "_")
+}
+
+// cmakeArgument quotes s if it is not usable as an unquoted argument.
+func cmakeArgument(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\"()#;$\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`).Replace(s) + `"`
+}
+
+func CreateCMakeLists(cfg *Config) ([]byte, error) {
+	project, err := NewProject(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(project.compats) != 0 {
+		return nil, fmt.Errorf("compat rules are not supported by the cmake format")
+	}
+	if cfg.usesExceptionSettings() {
+		return nil, fmt.Errorf("exceptions are not supported by the cmake format")
+	}
+	for _, artifact := range project.Artifacts {
+		if len(artifact.ExportPatterns()) != 0 {
+			return nil, fmt.Errorf("wasm.export_patterns of %s is not supported by the cmake format", artifact.Name())
+		}
+		if artifact.PostLink() != nil {
+			return nil, fmt.Errorf("wasm.post_link of %s is not supported by the cmake format", artifact.Name())
+		}
+		if artifact.Stubs() != nil {
+			return nil, fmt.Errorf("wasm.imports stubs of %s are not supported by the cmake format", artifact.Name())
+		}
+	}
+	tmpl, err := template.New("").Funcs(cmakeFuncs).Parse(string(cmakeListsData))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, &CMakeLists{Project: project}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
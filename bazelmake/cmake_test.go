@@ -0,0 +1,179 @@
+package bazelmake_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+// createDefinesWorkspace builds @a//app:app instead of @a//lib:lib.
+// It depends on @a//lib:lib and @b//defs:defs, which declares defines, local_defines and includes.
+func createDefinesWorkspace(t *testing.T) *bazelmake.Config {
+	t.Helper()
+	cfg := createWorkspace(t, map[string]string{
+		"a/app/BUILD": `
+cc_library(
+    name = "app",
+    srcs = ["app.cc"],
+    deps = [
+        "//lib",
+        "@b//defs",
+    ],
+)
+`,
+		"b/defs/BUILD": `
+cc_library(
+    name = "defs",
+    srcs = ["defs.cc"],
+    defines = ["DEFS"],
+    local_defines = ["LOCAL"],
+    includes = ["include"],
+    deps = ["//base"],
+)
+`,
+	})
+	cfg.Targets = []*bazelmake.BuildTargetLibraryConfig{{Library: "a", Path: "app", Name: "app"}}
+	return cfg
+}
+
+func TestCreateCMakeLists(t *testing.T) {
+	cfg := createCWorkspace(t)
+	cfg.Output = "example.wasm"
+	cfg.CompilerOptions = []string{"-std=c++17", `-DNAME="x y"`}
+	cmakeLists, err := bazelmake.CreateCMakeLists(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(cmakeLists)
+	for _, expected := range []string{
+		"  -std=c++17\n  \"-DNAME=\\\"x y\\\"\"\n",
+		"  PROPERTIES LANGUAGE CXX\n",
+		"target_compile_options(a_c_c PRIVATE -DC)\n",
+		"target_link_libraries(a_lib_lib PUBLIC a_lib_util b_base_base)\n",
+		"add_executable(example\n",
+		"set_target_properties(example PROPERTIES OUTPUT_NAME example.wasm PREFIX \"\" SUFFIX \"\")\n",
+		"target_link_libraries(example PRIVATE a_c_c)\n",
+	} {
+		if !strings.Contains(content, expected) {
+			t.Fatalf("failed to find %q in CMakeLists.txt:\n%s", expected, content)
+		}
+	}
+}
+
+// TestLibraryDefines checks that every backend propagates defines and includes to the dependents and keeps local_defines local.
+func TestLibraryDefines(t *testing.T) {
+	cfg := createDefinesWorkspace(t)
+	include := "-I" + filepath.Join(cfg.Root, "b", "defs", "include")
+	app := filepath.Join(cfg.Root, "a", "app", "app.cc")
+	defs := filepath.Join(cfg.Root, "b", "defs", "defs.cc")
+	t.Run("cmake", func(t *testing.T) {
+		content, err := bazelmake.CreateCMakeLists(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{
+			"target_include_directories(b_defs_defs PUBLIC ${BAZELMAKE_INCLUDE_DIRECTORIES} " + strings.TrimPrefix(include, "-I") + ")\n",
+			"target_compile_definitions(b_defs_defs PUBLIC DEFS)\n",
+			"target_compile_definitions(b_defs_defs PRIVATE LOCAL)\n",
+		} {
+			if !strings.Contains(string(content), expected) {
+				t.Fatalf("failed to find %q in CMakeLists.txt:\n%s", expected, content)
+			}
+		}
+	})
+	t.Run("makefile", func(t *testing.T) {
+		content, err := bazelmake.CreateMakefile(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{
+			"$(INCLUDES) " + include + " -DDEFS $(DEPFLAGS) -c " + app + "\n",
+			"$(INCLUDES) " + include + " -DDEFS -DLOCAL $(DEPFLAGS) -c " + defs + "\n",
+		} {
+			if !strings.Contains(string(content), expected) {
+				t.Fatalf("failed to find %q in Makefile:\n%s", expected, content)
+			}
+		}
+	})
+	t.Run("ninja", func(t *testing.T) {
+		content, err := bazelmake.CreateNinjaFile(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{
+			": cxx " + ninjaEscape(app) + "\n  dep = out/a/app/_objs/app/app.d\n  copts = " + include + " -DDEFS\n",
+			": cxx " + ninjaEscape(defs) + "\n  dep = out/b/defs/_objs/defs/defs.d\n  copts = " + include + " -DDEFS -DLOCAL\n",
+		} {
+			if !strings.Contains(string(content), expected) {
+				t.Fatalf("failed to find %q in build.ninja:\n%s", expected, content)
+			}
+		}
+	})
+	t.Run("compile commands", func(t *testing.T) {
+		content, err := bazelmake.CreateCompileCommands(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var commands []*bazelmake.CompileCommand
+		if err := json.Unmarshal(content, &commands); err != nil {
+			t.Fatal(err)
+		}
+		args := make(map[string]string)
+		for _, command := range commands {
+			args[command.File] = strings.Join(command.Arguments, " ")
+		}
+		if !strings.Contains(args[app], " "+include+" -DDEFS -c ") {
+			t.Fatalf("unexpected arguments: %s", args[app])
+		}
+		if !strings.Contains(args[defs], " "+include+" -DDEFS -DLOCAL -c ") {
+			t.Fatalf("unexpected arguments: %s", args[defs])
+		}
+		if lib := args[filepath.Join(cfg.Root, "a", "lib", "lib.cc")]; strings.Contains(lib, "DEFS") {
+			t.Fatalf("unexpected arguments: %s", lib)
+		}
+	})
+	t.Run("executor", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("fake compiler requires sh")
+		}
+		for _, src := range []string{"a/app/app.cc", "a/lib/lib.cc", "a/lib/util.cc", "b/defs/defs.cc", "b/base/base.cc", "b/base/log.cc"} {
+			if err := os.WriteFile(filepath.Join(cfg.Root, src), []byte(src), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		compiler := filepath.Join(t.TempDir(), "cc.sh")
+		if err := os.WriteFile(compiler, []byte(fakeCompiler), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		cfg := *cfg
+		cfg.Compiler = compiler
+		cfg.OutputDir = filepath.Join(t.TempDir(), "out")
+		var out, actionLog bytes.Buffer
+		executor, err := bazelmake.NewExecutor(newProject(t, &cfg), &bazelmake.ExecutorOption{
+			Jobs:      1,
+			Output:    &out,
+			ActionLog: &actionLog,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := executor.Build(context.Background()); err != nil {
+			t.Fatalf("%s: %s", err, out.String())
+		}
+		for _, expected := range []string{
+			" " + include + " -DDEFS -c " + app + " ",
+			" " + include + " -DDEFS -DLOCAL -c " + defs + " ",
+		} {
+			if !strings.Contains(actionLog.String(), expected) {
+				t.Fatalf("failed to find %q in the action log:\n%s", expected, actionLog.String())
+			}
+		}
+	})
+}
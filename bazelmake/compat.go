@@ -0,0 +1,280 @@
+package bazelmake
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CompatConfig adapts the libraries matching Label to a target like WASI without patching their BUILD files.
+// A rule either names a built-in preset or describes the changes itself.
+type CompatConfig struct {
+	// Preset expands to the curated rules of a built-in compat preset.
+	Preset string `yaml:"preset"`
+	// Label matches libraries like @com_google_absl//absl/base:base.
+	// //pkg:name matches any repository, //pkg:all every library of the package and //pkg/... the package and its subpackages.
+	Label string `yaml:"label"`
+	// Sources replace the srcs of the libraries keyed by the srcs entries. An empty replacement drops the source.
+	Sources map[string]string `yaml:"sources"`
+	// AddSources are compiled as part of the libraries.
+	AddSources []string `yaml:"add_sources"`
+	// IncludePaths are searched before the system headers, which lets shim headers replace the missing ones.
+	IncludePaths []string `yaml:"include_paths"`
+	// Defines are passed to the compilation of the libraries as -D options.
+	Defines         []string `yaml:"defines"`
+	CompilerOptions []string `yaml:"compiler_options"`
+	// LinkerOptions are linked into the artifacts depending on the libraries.
+	LinkerOptions []string `yaml:"linker_options"`
+
+	// preset is the name of the built-in preset the rule comes from, whose files are written under the output directory.
+	preset string
+}
+
+//go:embed compat
+var compatFiles embed.FS
+
+// compatPresets are the curated rules of the built-in presets. Their paths are relative to compat/<preset>.
+var compatPresets = map[string][]*CompatConfig{
+	// wasi-posix emulates the POSIX APIs wasi-libc provides only on request and hides dlfcn.h.
+	// The pthread emulation is left out in the threads mode.
+	"wasi-posix": {
+		{
+			Label:        "//...",
+			IncludePaths: []string{"include"},
+			Defines: []string{
+				"_WASI_EMULATED_SIGNAL",
+				"_WASI_EMULATED_MMAN",
+				"_WASI_EMULATED_PROCESS_CLOCKS",
+				"_WASI_EMULATED_GETPID",
+				"_WASI_EMULATED_PTHREAD",
+			},
+			LinkerOptions: []string{
+				"-lwasi-emulated-signal",
+				"-lwasi-emulated-mman",
+				"-lwasi-emulated-process-clocks",
+				"-lwasi-emulated-getpid",
+				"-lwasi-emulated-pthread",
+			},
+		},
+	},
+	// absl-wasi replaces the sources of Abseil reading /proc and installing signal handlers.
+	"absl-wasi": {
+		{
+			Label:   "//absl/base:base",
+			Sources: map[string]string{"internal/sysinfo.cc": "sysinfo.cc"},
+		},
+		{
+			Label:   "//absl/debugging:failure_signal_handler",
+			Sources: map[string]string{"failure_signal_handler.cc": "failure_signal_handler.cc"},
+		},
+		{
+			// the futex and semaphore waiters are unavailable, the condition variable one runs on the emulated pthread.
+			Label:   "//absl/synchronization/...",
+			Defines: []string{"ABSL_FORCE_WAITER_MODE=2"},
+		},
+	},
+	// protobuf-wasi keeps protobuf away from thread_local, which wasm32-wasi supports only with threads.
+	"protobuf-wasi": {
+		{
+			Label:   "//:protobuf_lite",
+			Defines: []string{"GOOGLE_PROTOBUF_NO_THREADLOCAL"},
+		},
+		{
+			Label:   "//:protobuf",
+			Defines: []string{"GOOGLE_PROTOBUF_NO_THREADLOCAL"},
+		},
+	},
+}
+
+// CompatPresets returns the names of the built-in compat presets.
+func CompatPresets() []string {
+	names := make([]string, 0, len(compatPresets))
+	for name := range compatPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *CompatConfig) validate() error {
+	if c.Preset != "" {
+		if _, exists := compatPresets[c.Preset]; !exists {
+			return fmt.Errorf("unsupported compat preset: %s", c.Preset)
+		}
+		if c.Label != "" || len(c.Sources) != 0 || len(c.AddSources) != 0 || len(c.IncludePaths) != 0 ||
+			len(c.Defines) != 0 || len(c.CompilerOptions) != 0 || len(c.LinkerOptions) != 0 {
+			return fmt.Errorf("compat preset %s cannot be specified with the other fields", c.Preset)
+		}
+		return nil
+	}
+	if c.Label == "" {
+		return fmt.Errorf("compat rules require label or preset")
+	}
+	if _, _, _, err := parseLabelPattern(c.Label); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseLabelPattern splits a label pattern like //pkg/... into the repository, the package and the name.
+// The name is ... for the recursive pattern and empty repository matches every repository.
+func parseLabelPattern(label string) (string, string, string, error) {
+	var repo string
+	if strings.HasPrefix(label, "@") {
+		idx := strings.Index(label, "//")
+		if idx < 0 {
+			return "", "", "", fmt.Errorf("unexpected label pattern: %s", label)
+		}
+		repo = label[1:idx]
+		label = label[idx:]
+	}
+	if !strings.HasPrefix(label, "//") {
+		return "", "", "", fmt.Errorf("unexpected label pattern: %s", label)
+	}
+	pkg := strings.TrimPrefix(label, "//")
+	if pkg == "..." {
+		return repo, "", "...", nil
+	}
+	if strings.HasSuffix(pkg, "/...") {
+		return repo, strings.TrimSuffix(pkg, "/..."), "...", nil
+	}
+	name := path.Base(pkg)
+	if idx := strings.Index(pkg, ":"); idx >= 0 {
+		name = pkg[idx+1:]
+		pkg = pkg[:idx]
+	}
+	if name == "" {
+		return "", "", "", fmt.Errorf("unexpected label pattern: %s", label)
+	}
+	return repo, pkg, name, nil
+}
+
+// matchLabelPattern reports whether the label pattern matches lib.
+// Patterns with the repository match only the libraries of the repository,
+// //pkg:all matches every library of the package and //pkg/... the package and its subpackages.
+func matchLabelPattern(pattern string, lib *CCLibrary) bool {
+	repo, pkg, name, err := parseLabelPattern(pattern)
+	if err != nil {
+		return false
+	}
+	if repo != "" && repo != lib.File.Library.Name {
+		return false
+	}
+	libPkg := filepath.ToSlash(lib.File.Path)
+	if name == "..." {
+		return pkg == "" || libPkg == pkg || strings.HasPrefix(libPkg, pkg+"/")
+	}
+	return libPkg == pkg && (name == "all" || name == lib.Name)
+}
+
+// compatRules returns the compat rules of the config with the presets expanded.
+// The presets do not emulate pthread in the threads mode.
+func (c *Config) compatRules() []*CompatConfig {
+	var ret []*CompatConfig
+	for _, rule := range c.Compat {
+		if rule.Preset == "" {
+			ret = append(ret, rule)
+			continue
+		}
+		for _, presetRule := range compatPresets[rule.Preset] {
+			r := *presetRule
+			r.preset = rule.Preset
+			if c.Threads != nil {
+				r.Defines = withoutPthreadEmulation(r.Defines)
+				r.LinkerOptions = withoutPthreadEmulation(r.LinkerOptions)
+			}
+			ret = append(ret, &r)
+		}
+	}
+	return ret
+}
+
+// compatPath resolves a path of the rule. Paths of presets are in the output directory, the others are relative to the config file.
+func (c *Config) compatPath(rule *CompatConfig, p string) string {
+	if rule.preset != "" {
+		return filepath.Join(c.OutputDirectory(), "_compat", rule.preset, p)
+	}
+	return c.resolvePath(p)
+}
+
+// compat is the result of the compat rules matching a library.
+type compat struct {
+	sources       map[string]string
+	addSources    []string
+	options       []string
+	linkerOptions []string
+}
+
+// compatOf returns the changes of the compat rules to lib. It returns nil if no rule matches.
+func (c *Config) compatOf(lib *CCLibrary) *compat {
+	var ret *compat
+	for _, rule := range c.compatRules() {
+		if !matchLabelPattern(rule.Label, lib) {
+			continue
+		}
+		if ret == nil {
+			ret = &compat{sources: make(map[string]string)}
+		}
+		for src, replacement := range rule.Sources {
+			if replacement != "" {
+				replacement = c.compatPath(rule, replacement)
+			}
+			ret.sources[src] = replacement
+		}
+		for _, src := range rule.AddSources {
+			ret.addSources = append(ret.addSources, c.compatPath(rule, src))
+		}
+		for _, includePath := range rule.IncludePaths {
+			ret.options = append(ret.options, "-I"+c.compatPath(rule, includePath))
+		}
+		for _, define := range rule.Defines {
+			ret.options = append(ret.options, "-D"+define)
+		}
+		ret.options = append(ret.options, rule.CompilerOptions...)
+		ret.linkerOptions = append(ret.linkerOptions, rule.LinkerOptions...)
+	}
+	return ret
+}
+
+// WriteCompatFiles writes the stubs and the shim headers of the compat presets used by the config into the output directory.
+func WriteCompatFiles(cfg *Config) error {
+	written := make(map[string]struct{})
+	for _, rule := range cfg.Compat {
+		if rule.Preset == "" {
+			continue
+		}
+		if _, exists := written[rule.Preset]; exists {
+			continue
+		}
+		written[rule.Preset] = struct{}{}
+		root := path.Join("compat", rule.Preset)
+		if _, err := fs.Stat(compatFiles, root); err != nil {
+			// the preset has no files.
+			continue
+		}
+		if err := fs.WalkDir(compatFiles, root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			content, err := compatFiles.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			dst := filepath.Join(cfg.OutputDirectory(), "_compat", rule.Preset, filepath.FromSlash(strings.TrimPrefix(p, root+"/")))
+			// unchanged files are kept so that the objects compiled from them stay up to date.
+			if current, err := os.ReadFile(dst); err == nil && bytes.Equal(current, content) {
+				return nil
+			}
+			return writeFile(dst, content)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+// absl/base/internal/sysinfo.cc for WASI, which has a single thread and no /proc.
+
+#include "absl/base/internal/sysinfo.h"
+
+namespace absl {
+ABSL_NAMESPACE_BEGIN
+namespace base_internal {
+
+int NumCPUs() { return 1; }
+
+double NominalCPUFrequency() { return 1.0; }
+
+pid_t GetTID() { return 0; }
+
+pid_t GetCachedTID() { return 0; }
+
+}  // namespace base_internal
+ABSL_NAMESPACE_END
+}  // namespace absl
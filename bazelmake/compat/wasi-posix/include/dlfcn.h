@@ -0,0 +1,54 @@
+// dlfcn.h for WASI, which cannot load code at runtime.
+// Every lookup fails so that callers fall back to their portable paths.
+#ifndef BAZELMAKE_COMPAT_DLFCN_H
+#define BAZELMAKE_COMPAT_DLFCN_H
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+#define RTLD_LAZY 0x1
+#define RTLD_NOW 0x2
+#define RTLD_LOCAL 0x0
+#define RTLD_GLOBAL 0x100
+#define RTLD_DEFAULT ((void *)0)
+
+typedef struct {
+  const char *dli_fname;
+  void *dli_fbase;
+  const char *dli_sname;
+  void *dli_saddr;
+} Dl_info;
+
+static inline int dladdr(const void *addr, Dl_info *info) {
+  (void)addr;
+  (void)info;
+  return 0;
+}
+
+static inline void *dlopen(const char *file, int mode) {
+  (void)file;
+  (void)mode;
+  return (void *)0;
+}
+
+static inline void *dlsym(void *handle, const char *name) {
+  (void)handle;
+  (void)name;
+  return (void *)0;
+}
+
+static inline int dlclose(void *handle) {
+  (void)handle;
+  return 0;
+}
+
+static inline char *dlerror(void) {
+  return (char *)"dynamic loading is not supported on WASI";
+}
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif
@@ -0,0 +1,71 @@
+package bazelmake_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+func TestCompat(t *testing.T) {
+	cfg := createWorkspace(t)
+	cfg.OutputDir = filepath.Join(t.TempDir(), "out")
+	cfg.Compat = []*bazelmake.CompatConfig{
+		{Preset: "wasi-posix"},
+		{
+			Label:      "@b//base:base",
+			Sources:    map[string]string{"base.cc": "stubs/base.cc", "cbase.c": ""},
+			AddSources: []string{"stubs/extra.c"},
+			Defines:    []string{"NO_SIGNALS"},
+		},
+		{
+			Label:         "//lib:all",
+			LinkerOptions: []string{"-lwasi-emulated-signal", "-lc++abi"},
+		},
+	}
+	project := newProject(t, cfg)
+	shims := filepath.Join(cfg.OutputDirectory(), "_compat", "wasi-posix", "include")
+	var sources []string
+	for _, obj := range project.Objects {
+		if obj.Library == nil || obj.Library.Name != "base" {
+			continue
+		}
+		sources = append(sources, strings.TrimPrefix(obj.Source, cfg.Root+"/")+"="+strings.TrimPrefix(obj.Path(), cfg.OutputDirectory()+"/"))
+		options := strings.Join(obj.Options(), " ")
+		if !strings.Contains(options, "-I"+shims+" -D_WASI_EMULATED_SIGNAL") || !strings.HasSuffix(options, "-DNO_SIGNALS") {
+			t.Fatalf("unexpected options of %s: %s", obj.Source, options)
+		}
+	}
+	expected := "stubs/base.cc=b/base/_objs/base/base.o stubs/extra.c=b/base/_objs/base/_compat/extra.o"
+	if got := strings.Join(sources, " "); got != expected {
+		t.Fatalf("unexpected sources:\nexpected %s\ngot      %s", expected, got)
+	}
+	expected = "-lwasi-emulated-signal -lwasi-emulated-mman " +
+		"-lwasi-emulated-process-clocks -lwasi-emulated-getpid -lwasi-emulated-pthread -lc++abi"
+	if got := strings.Join(project.Artifacts[0].LinkOptions, " "); got != expected {
+		t.Fatalf("unexpected linkopts:\nexpected %s\ngot      %s", expected, got)
+	}
+	if err := bazelmake.WriteCompatFiles(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(shims, "dlfcn.h")); err != nil {
+		t.Fatal(err)
+	}
+	t.Run("invalid", func(t *testing.T) {
+		for _, content := range []string{
+			"compat:\n  - preset: unknown\n",
+			"compat:\n  - preset: absl-wasi\n    label: //absl/...\n",
+			"compat:\n  - label: absl/base\n",
+		} {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := bazelmake.LoadConfig(path); err == nil {
+				t.Fatalf("expected error: %s", content)
+			}
+		}
+	})
+}
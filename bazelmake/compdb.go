@@ -0,0 +1,43 @@
+package bazelmake
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// CompileCommand is an entry of the JSON compilation database ( compile_commands.json ).
+type CompileCommand struct {
+	Directory string   `json:"directory"`
+	Arguments []string `json:"arguments"`
+	File      string   `json:"file"`
+	Output    string   `json:"output"`
+}
+
+func NewCompileCommands(project *Project) ([]*CompileCommand, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*CompileCommand, 0, len(project.Objects))
+	for _, obj := range project.Objects {
+		ret = append(ret, &CompileCommand{
+			Directory: dir,
+			Arguments: project.CompileArguments(obj),
+			File:      obj.Source,
+			Output:    obj.Path(),
+		})
+	}
+	return ret, nil
+}
+
+func CreateCompileCommands(cfg *Config) ([]byte, error) {
+	project, err := NewProject(cfg)
+	if err != nil {
+		return nil, err
+	}
+	commands, err := NewCompileCommands(project)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(commands, "", "  ")
+}
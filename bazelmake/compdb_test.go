@@ -0,0 +1,69 @@
+package bazelmake_test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+func TestCreateCompileCommands(t *testing.T) {
+	cfg := createCWorkspace(t)
+	cfg.CompilerOptions = []string{"-std=c++17"}
+	content, err := bazelmake.CreateCompileCommands(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commands []*bazelmake.CompileCommand
+	if err := json.Unmarshal(content, &commands); err != nil {
+		t.Fatal(err)
+	}
+	if len(commands) != 5 {
+		t.Fatalf("unexpected number of commands: %d", len(commands))
+	}
+	for _, command := range commands {
+		if filepath.Base(command.File) != "c.c" {
+			continue
+		}
+		args := strings.Join(command.Arguments, " ")
+		expected := "clang++ -std=c++17 -I" + filepath.Dir(cfg.Root)
+		if !strings.HasPrefix(args, expected) {
+			t.Fatalf("unexpected arguments: %s", args)
+		}
+		if !strings.HasSuffix(args, "-DC -c "+command.File+" -o "+command.Output) {
+			t.Fatalf("unexpected arguments: %s", args)
+		}
+		return
+	}
+	t.Fatal("failed to find c.c")
+}
+
+func TestCompileCommandsIncludes(t *testing.T) {
+	cfg := createDefinesWorkspace(t)
+	commands, err := bazelmake.NewCompileCommands(newProject(t, cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	include := "-I" + filepath.Join(cfg.Root, "b", "defs", "include")
+	var found int
+	for _, command := range commands {
+		args := strings.Join(command.Arguments, " ")
+		switch filepath.Base(command.File) {
+		case "app.cc", "defs.cc":
+			// the includes of @b//defs:defs apply to the library and its dependents.
+			if !strings.Contains(args, " "+include+" ") {
+				t.Fatalf("failed to find %s in %s", include, args)
+			}
+			found++
+		case "base.cc":
+			if strings.Contains(args, include) {
+				t.Fatalf("unexpected include path of the dependent: %s", args)
+			}
+		}
+	}
+	if found != 2 {
+		t.Fatalf("unexpected number of commands with the include path: %d", found)
+	}
+}
@@ -1,22 +1,224 @@
 package bazelmake
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/goccy/go-yaml"
 )
 
 type Config struct {
-	Root            string                      `yaml:"root"`
-	Targets         []*BuildTargetLibraryConfig `yaml:"targets"`
-	Ignores         []*IgnoreConfig             `yaml:"ignores"`
-	Libraries       []*LibraryConfig            `yaml:"libraries"`
-	Output          string                      `yaml:"output"`
-	Compiler        string                      `yaml:"compiler"`
-	IncludePaths    []string                    `yaml:"include_paths"`
-	Sources         []string                    `yaml:"sources"`
-	CompilerOptions []string                    `yaml:"compiler_options"`
-	LinkerOptions   []string                    `yaml:"linker_options"`
+	Root             string                      `yaml:"root"`
+	Targets          []*BuildTargetLibraryConfig `yaml:"targets"`
+	Ignores          []*IgnoreConfig             `yaml:"ignores"`
+	Libraries        []*LibraryConfig            `yaml:"libraries"`
+	Output           string                      `yaml:"output"`
+	OutputDir        string                      `yaml:"output_dir"`
+	Compiler         string                      `yaml:"compiler"`
+	CCompiler        string                      `yaml:"c_compiler"`
+	IncludePaths     []string                    `yaml:"include_paths"`
+	Sources          []string                    `yaml:"sources"`
+	CompilerOptions  []string                    `yaml:"compiler_options"`
+	CCompilerOptions []string                    `yaml:"c_compiler_options"`
+	LinkerOptions    []string                    `yaml:"linker_options"`
+	LinkOptions      *LinkOptionsConfig          `yaml:"linkopts"`
+	LinkMode         LinkMode                    `yaml:"link_mode"`
+	Archiver         string                      `yaml:"archiver"`
+	Toolchain        *ToolchainConfig            `yaml:"toolchain"`
+	// Wasm generates the wasm-ld options of the artifacts without their own.
+	Wasm *WasmLinkConfig `yaml:"wasm"`
+	// Bind generates the Go bindings of the artifacts without their own.
+	Bind      *BindConfig       `yaml:"bind"`
+	Templates []*TemplateConfig `yaml:"templates"`
+	Artifacts []*ArtifactConfig `yaml:"artifacts"`
+	// Conditions are the select() conditions taken as true, like "@platforms//cpu:wasm32".
+	// select() resolves to nothing unless Conditions are configured.
+	Conditions []string `yaml:"conditions"`
+	// Compat adapts the sources and the options of the matching libraries to the target.
+	Compat []*CompatConfig `yaml:"compat"`
+	// Exceptions choose the exception model and RTTI of the libraries and check that the linked ones agree.
+	Exceptions []*ExceptionConfig `yaml:"exceptions"`
+	// Threads builds with threads and checks that every library of the closure supports them.
+	Threads  *ThreadsConfig            `yaml:"threads"`
+	Profiles map[string]*ProfileConfig `yaml:"profiles"`
+
+	path     string
+	profile  string
+	postLink *PostLinkConfig
+}
+
+// ProfileConfig changes Config for a build variant like debug or release.
+// The options are appended to the options of Config unless Override is true.
+type ProfileConfig struct {
+	Override         bool     `yaml:"override"`
+	CompilerOptions  []string `yaml:"compiler_options"`
+	CCompilerOptions []string `yaml:"c_compiler_options"`
+	LinkerOptions    []string `yaml:"linker_options"`
+	// Defines are passed to every compilation as -D options.
+	Defines []string `yaml:"defines"`
+	// Conditions are added to Config.Conditions.
+	Conditions []string `yaml:"conditions"`
+	// OutputDir defaults to the directory named after the profile in Config.OutputDirectory.
+	OutputDir string `yaml:"output_dir"`
+	// Toolchain replaces Config.Toolchain.
+	Toolchain *ToolchainConfig `yaml:"toolchain"`
+	// PostLink replaces the post_link of the wasm configs like stripping only release builds.
+	PostLink *PostLinkConfig `yaml:"post_link"`
+	// Compat is added to Config.Compat like the WASI presets of a wasm profile.
+	Compat []*CompatConfig `yaml:"compat"`
+	// Threads replaces Config.Threads, which makes a threads variant of the build.
+	Threads *ThreadsConfig `yaml:"threads"`
+}
+
+// WithProfile returns a copy of the config changed by the profile of name.
+func (c *Config) WithProfile(name string) (*Config, error) {
+	profile, exists := c.Profiles[name]
+	if !exists {
+		return nil, fmt.Errorf("failed to find profile: %s", name)
+	}
+	if profile == nil {
+		return nil, fmt.Errorf("profile %s is empty", name)
+	}
+	ret := *c
+	ret.profile = name
+	merge := func(base, opts []string) []string {
+		if profile.Override {
+			return append([]string{}, opts...)
+		}
+		return append(append([]string{}, base...), opts...)
+	}
+	ret.CompilerOptions = merge(c.CompilerOptions, profile.CompilerOptions)
+	ret.CCompilerOptions = merge(c.CCompilerOptions, profile.CCompilerOptions)
+	ret.LinkerOptions = merge(c.LinkerOptions, profile.LinkerOptions)
+	for _, define := range profile.Defines {
+		ret.CompilerOptions = append(ret.CompilerOptions, "-D"+define)
+		ret.CCompilerOptions = append(ret.CCompilerOptions, "-D"+define)
+	}
+	ret.Conditions = append(append([]string{}, c.Conditions...), profile.Conditions...)
+	ret.Compat = append(append([]*CompatConfig{}, c.Compat...), profile.Compat...)
+	if profile.Toolchain != nil {
+		ret.Toolchain = profile.Toolchain
+	}
+	ret.postLink = profile.PostLink
+	if profile.Threads != nil {
+		ret.Threads = profile.Threads
+	}
+	ret.OutputDir = profile.OutputDir
+	if ret.OutputDir == "" {
+		ret.OutputDir = filepath.Join(c.OutputDirectory(), name)
+	}
+	return &ret, nil
+}
+
+// Profile returns the name of the profile applied by WithProfile.
+func (c *Config) Profile() string {
+	return c.profile
+}
+
+// Path returns the path of the loaded config file.
+func (c *Config) Path() string {
+	return c.path
+}
+
+// resolvePath resolves path relative to the directory of the config file.
+func (c *Config) resolvePath(path string) string {
+	if c.path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(c.path), path)
+}
+
+// OutputDirectory returns the directory of the objects, the archives and the linked artifact. It defaults to out.
+func (c *Config) OutputDirectory() string {
+	if c.OutputDir == "" {
+		return "out"
+	}
+	return filepath.Clean(c.OutputDir)
+}
+
+// LinkMode decides how the objects of the resolved libraries are linked.
+type LinkMode string
+
+const (
+	// LinkObjects links every object file directly. It is the default.
+	LinkObjects LinkMode = "objects"
+	// LinkArchives archives the objects of each library and links the archives in dependency order.
+	// The archives of libraries with alwayslink are linked as a whole.
+	LinkArchives LinkMode = "archives"
+)
+
+// LinkOptionsConfig filters the linkopts collected from the libraries by regular expressions.
+// If Allow is not empty, only the options matching one of Allow are linked. The options matching one of Deny are not linked.
+type LinkOptionsConfig struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// ArtifactKind decides what an artifact is linked into.
+type ArtifactKind string
+
+const (
+	// ArtifactExecutable is a program with an entry point. It is the default.
+	ArtifactExecutable ArtifactKind = "executable"
+	// ArtifactWasmReactor is a WebAssembly module without an entry point whose exports are called by the host.
+	ArtifactWasmReactor ArtifactKind = "wasm_reactor"
+	// ArtifactStaticLibrary archives every object of the artifact into one static library.
+	ArtifactStaticLibrary ArtifactKind = "static_library"
+)
+
+// ArtifactConfig is an output built from the shared resolved graph.
+// Config.Targets and Config.Sources are part of every artifact.
+type ArtifactConfig struct {
+	Name string `yaml:"name"`
+	// Output is the file name in the output directory. It defaults to Name.
+	Output  string                      `yaml:"output"`
+	Kind    ArtifactKind                `yaml:"kind"`
+	Targets []*BuildTargetLibraryConfig `yaml:"targets"`
+	Sources []string                    `yaml:"sources"`
+	// CompilerOptions are added to the command lines compiling Sources.
+	CompilerOptions []string `yaml:"compiler_options"`
+	// LinkerOptions are added to the command line linking the artifact.
+	LinkerOptions []string `yaml:"linker_options"`
+	// Wasm replaces Config.Wasm.
+	Wasm *WasmLinkConfig `yaml:"wasm"`
+	// Bind replaces Config.Bind.
+	Bind *BindConfig `yaml:"bind"`
+	// Exceptions override Config.Exceptions for the sources of the artifact. Label must be empty.
+	Exceptions *ExceptionConfig `yaml:"exceptions"`
+}
+
+// ArtifactConfigs returns Artifacts. Without them, the single artifact is Output.
+func (c *Config) ArtifactConfigs() []*ArtifactConfig {
+	if len(c.Artifacts) != 0 {
+		return c.Artifacts
+	}
+	return []*ArtifactConfig{{Name: c.Output, Output: c.Output, Kind: ArtifactExecutable}}
+}
+
+// AllTargets returns Targets and the targets of Artifacts.
+func (c *Config) AllTargets() []*BuildTargetLibraryConfig {
+	ret := append([]*BuildTargetLibraryConfig{}, c.Targets...)
+	for _, artifact := range c.Artifacts {
+		ret = append(ret, artifact.Targets...)
+	}
+	return ret
+}
+
+// AllSources returns Sources and the sources of Artifacts.
+func (c *Config) AllSources() []string {
+	ret := append([]string{}, c.Sources...)
+	for _, artifact := range c.Artifacts {
+		ret = append(ret, artifact.Sources...)
+	}
+	return ret
+}
+
+// TemplateConfig is a user template rendered against TemplateData.
+// Path is relative to the config file and Output is relative to the working directory.
+type TemplateConfig struct {
+	Path   string `yaml:"path"`
+	Output string `yaml:"output"`
 }
 
 type BuildTargetLibraryConfig struct {
@@ -44,5 +246,107 @@ func LoadConfig(path string) (*Config, error) {
 	if err := yaml.UnmarshalWithOptions(file, &cfg, yaml.Strict()); err != nil {
 		return nil, err
 	}
+	switch cfg.LinkMode {
+	case "", LinkObjects, LinkArchives:
+	default:
+		return nil, fmt.Errorf("unsupported link_mode: %s", cfg.LinkMode)
+	}
+	names := make(map[string]struct{})
+	for _, artifact := range cfg.Artifacts {
+		if artifact.Name == "" {
+			return nil, fmt.Errorf("artifacts require name")
+		}
+		if _, exists := names[artifact.Name]; exists {
+			return nil, fmt.Errorf("duplicate artifact: %s", artifact.Name)
+		}
+		names[artifact.Name] = struct{}{}
+		switch artifact.Kind {
+		case "", ArtifactExecutable, ArtifactWasmReactor, ArtifactStaticLibrary:
+		default:
+			return nil, fmt.Errorf("unsupported kind of artifact %s: %s", artifact.Name, artifact.Kind)
+		}
+		if artifact.Wasm != nil {
+			if err := artifact.Wasm.validate(); err != nil {
+				return nil, fmt.Errorf("artifact %s: %w", artifact.Name, err)
+			}
+		}
+		if artifact.Bind != nil {
+			if err := artifact.Bind.validate(); err != nil {
+				return nil, fmt.Errorf("artifact %s: %w", artifact.Name, err)
+			}
+		}
+		if artifact.Exceptions != nil {
+			if artifact.Exceptions.Label != "" {
+				return nil, fmt.Errorf("artifact %s: exceptions cannot specify label", artifact.Name)
+			}
+			if err := artifact.Exceptions.validate(); err != nil {
+				return nil, fmt.Errorf("artifact %s: %w", artifact.Name, err)
+			}
+		}
+	}
+	if len(cfg.Artifacts) != 0 && cfg.Output != "" {
+		return nil, fmt.Errorf("output cannot be specified with artifacts")
+	}
+	if cfg.Wasm != nil {
+		if err := cfg.Wasm.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Bind != nil {
+		if err := cfg.Bind.validate(); err != nil {
+			return nil, err
+		}
+	}
+	toolchains := []*ToolchainConfig{cfg.Toolchain}
+	for name, profile := range cfg.Profiles {
+		if profile == nil {
+			return nil, fmt.Errorf("profile %s is empty", name)
+		}
+		toolchains = append(toolchains, profile.Toolchain)
+		if profile.PostLink != nil {
+			if err := profile.PostLink.validate(); err != nil {
+				return nil, fmt.Errorf("profile %s: %w", name, err)
+			}
+		}
+		for _, rule := range profile.Compat {
+			if err := rule.validate(); err != nil {
+				return nil, fmt.Errorf("profile %s: %w", name, err)
+			}
+		}
+		if profile.Threads != nil {
+			if err := profile.Threads.validate(); err != nil {
+				return nil, fmt.Errorf("profile %s: %w", name, err)
+			}
+		}
+	}
+	for _, toolchain := range toolchains {
+		if toolchain == nil {
+			continue
+		}
+		if _, exists := toolchainPresets[toolchain.Preset]; !exists {
+			return nil, fmt.Errorf("unsupported toolchain preset: %s", toolchain.Preset)
+		}
+	}
+	for _, rule := range cfg.Compat {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+	}
+	for _, rule := range cfg.Exceptions {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Threads != nil {
+		if err := cfg.Threads.validate(); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range cfg.Templates {
+		if t.Path == "" || t.Output == "" {
+			return nil, fmt.Errorf("templates require both path and output")
+		}
+	}
+	cfg.path = path
 	return &cfg, nil
 }
@@ -0,0 +1,109 @@
+package bazelmake_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+func TestProfile(t *testing.T) {
+	cfg := createWorkspace(t, map[string]string{
+		"a/lib/BUILD": `
+cc_library(
+    name = "lib",
+    srcs = ["lib.cc"],
+    deps = [
+        ":util",
+        "@b//base",
+    ],
+)
+
+cc_library(
+    name = "util",
+    srcs = ["util.cc"],
+    copts = select({
+        ":wasm": ["-DWASM"],
+        "//conditions:default": ["-DNATIVE"],
+    }),
+    deps = ["@b//base:log"],
+)
+`,
+	})
+	cfg.CompilerOptions = []string{"-Wall"}
+	cfg.Profiles = map[string]*bazelmake.ProfileConfig{
+		"debug": {
+			CompilerOptions: []string{"-O0", "-g"},
+		},
+		"release": {
+			Override:        true,
+			CompilerOptions: []string{"-Oz", "-flto"},
+			LinkerOptions:   []string{"-flto"},
+			Defines:         []string{"NDEBUG"},
+			Conditions:      []string{":wasm"},
+			OutputDir:       "out-release",
+		},
+	}
+	utilOptions := func(t *testing.T, cfg *bazelmake.Config) string {
+		t.Helper()
+		project := newProject(t, cfg)
+		for _, obj := range project.Objects {
+			if strings.HasSuffix(obj.Source, "util.cc") {
+				return strings.Join(append(obj.Options(), obj.Path()), " ")
+			}
+		}
+		t.Fatal("failed to find util.cc")
+		return ""
+	}
+	t.Run("debug", func(t *testing.T) {
+		debug, err := cfg.WithProfile("debug")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(debug.CompilerOptions, " "); got != "-Wall -O0 -g" {
+			t.Fatalf("unexpected compiler options: %s", got)
+		}
+		// select() is ignored without conditions.
+		if got := utilOptions(t, debug); got != "out/debug/a/lib/_objs/util/util.o" {
+			t.Fatalf("unexpected util: %s", got)
+		}
+	})
+	t.Run("release", func(t *testing.T) {
+		release, err := cfg.WithProfile("release")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(release.CompilerOptions, " "); got != "-Oz -flto -DNDEBUG" {
+			t.Fatalf("unexpected compiler options: %s", got)
+		}
+		if got := utilOptions(t, release); got != "-DWASM out-release/a/lib/_objs/util/util.o" {
+			t.Fatalf("unexpected util: %s", got)
+		}
+	})
+	t.Run("default condition", func(t *testing.T) {
+		cfg.Conditions = []string{":other"}
+		if got := utilOptions(t, cfg); got != "-DNATIVE out/a/lib/_objs/util/util.o" {
+			t.Fatalf("unexpected util: %s", got)
+		}
+	})
+	t.Run("unknown", func(t *testing.T) {
+		if _, err := cfg.WithProfile("unknown"); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+	t.Run("empty", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte("profiles:\n  debug:\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bazelmake.LoadConfig(path); err == nil || err.Error() != "profile debug is empty" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		cfg.Profiles["empty"] = nil
+		if _, err := cfg.WithProfile("empty"); err == nil || err.Error() != "profile empty is empty" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,214 @@
+package bazelmake
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ExceptionModel decides how C++ exceptions and setjmp/longjmp are compiled for wasm.
+type ExceptionModel string
+
+const (
+	// ExceptionNone disables exceptions with -fno-exceptions. A throw aborts.
+	ExceptionNone ExceptionModel = "none"
+	// ExceptionSjLj disables exceptions and lowers setjmp/longjmp to wasm exception handling
+	// without the JavaScript glue of Emscripten.
+	ExceptionSjLj ExceptionModel = "sjlj"
+	// ExceptionWasm compiles exceptions to the native wasm exception handling instructions.
+	ExceptionWasm ExceptionModel = "wasm"
+)
+
+// ExceptionConfig chooses the exception model and RTTI of the libraries matching Label.
+// Later rules override the fields they specify.
+type ExceptionConfig struct {
+	// Label is a pattern like the label of CompatConfig. Empty matches every library and source.
+	Label string         `yaml:"label"`
+	Model ExceptionModel `yaml:"model"`
+	// RTTI adds -frtti or -fno-rtti to C++ sources. The compiler options decide it if it is not specified.
+	RTTI *bool `yaml:"rtti"`
+}
+
+func (c *ExceptionConfig) validate() error {
+	switch c.Model {
+	case "", ExceptionNone, ExceptionSjLj, ExceptionWasm:
+	default:
+		return fmt.Errorf("unsupported exception model: %s", c.Model)
+	}
+	if c.Label != "" {
+		if _, _, _, err := parseLabelPattern(c.Label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exceptionSetting is the configured exception model and RTTI of a library or the sources of an artifact.
+type exceptionSetting struct {
+	model ExceptionModel
+	rtti  *bool
+}
+
+func (s *exceptionSetting) apply(cfg *ExceptionConfig) {
+	if cfg.Model != "" {
+		s.model = cfg.Model
+	}
+	if cfg.RTTI != nil {
+		s.rtti = cfg.RTTI
+	}
+}
+
+// compilerOptions returns the options selecting the setting. They follow the other options to override them.
+func (s exceptionSetting) compilerOptions(c bool) []string {
+	var ret []string
+	switch s.model {
+	case ExceptionNone:
+		ret = append(ret, "-fno-exceptions")
+	case ExceptionSjLj:
+		ret = append(ret, "-fno-exceptions", "-mllvm", "-wasm-enable-sjlj")
+	case ExceptionWasm:
+		ret = append(ret, "-fexceptions", "-fwasm-exceptions")
+	}
+	if s.rtti != nil && !c {
+		if *s.rtti {
+			ret = append(ret, "-frtti")
+		} else {
+			ret = append(ret, "-fno-rtti")
+		}
+	}
+	return ret
+}
+
+// effective returns the model and RTTI the compiler applies with options followed by the setting.
+// The model is empty if neither the options nor the setting decide it. RTTI is enabled by default as clang does.
+func (s exceptionSetting) effective(options []string) (ExceptionModel, bool) {
+	var (
+		model ExceptionModel
+		rtti  = true
+	)
+	for i, opt := range options {
+		switch opt {
+		case "-fno-exceptions":
+			model = ExceptionNone
+		case "-fwasm-exceptions":
+			model = ExceptionWasm
+		case "-wasm-enable-sjlj":
+			if i > 0 && options[i-1] == "-mllvm" && model != ExceptionWasm {
+				model = ExceptionSjLj
+			}
+		case "-frtti":
+			rtti = true
+		case "-fno-rtti":
+			rtti = false
+		}
+	}
+	if s.model != "" {
+		model = s.model
+	}
+	if s.rtti != nil {
+		rtti = *s.rtti
+	}
+	return model, rtti
+}
+
+// exceptionSettingOf returns the setting of the rules matching lib. lib is nil for the sources without a library.
+func (c *Config) exceptionSettingOf(lib *CCLibrary) exceptionSetting {
+	var ret exceptionSetting
+	for _, rule := range c.Exceptions {
+		if rule.Label == "" || (lib != nil && matchLabelPattern(rule.Label, lib)) {
+			ret.apply(rule)
+		}
+	}
+	return ret
+}
+
+// artifactExceptionSetting returns the setting of the sources of the artifact.
+func (c *Config) artifactExceptionSetting(artifact *ArtifactConfig) exceptionSetting {
+	ret := c.exceptionSettingOf(nil)
+	if artifact.Exceptions != nil {
+		ret.apply(artifact.Exceptions)
+	}
+	return ret
+}
+
+// usesExceptionSettings reports whether the exception model is configured, which enables the consistency check.
+func (c *Config) usesExceptionSettings() bool {
+	if len(c.Exceptions) != 0 {
+		return true
+	}
+	for _, artifact := range c.Artifacts {
+		if artifact.Exceptions != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// exceptionLinkerOptions returns the linker options the models of the artifact and its libraries require.
+func (a *Artifact) exceptionLinkerOptions() []string {
+	cfg := a.project.Config
+	if !cfg.usesExceptionSettings() {
+		return nil
+	}
+	options := append(append([]string{}, cfg.CompilerOptions...), a.Config.CompilerOptions...)
+	model, _ := cfg.artifactExceptionSetting(a.Config).effective(options)
+	models := map[ExceptionModel]struct{}{model: {}}
+	for _, lib := range a.Libraries {
+		model, _ := a.project.libraryException(lib)
+		models[model] = struct{}{}
+	}
+	var ret []string
+	if _, exists := models[ExceptionWasm]; exists {
+		ret = append(ret, "-fwasm-exceptions")
+	}
+	if _, exists := models[ExceptionSjLj]; exists {
+		ret = append(ret, "-mllvm", "-wasm-enable-sjlj")
+	}
+	return ret
+}
+
+// libraryException returns the effective exception model and RTTI of lib.
+func (p *Project) libraryException(lib *CCLibrary) (ExceptionModel, bool) {
+	options := append(append([]string{}, p.Config.CompilerOptions...), lib.CompilerOptions()...)
+	return p.Config.exceptionSettingOf(lib).effective(options)
+}
+
+// checkExceptions reports the dependencies whose exception model or RTTI conflicts with their dependents.
+// A library throwing wasm exceptions cannot unwind through dependents built without exceptions,
+// and a dependent using RTTI cannot find the type information of a dependency built with -fno-rtti.
+func (p *Project) checkExceptions() error {
+	if !p.Config.usesExceptionSettings() {
+		return nil
+	}
+	var conflicts []string
+	check := func(dependent string, model ExceptionModel, rtti bool, dep *CCLibrary) {
+		depModel, depRTTI := p.libraryException(dep)
+		if depModel == ExceptionWasm && model != "" && model != ExceptionWasm {
+			conflicts = append(conflicts, fmt.Sprintf("%s with exception model %s depends on %s throwing wasm exceptions", dependent, model, dep.FQDN()))
+		}
+		if rtti && !depRTTI {
+			conflicts = append(conflicts, fmt.Sprintf("%s using RTTI depends on %s built with -fno-rtti", dependent, dep.FQDN()))
+		}
+	}
+	for _, lib := range p.Libraries {
+		model, rtti := p.libraryException(lib)
+		for _, dep := range lib.ResolvedDependencies {
+			check(lib.FQDN(), model, rtti, dep)
+		}
+	}
+	for _, artifact := range p.Artifacts {
+		if len(artifact.sources) == 0 {
+			continue
+		}
+		options := append(append([]string{}, p.Config.CompilerOptions...), artifact.Config.CompilerOptions...)
+		model, rtti := p.Config.artifactExceptionSetting(artifact.Config).effective(options)
+		for _, dep := range artifact.Targets {
+			check("artifact "+artifact.Name(), model, rtti, dep)
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	sort.Strings(conflicts)
+	return fmt.Errorf("inconsistent exception models:\n%s", strings.Join(conflicts, "\n"))
+}
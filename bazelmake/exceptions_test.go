@@ -0,0 +1,68 @@
+package bazelmake_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+func TestExceptions(t *testing.T) {
+	noRTTI := false
+	t.Run("wasm", func(t *testing.T) {
+		cfg := createWorkspace(t)
+		cfg.CompilerOptions = []string{"-fno-exceptions"}
+		cfg.Exceptions = []*bazelmake.ExceptionConfig{{Label: "//...", Model: bazelmake.ExceptionWasm, RTTI: &noRTTI}}
+		project := newProject(t, cfg)
+		for _, obj := range project.Objects {
+			expected := "-fexceptions -fwasm-exceptions -fno-rtti"
+			if obj.IsC() {
+				expected = "-fexceptions -fwasm-exceptions"
+			}
+			if got := strings.Join(obj.Options(), " "); !strings.HasSuffix(got, expected) {
+				t.Fatalf("unexpected options of %s: %s", obj.Source, got)
+			}
+		}
+		if got := strings.Join(project.Artifacts[0].LinkerOptions(), " "); got != "-fwasm-exceptions" {
+			t.Fatalf("unexpected linker options: %s", got)
+		}
+	})
+	t.Run("conflicts", func(t *testing.T) {
+		for _, test := range []struct {
+			name       string
+			exceptions []*bazelmake.ExceptionConfig
+			expected   []string
+		}{
+			{
+				name:       "throwing dependency",
+				exceptions: []*bazelmake.ExceptionConfig{{Label: "@b//base:log", Model: bazelmake.ExceptionWasm}},
+				expected: []string{
+					"@a//lib:util with exception model none depends on @b//base:log throwing wasm exceptions",
+					"@b//base:base with exception model none depends on @b//base:log throwing wasm exceptions",
+				},
+			},
+			{
+				name: "rtti",
+				exceptions: []*bazelmake.ExceptionConfig{
+					{Model: bazelmake.ExceptionSjLj},
+					{Label: "//lib:util", RTTI: &noRTTI},
+				},
+				expected: []string{"@a//lib:lib using RTTI depends on @a//lib:util built with -fno-rtti"},
+			},
+		} {
+			t.Run(test.name, func(t *testing.T) {
+				cfg := createWorkspace(t)
+				cfg.CompilerOptions = []string{"-fno-exceptions"}
+				cfg.Exceptions = test.exceptions
+				_, err := bazelmake.NewProject(cfg)
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				expected := "inconsistent exception models:\n" + strings.Join(test.expected, "\n")
+				if err.Error() != expected {
+					t.Fatalf("unexpected error:\nexpected %s\ngot      %s", expected, err)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,627 @@
+package bazelmake
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+const (
+	// MTimeCheck rebuilds an output older than one of its inputs.
+	MTimeCheck = "mtime"
+	// HashCheck rebuilds an output when the contents of its inputs change.
+	HashCheck = "hash"
+)
+
+// Action is a command producing Output from Inputs.
+type Action struct {
+	Kind      string
+	Inputs    []string
+	Output    string
+	Arguments []string
+	// Depfile lists the headers included by a compile action. It is written by the compiler.
+	Depfile string
+	// Fresh removes Output before running the command because it would update the existing file like ar.
+	Fresh bool
+	// Run runs the action in process instead of Arguments, which still identify the action. It is not cached.
+	Run func() error
+}
+
+func (a *Action) Description() string {
+	return fmt.Sprintf("%s %s", a.Kind, a.Output)
+}
+
+// CompileActions returns the actions compiling the objects except the stubs, which are compiled after they are generated.
+// They write depfiles so that the executor can rebuild objects when an included header changes.
+func (p *Project) CompileActions() []*Action {
+	ret := make([]*Action, 0, len(p.Objects))
+	for _, obj := range p.Objects {
+		if !obj.IsStubs() {
+			ret = append(ret, p.compileAction(obj))
+		}
+	}
+	return ret
+}
+
+func (p *Project) compileAction(obj *Object) *Action {
+	kind := "CXX"
+	if obj.IsC() {
+		kind = "CC"
+	}
+	depfile := obj.DepfilePath()
+	return &Action{
+		Kind:      kind,
+		Inputs:    []string{obj.Source},
+		Output:    obj.Path(),
+		Arguments: append(p.CompileArguments(obj), "-MD", "-MF", depfile),
+		Depfile:   depfile,
+	}
+}
+
+// StubActions returns the actions writing the stubs of the imports of the artifacts.
+func (p *Project) StubActions() []*Action {
+	var ret []*Action
+	for _, artifact := range p.Artifacts {
+		stubs := artifact.Stubs()
+		if stubs == nil {
+			continue
+		}
+		objects := artifact.ExportedObjects()
+		imports := artifact.imports()
+		ret = append(ret, &Action{
+			Kind:      "STUBS",
+			Inputs:    objects,
+			Output:    stubs.Source,
+			Arguments: artifact.StubsArguments(),
+			Run: func() error {
+				return WriteImportStubs(stubs.Source, objects, imports)
+			},
+		})
+	}
+	return ret
+}
+
+// StubCompileActions returns the actions compiling the stubs of the artifacts.
+func (p *Project) StubCompileActions() []*Action {
+	var ret []*Action
+	for _, artifact := range p.Artifacts {
+		if stubs := artifact.Stubs(); stubs != nil {
+			ret = append(ret, p.compileAction(stubs))
+		}
+	}
+	return ret
+}
+
+// ArchiveActions returns the actions creating the archives in LinkArchives mode.
+func (p *Project) ArchiveActions() []*Action {
+	ret := make([]*Action, 0, len(p.Archives))
+	for _, archive := range p.Archives {
+		inputs := make([]string, 0, len(archive.Objects))
+		for _, obj := range archive.Objects {
+			inputs = append(inputs, obj.Path())
+		}
+		ret = append(ret, &Action{
+			Kind:      "AR",
+			Inputs:    inputs,
+			Output:    archive.Path(),
+			Arguments: p.ArchiveArguments(archive),
+			Fresh:     true,
+		})
+	}
+	return ret
+}
+
+// ExportActions returns the actions writing the exports files of the artifacts with export patterns.
+func (p *Project) ExportActions() []*Action {
+	var ret []*Action
+	for _, artifact := range p.Artifacts {
+		path := artifact.ExportsPath()
+		if path == "" {
+			continue
+		}
+		objects := artifact.ExportedObjects()
+		patterns := artifact.ExportPatterns()
+		ret = append(ret, &Action{
+			Kind:      "EXPORTS",
+			Inputs:    objects,
+			Output:    path,
+			Arguments: artifact.ExportsArguments(),
+			Run: func() error {
+				return WriteExportsFile(path, objects, patterns)
+			},
+		})
+	}
+	return ret
+}
+
+// LinkActions returns the actions linking the artifacts.
+func (p *Project) LinkActions() []*Action {
+	ret := make([]*Action, 0, len(p.Artifacts))
+	for _, artifact := range p.Artifacts {
+		inputs := artifact.LinkInputs()
+		if exports := artifact.ExportsPath(); exports != "" {
+			inputs = append(inputs, exports)
+		}
+		action := &Action{
+			Kind:      "LINK",
+			Inputs:    inputs,
+			Output:    artifact.LinkedPath(),
+			Arguments: artifact.LinkArguments(),
+		}
+		if artifact.IsStaticLibrary() {
+			action.Kind = "AR"
+			action.Fresh = true
+		}
+		ret = append(ret, action)
+	}
+	return ret
+}
+
+// PostLinkActions returns the actions processing the linked modules of the artifacts with the post-link config.
+func (p *Project) PostLinkActions() []*Action {
+	var ret []*Action
+	for _, artifact := range p.Artifacts {
+		cfg := artifact.PostLink()
+		if cfg == nil {
+			continue
+		}
+		input := artifact.LinkedPath()
+		output := artifact.Path()
+		exports := artifact.exportList()
+		inputs := []string{input}
+		exportsPath := artifact.ExportsPath()
+		if exportsPath != "" && cfg.MetaDCE {
+			inputs = append(inputs, exportsPath)
+		}
+		ret = append(ret, &Action{
+			Kind:      "POSTLINK",
+			Inputs:    inputs,
+			Output:    output,
+			Arguments: artifact.PostLinkArguments(),
+			Run: func() error {
+				exports := exports
+				if exportsPath != "" && cfg.MetaDCE {
+					symbols, err := ReadExportList(exportsPath)
+					if err != nil {
+						return err
+					}
+					exports = append(append([]string{}, exports...), symbols...)
+				}
+				return PostLink(input, output, cfg, exports)
+			},
+		})
+	}
+	return ret
+}
+
+type ExecutorOption struct {
+	// Jobs is the number of actions run in parallel. It defaults to the number of CPUs.
+	Jobs int
+	// Check is either MTimeCheck or HashCheck. It defaults to MTimeCheck.
+	Check string
+	// Output receives the progress and the output of the commands. It defaults to os.Stdout.
+	Output io.Writer
+	// ActionLog receives the executed actions as Makefile rules if it is not nil.
+	ActionLog io.Writer
+	// Cache restores the outputs of actions run before if it is not nil.
+	Cache *ActionCache
+}
+
+// Executor runs the actions of a project without make.
+type Executor struct {
+	project   *Project
+	jobs      int
+	check     string
+	output    io.Writer
+	actionLog io.Writer
+	cache     *ActionCache
+	statePath string
+	state     map[string]*actionState
+	total     int
+	finished  int
+	mu        sync.Mutex
+}
+
+// actionState is recorded for every output after the action succeeded.
+type actionState struct {
+	Command string `json:"command"`
+	Digest  string `json:"digest,omitempty"`
+}
+
+func NewExecutor(project *Project, opt *ExecutorOption) (*Executor, error) {
+	if opt == nil {
+		opt = &ExecutorOption{}
+	}
+	jobs := opt.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	check := opt.Check
+	switch check {
+	case "":
+		check = MTimeCheck
+	case MTimeCheck, HashCheck:
+	default:
+		return nil, fmt.Errorf("unsupported up-to-date check: %s", check)
+	}
+	output := opt.Output
+	if output == nil {
+		output = os.Stdout
+	}
+	return &Executor{
+		project:   project,
+		jobs:      jobs,
+		check:     check,
+		output:    output,
+		actionLog: opt.ActionLog,
+		cache:     opt.Cache,
+		statePath: filepath.Join(project.Config.OutputDirectory(), ".bazelmake_state.json"),
+		state:     make(map[string]*actionState),
+	}, nil
+}
+
+// Build compiles the objects in parallel and links them.
+// Up-to-date outputs are not rebuilt.
+func (e *Executor) Build(ctx context.Context) error {
+	if err := e.loadState(); err != nil {
+		return err
+	}
+	phases := [][]*Action{
+		e.project.CompileActions(),
+		e.project.ArchiveActions(),
+		e.project.StubActions(),
+		e.project.StubCompileActions(),
+		e.project.ExportActions(),
+		e.project.LinkActions(),
+		e.project.PostLinkActions(),
+	}
+	for _, actions := range phases {
+		for _, action := range actions {
+			if err := os.MkdirAll(filepath.Dir(action.Output), 0o755); err != nil {
+				return err
+			}
+		}
+		e.total += len(actions)
+	}
+	// an action is checked after the previous phase finished because it depends on the outputs.
+	var buildErr error
+	for _, actions := range phases {
+		var outdated []*Action
+		for _, action := range actions {
+			if e.isUpToDate(action) {
+				e.total--
+				continue
+			}
+			outdated = append(outdated, action)
+		}
+		if buildErr = e.run(ctx, outdated); buildErr != nil {
+			break
+		}
+	}
+	if buildErr == nil && e.finished == 0 {
+		for _, artifact := range e.project.Artifacts {
+			fmt.Fprintf(e.output, "%s is up to date\n", artifact.Path())
+		}
+	}
+	if err := e.saveState(); err != nil && buildErr == nil {
+		return err
+	}
+	if e.cache != nil && buildErr == nil {
+		if err := e.cache.TrimToLimit(); err != nil {
+			return err
+		}
+	}
+	return buildErr
+}
+
+func (e *Executor) run(ctx context.Context, actions []*Action) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan *Action)
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for i := 0; i < e.jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for action := range queue {
+				if err := e.runAction(ctx, action); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+	for _, action := range actions {
+		select {
+		case queue <- action:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(queue)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+var (
+	progressColor = color.New(color.FgGreen)
+	failureColor  = color.New(color.FgRed, color.Bold)
+)
+
+func (e *Executor) runAction(ctx context.Context, action *Action) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if e.cache != nil && action.Run == nil {
+		found, err := e.cache.Restore(action)
+		if err != nil {
+			return err
+		}
+		if found {
+			return e.finishAction(action, "(cached)")
+		}
+	}
+	e.mu.Lock()
+	e.finished++
+	progressColor.Fprintf(e.output, "[%d/%d] ", e.finished, e.total)
+	fmt.Fprintln(e.output, action.Description())
+	e.mu.Unlock()
+
+	if action.Fresh {
+		if err := os.Remove(action.Output); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	var (
+		out    bytes.Buffer
+		runErr error
+	)
+	if action.Run != nil {
+		if runErr = action.Run(); runErr != nil {
+			fmt.Fprintln(&out, runErr)
+		}
+	} else {
+		cmd := exec.CommandContext(ctx, action.Arguments[0], action.Arguments[1:]...)
+		cmd.Stdout = &out
+		cmd.Stderr = &out
+		runErr = cmd.Run()
+	}
+
+	state := &actionState{Command: commandDigest(action)}
+	if runErr == nil && e.check == HashCheck {
+		digest, err := e.inputDigest(action)
+		if err != nil {
+			return err
+		}
+		state.Digest = digest
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if runErr != nil {
+		failureColor.Fprintf(e.output, "FAILED: %s\n", action.Output)
+		fmt.Fprintln(e.output, shellCommand(action.Arguments))
+		e.output.Write(out.Bytes())
+		return fmt.Errorf("failed to build %s: %w", action.Output, runErr)
+	}
+	e.output.Write(out.Bytes())
+	if e.actionLog != nil {
+		fmt.Fprintf(e.actionLog, "%s: %s\n\t%s\n\n",
+			makeEscape(action.Output),
+			makeEscape(strings.Join(action.Inputs, " ")),
+			makeEscape(shellCommand(action.Arguments)),
+		)
+	}
+	e.state[action.Output] = state
+	if e.cache != nil && action.Run == nil {
+		if err := e.cache.Store(action); err != nil {
+			return fmt.Errorf("failed to store %s to the cache: %w", action.Output, err)
+		}
+	}
+	return nil
+}
+
+// finishAction records action restored from the cache.
+func (e *Executor) finishAction(action *Action, note string) error {
+	state := &actionState{Command: commandDigest(action)}
+	if e.check == HashCheck {
+		digest, err := e.inputDigest(action)
+		if err != nil {
+			return err
+		}
+		state.Digest = digest
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.finished++
+	progressColor.Fprintf(e.output, "[%d/%d] ", e.finished, e.total)
+	fmt.Fprintln(e.output, action.Description(), note)
+	e.state[action.Output] = state
+	return nil
+}
+
+func (e *Executor) isUpToDate(action *Action) bool {
+	info, err := os.Stat(action.Output)
+	if err != nil {
+		return false
+	}
+	e.mu.Lock()
+	state, exists := e.state[action.Output]
+	e.mu.Unlock()
+	if !exists || state.Command != commandDigest(action) {
+		return false
+	}
+	inputs, err := e.inputs(action)
+	if err != nil {
+		return false
+	}
+	if e.check == HashCheck {
+		digest, err := e.inputDigest(action)
+		if err != nil {
+			return false
+		}
+		return digest == state.Digest
+	}
+	for _, input := range inputs {
+		inputInfo, err := os.Stat(input)
+		if err != nil {
+			return false
+		}
+		if inputInfo.ModTime().After(info.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
+
+// inputs returns the inputs of action including the headers listed in the depfile.
+func (e *Executor) inputs(action *Action) ([]string, error) {
+	if action.Depfile == "" {
+		return action.Inputs, nil
+	}
+	deps, err := readDepfile(action.Depfile)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]string{}, action.Inputs...), deps...), nil
+}
+
+func (e *Executor) inputDigest(action *Action) (string, error) {
+	inputs, err := e.inputs(action)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, input := range inputs {
+		f, err := os.Open(input)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00", input)
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (e *Executor) loadState() error {
+	content, err := os.ReadFile(e.statePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if err := json.Unmarshal(content, &e.state); err != nil {
+		// a broken state rebuilds everything.
+		e.state = make(map[string]*actionState)
+	}
+	return nil
+}
+
+func (e *Executor) saveState() error {
+	content, err := json.Marshal(e.state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(e.statePath), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(e.statePath, content, 0o600)
+}
+
+func commandDigest(action *Action) string {
+	h := sha256.New()
+	for _, arg := range action.Arguments {
+		fmt.Fprintf(h, "%s\x00", arg)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// readDepfile returns the prerequisites of the first rule in a Makefile-style depfile written by -MD.
+func readDepfile(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.ReplaceAll(string(content), "\\\r\n", " ")
+	text = strings.ReplaceAll(text, "\\\n", " ")
+	if idx := strings.IndexByte(text, '\n'); idx >= 0 {
+		text = text[:idx]
+	}
+	idx := strings.Index(text, ": ")
+	if idx < 0 {
+		return nil, fmt.Errorf("failed to parse depfile: %s", path)
+	}
+	var (
+		ret  []string
+		word strings.Builder
+	)
+	rest := text[idx+2:]
+	for i := 0; i < len(rest); i++ {
+		c := rest[i]
+		switch {
+		case c == '\\' && i+1 < len(rest) && rest[i+1] == ' ':
+			word.WriteByte(' ')
+			i++
+		case c == ' ' || c == '\t':
+			if word.Len() > 0 {
+				ret = append(ret, word.String())
+				word.Reset()
+			}
+		default:
+			word.WriteByte(c)
+		}
+	}
+	if word.Len() > 0 {
+		ret = append(ret, word.String())
+	}
+	return ret, nil
+}
+
+var shellSafeArg = regexp.MustCompile(`^[A-Za-z0-9_./=+,:@%-]+$`)
+
+func shellCommand(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if shellSafeArg.MatchString(arg) {
+			quoted = append(quoted, arg)
+			continue
+		}
+		quoted = append(quoted, "'"+strings.ReplaceAll(arg, "'", `'\''`)+"'")
+	}
+	return strings.Join(quoted, " ")
+}
+
+func makeEscape(s string) string {
+	return strings.ReplaceAll(s, "$", "$$")
+}
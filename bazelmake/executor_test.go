@@ -0,0 +1,139 @@
+package bazelmake_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+// fakeCompiler copies the source to the object and writes a depfile listing the source.
+const fakeCompiler = `#!/bin/sh
+out=""; dep=""; src=""
+while [ $# -gt 0 ]; do
+  case "$1" in
+    -o) out="$2"; shift;;
+    -MF) dep="$2"; shift;;
+    -c) src="$2"; shift;;
+  esac
+  shift
+done
+if [ -n "$src" ]; then
+  cat "$src" > "$out"
+  echo "$out: $src" > "$dep"
+else
+  echo linked > "$out"
+fi
+`
+
+func TestExecutor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake compiler requires sh")
+	}
+	cfg := createCWorkspace(t)
+	for _, src := range []string{"a/lib/lib.cc", "a/lib/util.cc", "b/base/base.cc", "b/base/log.cc", "a/c/c.c"} {
+		if err := os.WriteFile(filepath.Join(cfg.Root, src), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	compiler := filepath.Join(t.TempDir(), "cc.sh")
+	if err := os.WriteFile(compiler, []byte(fakeCompiler), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Compiler = compiler
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	var cache *bazelmake.ActionCache
+	build := func(t *testing.T, check string) (string, string) {
+		t.Helper()
+		project := newProject(t, cfg)
+		var out, actionLog bytes.Buffer
+		executor, err := bazelmake.NewExecutor(project, &bazelmake.ExecutorOption{
+			Jobs:      2,
+			Check:     check,
+			Output:    &out,
+			ActionLog: &actionLog,
+			Cache:     cache,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := executor.Build(context.Background()); err != nil {
+			t.Fatalf("%s: %s", err, out.String())
+		}
+		return out.String(), actionLog.String()
+	}
+	for _, check := range []string{bazelmake.MTimeCheck, bazelmake.HashCheck} {
+		t.Run(check, func(t *testing.T) {
+			if err := os.RemoveAll("out"); err != nil {
+				t.Fatal(err)
+			}
+			out, actionLog := build(t, check)
+			if !strings.Contains(out, "[6/6] LINK out/example") {
+				t.Fatalf("unexpected output: %s", out)
+			}
+			if !strings.Contains(actionLog, "out/example: out/") {
+				t.Fatalf("unexpected action log: %s", actionLog)
+			}
+			if _, err := os.Stat(filepath.Join("out", "a", "lib", "_objs", "lib", "lib.d")); err != nil {
+				t.Fatalf("failed to find the depfile the other backends name: %s", err)
+			}
+			if out, _ := build(t, check); out != "out/example is up to date\n" {
+				t.Fatalf("unexpected output: %s", out)
+			}
+			util := filepath.Join(cfg.Root, "a/lib/util.cc")
+			if err := os.WriteFile(util, []byte("changed by "+check), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			linked := filepath.Join("out", "example")
+			info, err := os.Stat(linked)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(util, info.ModTime().Add(1e9), info.ModTime().Add(1e9)); err != nil {
+				t.Fatal(err)
+			}
+			out, _ = build(t, check)
+			if !strings.Contains(out, "[1/2] CXX") || !strings.Contains(out, "[2/2] LINK out/example") {
+				t.Fatalf("unexpected output: %s", out)
+			}
+		})
+	}
+
+	t.Run("disk cache", func(t *testing.T) {
+		cache = bazelmake.NewActionCache(t.TempDir(), 0)
+		defer func() { cache = nil }()
+		if err := os.RemoveAll("out"); err != nil {
+			t.Fatal(err)
+		}
+		if out, _ := build(t, bazelmake.MTimeCheck); strings.Contains(out, "(cached)") {
+			t.Fatalf("unexpected output: %s", out)
+		}
+		if err := os.RemoveAll("out"); err != nil {
+			t.Fatal(err)
+		}
+		out, actionLog := build(t, bazelmake.MTimeCheck)
+		if strings.Count(out, "(cached)") != 6 || actionLog != "" {
+			t.Fatalf("failed to restore outputs from the cache: %s", out)
+		}
+		removed, _, err := cache.Trim(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if removed != 6 {
+			t.Fatalf("unexpected number of removed outputs: %d", removed)
+		}
+	})
+}
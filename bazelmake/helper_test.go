@@ -0,0 +1,88 @@
+package bazelmake_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+// createWorkspace writes a small workspace of two repositories to a temporary directory.
+// @a//lib:lib depends on @b//base:log through both @a//lib:util and @b//base:base.
+// The overlays add files or replace the files of the workspace, which keeps the fixtures of a test in its own file.
+func createWorkspace(t *testing.T, overlays ...map[string]string) *bazelmake.Config {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"a/lib/BUILD": `
+cc_library(
+    name = "lib",
+    srcs = ["lib.cc"],
+    hdrs = ["lib.h"],
+    deps = [
+        ":util",
+        "@b//base",
+    ],
+)
+
+cc_library(
+    name = "util",
+    srcs = ["util.cc"],
+    deps = ["@b//base:log"],
+)
+`,
+		"b/base/BUILD": `
+cc_library(
+    name = "base",
+    srcs = ["base.cc"],
+    deps = [":log"],
+)
+
+cc_library(
+    name = "log",
+    srcs = ["log.cc"],
+)
+`,
+	}
+	writeFiles(t, root, files)
+	for _, overlay := range overlays {
+		writeFiles(t, root, overlay)
+	}
+	return &bazelmake.Config{
+		Root: root,
+		Targets: []*bazelmake.BuildTargetLibraryConfig{
+			{Library: "a", Path: "lib", Name: "lib"},
+		},
+		Libraries: []*bazelmake.LibraryConfig{
+			{Name: "a", Root: "a"},
+			{Name: "b", Root: "b"},
+		},
+		Output:   "example",
+		Compiler: "clang++",
+	}
+}
+
+// writeFiles writes the files keyed by the paths relative to root.
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newProject returns the project of cfg and fails the test on errors.
+func newProject(t *testing.T, cfg *bazelmake.Config) *bazelmake.Project {
+	t.Helper()
+	project, err := bazelmake.NewProject(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return project
+}
@@ -0,0 +1,339 @@
+package bazelmake
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-wasmbind-tools/wasm"
+	"github.com/goccy/go-wasmbind-tools/wasmbind"
+)
+
+// ImportAction decides how an import of the module is satisfied.
+type ImportAction string
+
+const (
+	// ImportStub defines the function in C returning ImportConfig.Return.
+	ImportStub ImportAction = "stub"
+	// ImportTrap defines the function in C trapping when it is called.
+	ImportTrap ImportAction = "trap"
+	// ImportHost leaves the import to the host, which implements it with the generated Go code.
+	ImportHost ImportAction = "host"
+)
+
+// wasiModule is the module of the WASI imports, which are provided by the runtime.
+const wasiModule = "wasi_snapshot_preview1"
+
+// ImportConfig declares the behavior of the imports matching Module and Name.
+type ImportConfig struct {
+	// Module is the module of the import. It defaults to env, where undefined C symbols are imported from.
+	Module string `yaml:"module"`
+	// Name is a regular expression matching the whole name of the import, which is the symbol name in env.
+	Name   string       `yaml:"name"`
+	Action ImportAction `yaml:"action"`
+	// Return is the value returned by a stub.
+	Return int64 `yaml:"return"`
+
+	re *regexp.Regexp
+}
+
+func (c *ImportConfig) validate() error {
+	switch c.Action {
+	case ImportStub, ImportTrap, ImportHost:
+	default:
+		return fmt.Errorf("unsupported action of import %s: %q", c.Name, c.Action)
+	}
+	if c.Name == "" {
+		return fmt.Errorf("imports require name")
+	}
+	_, err := c.compile()
+	return err
+}
+
+func (c *ImportConfig) module() string {
+	if c.Module == "" {
+		return "env"
+	}
+	return c.Module
+}
+
+func (c *ImportConfig) compile() (*regexp.Regexp, error) {
+	if c.re != nil {
+		return c.re, nil
+	}
+	re, err := regexp.Compile("^(?:" + c.Name + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid name of import: %w", err)
+	}
+	c.re = re
+	return re, nil
+}
+
+func (c *ImportConfig) matches(module, name string) bool {
+	re, err := c.compile()
+	return err == nil && c.module() == module && re.MatchString(name)
+}
+
+// findImportConfig returns the first config matching the import or nil.
+func findImportConfig(imports []*ImportConfig, module, name string) *ImportConfig {
+	for _, imp := range imports {
+		if imp.matches(module, name) {
+			return imp
+		}
+	}
+	return nil
+}
+
+// stubbed reports whether an import is defined by the stubs.
+func stubbed(imports []*ImportConfig) bool {
+	for _, imp := range imports {
+		if imp.Action == ImportStub || imp.Action == ImportTrap {
+			return true
+		}
+	}
+	return false
+}
+
+// ImportArguments returns the options of the stubs command declaring imports.
+func ImportArguments(imports []*ImportConfig) []string {
+	var ret []string
+	for _, imp := range imports {
+		switch imp.Action {
+		case ImportStub:
+			ret = append(ret, "--stub", fmt.Sprintf("%s:%s=%d", imp.module(), imp.Name, imp.Return))
+		case ImportTrap:
+			ret = append(ret, "--trap", imp.module()+":"+imp.Name)
+		}
+	}
+	return ret
+}
+
+// ParseImportArgument parses MODULE:NAME[=RETURN] of the stubs command.
+func ParseImportArgument(arg string, action ImportAction) (*ImportConfig, error) {
+	module, name, found := strings.Cut(arg, ":")
+	if !found {
+		return nil, fmt.Errorf("invalid import %q. specify MODULE:NAME", arg)
+	}
+	imp := &ImportConfig{Module: module, Name: name, Action: action}
+	if action == ImportStub {
+		if i := strings.LastIndex(name, "="); i >= 0 {
+			v, err := strconv.ParseInt(name[i+1:], 10, 64)
+			if err == nil {
+				imp.Name = name[:i]
+				imp.Return = v
+			}
+		}
+	}
+	if err := imp.validate(); err != nil {
+		return nil, err
+	}
+	return imp, nil
+}
+
+// UndefinedFunction is a function imported by relocatable objects and defined by none of them.
+type UndefinedFunction struct {
+	Module string
+	// Name is the name of the import.
+	Name string
+	// Symbol is the C symbol, which differs from Name if the import is renamed by the import_name attribute.
+	Symbol string
+	Type   *wasm.FuncType
+}
+
+// UndefinedFunctions returns the functions undefined in objects sorted by the symbol.
+// Some of them may be defined by the libraries linked by the compiler driver like libc.
+func UndefinedFunctions(objects []string) ([]*UndefinedFunction, error) {
+	defined := make(map[string]struct{})
+	undefined := make(map[string]*UndefinedFunction)
+	for _, obj := range objects {
+		m, err := wasm.ReadFile(obj)
+		if err != nil {
+			return nil, err
+		}
+		var funcImports []*wasm.Import
+		for _, imp := range m.Imports {
+			if imp.Kind == wasm.ExternalFunction {
+				funcImports = append(funcImports, imp)
+			}
+		}
+		for _, sym := range m.Symbols {
+			if sym.Kind != wasm.SymbolFunction {
+				continue
+			}
+			if sym.IsDefined() {
+				if sym.IsGlobal() {
+					defined[sym.Name] = struct{}{}
+				}
+				continue
+			}
+			if int(sym.Index) >= len(funcImports) {
+				return nil, fmt.Errorf("%s: symbol index %d is out of range", obj, sym.Index)
+			}
+			imp := funcImports[sym.Index]
+			symbol := sym.Name
+			if symbol == "" {
+				symbol = imp.Name
+			}
+			if _, exists := undefined[symbol]; exists {
+				continue
+			}
+			typ, err := m.FunctionType(sym.Index)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", obj, err)
+			}
+			undefined[symbol] = &UndefinedFunction{Module: imp.Module, Name: imp.Name, Symbol: symbol, Type: typ}
+		}
+	}
+	ret := make([]*UndefinedFunction, 0, len(undefined))
+	for symbol, fn := range undefined {
+		if _, exists := defined[symbol]; !exists {
+			ret = append(ret, fn)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Symbol < ret[j].Symbol
+	})
+	return ret, nil
+}
+
+var cTypes = map[byte]string{
+	wasm.ValueI32: "int32_t",
+	wasm.ValueI64: "int64_t",
+	wasm.ValueF32: "float",
+	wasm.ValueF64: "double",
+}
+
+// GenerateImportStubs returns the C source defining the undefined functions of objects declared as stubs or traps.
+func GenerateImportStubs(objects []string, imports []*ImportConfig) ([]byte, error) {
+	funcs, err := UndefinedFunctions(objects)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	b.WriteString("// Code generated by bazel2makefile stubs. DO NOT EDIT.\n\n")
+	b.WriteString("#include <stdint.h>\n\n")
+	b.WriteString("#ifdef __cplusplus\nextern \"C\" {\n#endif\n")
+	for i, fn := range funcs {
+		imp := findImportConfig(imports, fn.Module, fn.Name)
+		if imp == nil || imp.Action == ImportHost {
+			continue
+		}
+		if len(fn.Type.Results) > 1 {
+			return nil, fmt.Errorf("%s returns multiple values, which cannot be stubbed in C", fn.Symbol)
+		}
+		result := "void"
+		if len(fn.Type.Results) == 1 {
+			result = cTypes[fn.Type.Results[0]]
+		}
+		params := make([]string, 0, len(fn.Type.Params))
+		for j, p := range fn.Type.Params {
+			t, exists := cTypes[p]
+			if !exists {
+				return nil, fmt.Errorf("%s has a parameter of %s, which cannot be stubbed in C", fn.Symbol, wasm.ValueTypeName(p))
+			}
+			params = append(params, fmt.Sprintf("%s a%d", t, j))
+		}
+		if len(params) == 0 {
+			params = append(params, "void")
+		}
+		name := fn.Symbol
+		if !isCIdentifier(name) {
+			// mangled names are defined by asm labels.
+			name = fmt.Sprintf("bazelmake_stub_%d", i)
+			fmt.Fprintf(&b, "\n%s %s(%s) __asm__(%q);\n", result, name, strings.Join(params, ", "), fn.Symbol)
+		}
+		fmt.Fprintf(&b, "\n// %s.%s\n%s %s(%s) {\n", fn.Module, fn.Name, result, name, strings.Join(params, ", "))
+		switch {
+		case imp.Action == ImportTrap:
+			b.WriteString("  __builtin_trap();\n")
+		case result != "void":
+			fmt.Fprintf(&b, "  return (%s)%d;\n", result, imp.Return)
+		}
+		b.WriteString("}\n")
+	}
+	b.WriteString("\n#ifdef __cplusplus\n}\n#endif\n")
+	return []byte(b.String()), nil
+}
+
+func isCIdentifier(s string) bool {
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		return false
+	}
+	for _, c := range s {
+		if c != '_' && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteImportStubs writes the stubs of the undefined functions of objects to path.
+func WriteImportStubs(path string, objects []string, imports []*ImportConfig) error {
+	src, err := GenerateImportStubs(objects, imports)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, src)
+}
+
+// ModuleImport is an import of a linked module with the config declaring it.
+type ModuleImport struct {
+	*wasm.Import
+	Type *wasm.FuncType
+	// Config is nil if no config matches the import.
+	Config *ImportConfig
+}
+
+// Action returns the action of the import. WASI imports are provided by the runtime, and the others default to host.
+func (i *ModuleImport) Action() ImportAction {
+	if i.Config != nil {
+		return i.Config.Action
+	}
+	return ImportHost
+}
+
+// ModuleImports returns the function imports of the linked artifact except WASI.
+func (a *Artifact) ModuleImports() ([]*ModuleImport, error) {
+	m, err := wasm.ReadFile(a.Path())
+	if err != nil {
+		return nil, err
+	}
+	return moduleImports(m, a.imports())
+}
+
+func moduleImports(m *wasm.Module, imports []*ImportConfig) ([]*ModuleImport, error) {
+	var ret []*ModuleImport
+	var index uint32
+	for _, imp := range m.Imports {
+		if imp.Kind != wasm.ExternalFunction {
+			continue
+		}
+		typ, err := m.FunctionType(index)
+		if err != nil {
+			return nil, err
+		}
+		index++
+		if imp.Module == wasiModule {
+			continue
+		}
+		ret = append(ret, &ModuleImport{Import: imp, Type: typ, Config: findImportConfig(imports, imp.Module, imp.Name)})
+	}
+	return ret, nil
+}
+
+// hostFunctions returns the imports of m implemented by the host.
+func hostFunctions(m *wasm.Module, imports []*ImportConfig) ([]*wasmbind.HostFunction, error) {
+	modImports, err := moduleImports(m, imports)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*wasmbind.HostFunction
+	for _, imp := range modImports {
+		if imp.Action() == ImportHost {
+			ret = append(ret, &wasmbind.HostFunction{Module: imp.Module, Name: imp.Name, Type: imp.Type})
+		}
+	}
+	return ret, nil
+}
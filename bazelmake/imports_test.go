@@ -0,0 +1,105 @@
+package bazelmake_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+func wasmObject(t *testing.T, sections ...[]byte) string {
+	t.Helper()
+	obj := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	for _, sec := range sections {
+		obj = append(obj, sec...)
+	}
+	path := filepath.Join(t.TempDir(), "obj.o")
+	if err := os.WriteFile(path, obj, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func wasmSection(id byte, payload ...byte) []byte {
+	return append([]byte{id, byte(len(payload))}, payload...)
+}
+
+func linkingSection(symtab ...byte) []byte {
+	return wasmSection(0, append([]byte{7, 'l', 'i', 'n', 'k', 'i', 'n', 'g', 2, 8, byte(len(symtab))}, symtab...)...)
+}
+
+func TestImportStubs(t *testing.T) {
+	// an object importing add, abort_now and host_log from env.
+	obj := wasmObject(t,
+		wasmSection(1, 2, 0x60, 2, 0x7f, 0x7f, 1, 0x7f, 0x60, 0, 0),
+		wasmSection(2, 3,
+			3, 'e', 'n', 'v', 3, 'a', 'd', 'd', 0x00, 0,
+			3, 'e', 'n', 'v', 9, 'a', 'b', 'o', 'r', 't', '_', 'n', 'o', 'w', 0x00, 1,
+			3, 'e', 'n', 'v', 8, 'h', 'o', 's', 't', '_', 'l', 'o', 'g', 0x00, 1,
+		),
+		linkingSection(3, 0x00, 0x10, 0x00, 0x00, 0x10, 0x01, 0x00, 0x10, 0x02),
+	)
+	// an object defining host_log.
+	def := wasmObject(t, linkingSection(1, 0x00, 0x00, 0x00, 8, 'h', 'o', 's', 't', '_', 'l', 'o', 'g'))
+	funcs, err := bazelmake.UndefinedFunctions([]string{obj, def})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fn := range funcs {
+		names = append(names, fn.Symbol)
+	}
+	if got := strings.Join(names, " "); got != "abort_now add" {
+		t.Fatalf("unexpected undefined functions: %s", got)
+	}
+	imports := []*bazelmake.ImportConfig{
+		{Name: "add", Action: bazelmake.ImportStub, Return: -1},
+		{Name: "abort.*", Action: bazelmake.ImportTrap},
+		{Name: ".*", Action: bazelmake.ImportHost},
+	}
+	var parsed []*bazelmake.ImportConfig
+	args := bazelmake.ImportArguments(imports)
+	if got := strings.Join(args, " "); got != "--stub env:add=-1 --trap env:abort.*" {
+		t.Fatalf("unexpected arguments: %s", got)
+	}
+	for i := 0; i < len(args); i += 2 {
+		imp, err := bazelmake.ParseImportArgument(args[i+1], bazelmake.ImportAction(strings.TrimPrefix(args[i], "--")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed = append(parsed, imp)
+	}
+	src, err := bazelmake.GenerateImportStubs([]string{obj, def}, parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"// env.abort_now\nvoid abort_now(void) {\n  __builtin_trap();\n}\n",
+		"// env.add\nint32_t add(int32_t a0, int32_t a1) {\n  return (int32_t)-1;\n}\n",
+	} {
+		if !strings.Contains(string(src), expected) {
+			t.Fatalf("stubs do not contain %q:\n%s", expected, src)
+		}
+	}
+	t.Run("project", func(t *testing.T) {
+		cfg := createWorkspace(t)
+		cfg.Wasm = &bazelmake.WasmLinkConfig{Imports: imports}
+		project := newProject(t, cfg)
+		artifact := project.Artifacts[0]
+		stubs := artifact.Stubs()
+		if stubs == nil || stubs.Source != "out/example.stubs.c" {
+			t.Fatalf("unexpected stubs: %+v", stubs)
+		}
+		inputs := artifact.LinkInputs()
+		if inputs[len(inputs)-1] != stubs.Path() {
+			t.Fatalf("stubs are not linked: %v", inputs)
+		}
+		for _, obj := range artifact.ExportedObjects() {
+			if obj == stubs.Path() {
+				t.Fatal("stubs must not be searched for exports")
+			}
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package bazelmake
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Errors   int               `xml:"errors,attr"`
+	Time     string            `xml:"time,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Cases    []*junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// WriteJUnitReport writes the results as a JUnit XML report.
+// Every test is a testsuite named by its label and every shard is a testcase of it.
+// Timeouts are reported as failures and the shards which could not run as errors.
+func WriteJUnitReport(w io.Writer, results []*TestResult) error {
+	report := &junitTestSuites{}
+	var total time.Duration
+	for _, result := range results {
+		suite := &junitTestSuite{
+			Name: result.Test.FQDN(),
+			Time: junitTime(result.Duration()),
+		}
+		for _, shard := range result.Shards {
+			testCase := &junitTestCase{
+				Name:      fmt.Sprintf("%s (shard %d of %d)", result.Test.Name, shard.Index+1, shard.Total),
+				ClassName: result.Test.FQDN(),
+				Time:      junitTime(shard.Duration),
+				SystemOut: string(shard.Output),
+			}
+			if shard.Total <= 1 {
+				testCase.Name = result.Test.Name
+			}
+			switch shard.Status {
+			case TestFailed, TestTimeout:
+				testCase.Failure = &junitFailure{Message: shard.Message, Type: string(shard.Status)}
+				suite.Failures++
+			case TestError:
+				testCase.Error = &junitFailure{Message: shard.Message, Type: string(shard.Status)}
+				suite.Errors++
+			}
+			suite.Tests++
+			suite.Cases = append(suite.Cases, testCase)
+		}
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		total += result.Duration()
+		report.Suites = append(report.Suites, suite)
+	}
+	report.Time = junitTime(total)
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
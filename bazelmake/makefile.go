@@ -4,74 +4,59 @@ import (
 	"bytes"
 	_ "embed"
 	"path/filepath"
-	"sort"
-	"strings"
 
 	"text/template"
 )
 
 type Makefile struct {
 	Root            string
-	Output          string
+	Directories     []string
 	Compiler        string
-	ExtSources      []string
 	IncludePaths    []string
 	CompilerOptions []string
-	LinkerOptions   []string
-	TargetLibs      []*CCLibrary
-
-	cachedLibraries map[string]struct{}
+	// CCompiler and CCompilerOptions are used for the C sources.
+	CCompiler        string
+	CCompilerOptions []string
+	LinkerOptions    []string
+	Objects          []*Object
+	// Archiver is empty unless archives or static libraries are created.
+	Archiver  string
+	Archives  []*Archive
+	Artifacts []*Artifact
 }
 
 type NameAndPath struct {
 	Name string
 	Path string
+	// Object is the path of the object file.
+	Object string
+	// Depfile is the path of the depfile written with the object file.
+	Depfile string
+	// Options are the compiler options of the library or the artifact.
+	Options []string
+	// Headers are the declared headers of the library, used as prerequisites in case the compiler writes no depfile.
+	Headers []string
+	// IsC is true if the source is compiled with the C compiler.
+	IsC bool
 }
 
 func (m *Makefile) Sources() []*NameAndPath {
-	var ret []*NameAndPath
-	for _, src := range m.ExtSources {
-		name := strings.ReplaceAll(strings.TrimSuffix(src, filepath.Ext(src)), "/", "_")
+	ret := make([]*NameAndPath, 0, len(m.Objects))
+	for _, obj := range m.Objects {
+		var headers []string
+		if obj.Library != nil {
+			headers = obj.Library.DeclaredHeaderPaths(m.Root)
+		}
 		ret = append(ret, &NameAndPath{
-			Name: name,
-			Path: src,
+			Name:    obj.Name,
+			Path:    obj.Source,
+			Object:  obj.Path(),
+			Depfile: obj.DepfilePath(),
+			Options: obj.Options(),
+			Headers: headers,
+			IsC:     obj.IsC(),
 		})
 	}
-	for _, lib := range m.TargetLibs {
-		fqdn := lib.FQDN()
-		if _, exists := m.cachedLibraries[fqdn]; exists {
-			continue
-		}
-		m.cachedLibraries[fqdn] = struct{}{}
-		for _, src := range lib.SourcePaths(m.Root) {
-			name := strings.ReplaceAll(strings.TrimSuffix(src, filepath.Ext(src)), "/", "_")
-			ret = append(ret, &NameAndPath{
-				Name: name,
-				Path: src,
-			})
-		}
-		ret = append(ret, m.dependencies(lib)...)
-	}
-	return ret
-}
-
-func (m *Makefile) dependencies(lib *CCLibrary) []*NameAndPath {
-	var ret []*NameAndPath
-	for _, dep := range lib.ResolvedDependencies {
-		fqdn := dep.FQDN()
-		if _, exists := m.cachedLibraries[fqdn]; exists {
-			continue
-		}
-		m.cachedLibraries[fqdn] = struct{}{}
-		for _, src := range dep.SourcePaths(m.Root) {
-			name := strings.ReplaceAll(strings.TrimSuffix(src, filepath.Ext(src)), "/", "_")
-			ret = append(ret, &NameAndPath{
-				Name: name,
-				Path: src,
-			})
-		}
-		ret = append(ret, m.dependencies(dep)...)
-	}
 	return ret
 }
 
@@ -79,39 +64,37 @@ func (m *Makefile) dependencies(lib *CCLibrary) []*NameAndPath {
 var makefileData []byte
 
 func CreateMakefile(cfg *Config) ([]byte, error) {
-	targetLibs, err := NewResolver(cfg).Resolve()
+	project, err := NewProject(cfg)
 	if err != nil {
 		return nil, err
 	}
-
-	includePathMap := make(map[string]struct{})
-	for _, lib := range cfg.Libraries {
-		includePathMap[filepath.Join(cfg.Root, filepath.Dir(lib.Root))] = struct{}{}
-		includePathMap[filepath.Join(cfg.Root, lib.Root)] = struct{}{}
-	}
-	includePaths := make([]string, 0, len(includePathMap))
-	for includePath := range includePathMap {
-		includePaths = append(includePaths, includePath)
-	}
-	for _, includePath := range cfg.IncludePaths {
-		includePaths = append(includePaths, filepath.Join(cfg.Root, includePath))
-	}
-	sort.Strings(includePaths)
-	tmpl, err := template.New("").Parse(string(makefileData))
+	tmpl, err := template.New("").Funcs(template.FuncMap{
+		"dir": filepath.Dir,
+		"command": func(args []string) string {
+			return makeEscape(shellCommand(args))
+		},
+	}).Parse(string(makefileData))
 	if err != nil {
 		return nil, err
 	}
 	var buf bytes.Buffer
+	var archiver string
+	if project.UsesArchiver() {
+		archiver = project.Archiver()
+	}
 	if err := tmpl.Execute(&buf, &Makefile{
-		Root:            cfg.Root,
-		Output:          cfg.Output,
-		Compiler:        cfg.Compiler,
-		IncludePaths:    includePaths,
-		ExtSources:      cfg.Sources,
-		CompilerOptions: cfg.CompilerOptions,
-		LinkerOptions:   cfg.LinkerOptions,
-		TargetLibs:      targetLibs,
-		cachedLibraries: make(map[string]struct{}),
+		Root:             cfg.Root,
+		Directories:      project.Directories(),
+		Compiler:         cfg.Compiler,
+		IncludePaths:     project.IncludePaths,
+		CompilerOptions:  cfg.CompilerOptions,
+		CCompiler:        project.CCompiler(),
+		CCompilerOptions: project.CCompilerOptions(),
+		LinkerOptions:    cfg.LinkerOptions,
+		Objects:          project.Objects,
+		Archiver:         archiver,
+		Archives:         project.Archives,
+		Artifacts:        project.Artifacts,
 	}); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,73 @@
+package bazelmake_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+func TestCreateMakefile(t *testing.T) {
+	cfg := createWorkspace(t, map[string]string{"a/lib/lib.h": ""})
+	cfg.OutputDir = "build/out"
+	makefile, err := bazelmake.CreateMakefile(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(makefile)
+	for _, expected := range []string{
+		"DEPFLAGS ?= -MMD -MP\n",
+		"build: build/out/example\n",
+		"DEPFILES := build/out/a/lib/_objs/lib/lib.d build/out/a/lib/_objs/util/util.d",
+		"build/out/a/lib/_objs/lib/lib.o: " + cfg.Root + "/a/lib/lib.cc " + cfg.Root + "/a/lib/lib.h | build/out/a/lib/_objs/lib\n",
+		"build/out/a/lib/_objs/util/util.o: " + cfg.Root + "/a/lib/util.cc | build/out/a/lib/_objs/util\n",
+		"build/out/b/base/_objs/base/base.o: ",
+		"build/out/a/lib/_objs/lib:\n\tmkdir -p $@\n",
+		"$(DEPFLAGS) -c " + cfg.Root + "/a/lib/lib.cc\n",
+		"-include $(DEPFILES)\n",
+	} {
+		if !strings.Contains(content, expected) {
+			t.Fatalf("failed to find %q in Makefile:\n%s", expected, content)
+		}
+	}
+	t.Run("c compiler", func(t *testing.T) {
+		for _, test := range []struct {
+			name      string
+			cCompiler string
+			expected  []string
+		}{
+			{
+				name:      "configured",
+				cCompiler: "clang",
+				expected:  []string{"CXX := clang++\nCXXFLAGS := -O2\nCC := clang\nCFLAGS := -std=c11\n"},
+			},
+			{
+				name:     "fallback",
+				expected: []string{"CXX := clang++\nCXXFLAGS := -O2\nCC := clang++\nCFLAGS := -O2\n"},
+			},
+		} {
+			t.Run(test.name, func(t *testing.T) {
+				cfg := createCWorkspace(t)
+				cfg.OutputDir = "build/out"
+				cfg.CompilerOptions = []string{"-O2"}
+				cfg.CCompiler = test.cCompiler
+				if test.cCompiler != "" {
+					cfg.CCompilerOptions = []string{"-std=c11"}
+				}
+				makefile, err := bazelmake.CreateMakefile(cfg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				content := string(makefile)
+				for _, expected := range append(test.expected,
+					"\t$(CC) -o build/out/a/c/_objs/c/c.o $(CFLAGS) $(INCLUDES)",
+					"\t$(CXX) -o build/out/b/base/_objs/base/base.o $(CXXFLAGS) $(INCLUDES)",
+				) {
+					if !strings.Contains(content, expected) {
+						t.Fatalf("failed to find %q in Makefile:\n%s", expected, content)
+					}
+				}
+			})
+		}
+	})
+}
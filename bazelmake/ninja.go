@@ -0,0 +1,94 @@
+package bazelmake
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+type NinjaFile struct {
+	*Project
+	// RegenerateCommand regenerates build.ninja when the config or a BUILD file changes.
+	// The regeneration edge is omitted if it is empty.
+	RegenerateCommand string
+}
+
+//go:embed templates/build.ninja.tmpl
+var ninjaFileData []byte
+
+var ninjaFuncs = template.FuncMap{
+	"path":    ninjaPath,
+	"value":   ninjaValue,
+	"command": shellCommand,
+}
+
+// ninjaPath escapes a path in build statements.
+func ninjaPath(s string) string {
+	return strings.NewReplacer("$", "$$", " ", "$ ", ":", "$:", "\n", "$\n").Replace(s)
+}
+
+// ninjaValue escapes a variable value.
+func ninjaValue(s string) string {
+	return strings.NewReplacer("$", "$$", "\n", "$\n").Replace(s)
+}
+
+// ExportsArtifacts returns the artifacts whose exports are generated from the export patterns.
+func (n *NinjaFile) ExportsArtifacts() []*Artifact {
+	var ret []*Artifact
+	for _, artifact := range n.Artifacts {
+		if artifact.ExportsPath() != "" {
+			ret = append(ret, artifact)
+		}
+	}
+	return ret
+}
+
+// PostLinkArtifacts returns the artifacts processed by the post-link steps.
+func (n *NinjaFile) PostLinkArtifacts() []*Artifact {
+	var ret []*Artifact
+	for _, artifact := range n.Artifacts {
+		if artifact.PostLink() != nil {
+			ret = append(ret, artifact)
+		}
+	}
+	return ret
+}
+
+// StubsArtifacts returns the artifacts whose imports are stubbed.
+func (n *NinjaFile) StubsArtifacts() []*Artifact {
+	var ret []*Artifact
+	for _, artifact := range n.Artifacts {
+		if artifact.Stubs() != nil {
+			ret = append(ret, artifact)
+		}
+	}
+	return ret
+}
+
+func CreateNinjaFile(cfg *Config) ([]byte, error) {
+	project, err := NewProject(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var regenerate string
+	if cfg.Path() != "" {
+		regenerate = fmt.Sprintf("bazel2makefile --config %s --format ninja", cfg.Path())
+		if cfg.Profile() != "" {
+			regenerate += " --profile " + cfg.Profile()
+		}
+	}
+	tmpl, err := template.New("").Funcs(ninjaFuncs).Parse(string(ninjaFileData))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, &NinjaFile{
+		Project:           project,
+		RegenerateCommand: regenerate,
+	}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
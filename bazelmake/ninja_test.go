@@ -0,0 +1,103 @@
+package bazelmake_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+// createCWorkspace builds @a//c:c instead of @a//lib:lib. It compiles a C source with copts and depends on @a//lib:lib.
+func createCWorkspace(t *testing.T) *bazelmake.Config {
+	t.Helper()
+	cfg := createWorkspace(t, map[string]string{
+		"a/c/BUILD": `
+cc_library(
+    name = "c",
+    srcs = ["c.c"],
+    copts = [
+        "-DC",
+        "$(STACK_FRAME_UNLIMITED)",
+    ],
+    deps = ["//lib"],
+)
+`,
+	})
+	cfg.Targets = []*bazelmake.BuildTargetLibraryConfig{{Library: "a", Path: "c", Name: "c"}}
+	return cfg
+}
+
+func TestCreateNinjaFile(t *testing.T) {
+	cfg := createCWorkspace(t)
+	cfg.Compiler = "/opt/llvm$1/bin/clang++"
+	cfg.CCompiler = "clang"
+	cfg.CCompilerOptions = []string{"-std=c11"}
+	ninjaFile, err := bazelmake.CreateNinjaFile(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(ninjaFile)
+	root := ninjaEscape(cfg.Root)
+	for _, expected := range []string{
+		"cxx = /opt/llvm$$1/bin/clang++\n",
+		"cc = clang\n",
+		"cflags = -std=c11\n",
+		"  deps = gcc\n",
+		": cc " + root + "/a/c/c.c\n  dep = out/a/c/_objs/c/c.d\n  copts = -DC\n",
+		": cxx " + root + "/a/lib/util.cc\n",
+		"default out/example\n",
+	} {
+		if !strings.Contains(content, expected) {
+			t.Fatalf("failed to find %q in build.ninja:\n%s", expected, content)
+		}
+	}
+	if strings.Contains(content, "STACK_FRAME_UNLIMITED") {
+		t.Fatal("copts referencing make variables must be dropped")
+	}
+	if strings.Contains(content, "rule regenerate") {
+		t.Fatal("regeneration edge requires the config path")
+	}
+	t.Run("regenerate", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		content := "root: " + cfg.Root + `
+targets:
+  - library: a
+    path: c
+    name: c
+libraries:
+  - name: a
+    root: a
+  - name: b
+    root: b
+output: example
+compiler: clang++
+`
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := bazelmake.LoadConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ninjaFile, err := bazelmake.CreateNinjaFile(loaded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "rule regenerate\n" +
+			"  command = bazel2makefile --config " + path + " --format ninja\n" +
+			"  description = REGENERATE $out\n" +
+			"  generator = 1\n" +
+			"  restat = 1\n\n" +
+			"build build.ninja: regenerate " + ninjaEscape(path) + " " + root + "/a/c/BUILD " + root + "/a/lib/BUILD " + root + "/b/base/BUILD\n" +
+			"  pool = console\n"
+		if !strings.Contains(string(ninjaFile), expected) {
+			t.Fatalf("failed to find %q in build.ninja:\n%s", expected, ninjaFile)
+		}
+	})
+}
+
+func ninjaEscape(s string) string {
+	return strings.NewReplacer("$", "$$", " ", "$ ", ":", "$:").Replace(s)
+}
@@ -0,0 +1,218 @@
+package bazelmake
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/goccy/go-wasmbind-tools/wasm"
+)
+
+// PostLinkConfig processes a linked wasm module with binaryen.
+// The module is linked to LinkedPath of the artifact, and the processed module is written to Path.
+// The steps run in the order of metadce, wasm-opt, stripping and validation.
+type PostLinkConfig struct {
+	// WasmOpt and WasmMetaDCE are the commands of binaryen. They default to wasm-opt and wasm-metadce.
+	WasmOpt     string `yaml:"wasm_opt"`
+	WasmMetaDCE string `yaml:"wasm_metadce"`
+	// Passes are the options of wasm-opt like -O3 or --enable-bulk-memory. wasm-opt runs only if they are specified.
+	Passes []string `yaml:"passes"`
+	// MetaDCE removes the exports outside the export list of the artifact and the code reached only from them.
+	// The memory and the entry points are always kept.
+	MetaDCE bool `yaml:"metadce"`
+	// Strip removes the custom sections except KeepSections like name.
+	Strip        bool     `yaml:"strip"`
+	KeepSections []string `yaml:"keep_sections"`
+	// Validate decodes the module and validates it with wasm-opt.
+	Validate bool `yaml:"validate"`
+}
+
+func (c *PostLinkConfig) validate() error {
+	if len(c.KeepSections) != 0 && !c.Strip {
+		return fmt.Errorf("post_link.keep_sections requires strip")
+	}
+	return nil
+}
+
+func (c *PostLinkConfig) wasmOpt() string {
+	if c.WasmOpt == "" {
+		return "wasm-opt"
+	}
+	return c.WasmOpt
+}
+
+func (c *PostLinkConfig) wasmMetaDCE() string {
+	if c.WasmMetaDCE == "" {
+		return "wasm-metadce"
+	}
+	return c.WasmMetaDCE
+}
+
+// keepsNames reports whether the name section survives the pipeline. binaryen drops it without -g.
+func (c *PostLinkConfig) keepsNames() bool {
+	if !c.Strip {
+		return true
+	}
+	for _, name := range c.KeepSections {
+		if name == "name" {
+			return true
+		}
+	}
+	return false
+}
+
+// postLinkEntries are the exports kept by metadce regardless of the export list.
+var postLinkEntries = []string{"memory", "_start", "_initialize"}
+
+// PostLink runs the steps of cfg on the module at input and writes the result to output.
+// exports is the export list kept by metadce.
+func PostLink(input, output string, cfg *PostLinkConfig, exports []string) error {
+	current := input
+	tmp := output + ".tmp"
+	defer os.Remove(tmp)
+	defer os.Remove(output + ".graph.json")
+	if cfg.MetaDCE {
+		graph, err := metaDCEGraph(input, exports)
+		if err != nil {
+			return err
+		}
+		graphPath := output + ".graph.json"
+		if err := os.WriteFile(graphPath, graph, 0o600); err != nil {
+			return err
+		}
+		args := []string{current, "--graph-file", graphPath, "-o", tmp}
+		if cfg.keepsNames() {
+			args = append(args, "-g")
+		}
+		if err := runTool(cfg.wasmMetaDCE(), args); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, output); err != nil {
+			return err
+		}
+		current = output
+	}
+	if len(cfg.Passes) != 0 {
+		args := append([]string{current, "-o", tmp}, cfg.Passes...)
+		if cfg.keepsNames() {
+			args = append(args, "-g")
+		}
+		if err := runTool(cfg.wasmOpt(), args); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, output); err != nil {
+			return err
+		}
+		current = output
+	}
+	b, err := os.ReadFile(current)
+	if err != nil {
+		return err
+	}
+	if cfg.Strip {
+		keep := make(map[string]struct{})
+		for _, name := range cfg.KeepSections {
+			keep[name] = struct{}{}
+		}
+		b, err = wasm.StripCustomSections(b, func(name string) bool {
+			_, exists := keep[name]
+			return exists
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", current, err)
+		}
+	}
+	if current != output || cfg.Strip {
+		if err := writeFile(output, b); err != nil {
+			return err
+		}
+	}
+	if cfg.Validate {
+		if _, err := wasm.Decode(b); err != nil {
+			return fmt.Errorf("%s: %w", output, err)
+		}
+		// wasm-opt validates the input without passes and output.
+		if err := runTool(cfg.wasmOpt(), []string{output}); err != nil {
+			return fmt.Errorf("%s is invalid: %w", output, err)
+		}
+	}
+	return nil
+}
+
+// metaDCEGraph returns the graph of wasm-metadce whose roots are the exports of the module in exports.
+func metaDCEGraph(path string, exports []string) ([]byte, error) {
+	m, err := wasm.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keep := make(map[string]struct{})
+	for _, name := range append(exports, postLinkEntries...) {
+		keep[name] = struct{}{}
+	}
+	type node struct {
+		Name   string `json:"name"`
+		Root   bool   `json:"root,omitempty"`
+		Export string `json:"export"`
+	}
+	nodes := []*node{}
+	for _, exp := range m.Exports {
+		if _, exists := keep[exp.Name]; exists {
+			nodes = append(nodes, &node{Name: "export:" + exp.Name, Root: true, Export: exp.Name})
+		}
+	}
+	return json.Marshal(nodes)
+}
+
+func runTool(name string, args []string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", shellCommand(append([]string{name}, args...)), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// ReadExportList returns the symbols of a file listing them one per line or a response file of -Wl,--export= options.
+func ReadExportList(path string) ([]string, error) {
+	lines, err := readSymbolList(path)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]string, 0, len(lines))
+	for _, line := range lines {
+		ret = append(ret, strings.TrimPrefix(line, "-Wl,--export="))
+	}
+	return ret, nil
+}
+
+// PostLinkArguments returns the options of the postlink command running cfg.
+func PostLinkArguments(cfg *PostLinkConfig) []string {
+	var ret []string
+	if cfg.WasmOpt != "" {
+		ret = append(ret, "--wasm-opt", cfg.WasmOpt)
+	}
+	if cfg.WasmMetaDCE != "" {
+		ret = append(ret, "--wasm-metadce", cfg.WasmMetaDCE)
+	}
+	for _, pass := range cfg.Passes {
+		// passes start with - and must be joined to the option.
+		ret = append(ret, "--pass="+pass)
+	}
+	if cfg.MetaDCE {
+		ret = append(ret, "--metadce")
+	}
+	if cfg.Strip {
+		ret = append(ret, "--strip")
+	}
+	for _, name := range cfg.KeepSections {
+		ret = append(ret, "--keep-section", name)
+	}
+	if cfg.Validate {
+		ret = append(ret, "--validate")
+	}
+	return ret
+}
@@ -0,0 +1,108 @@
+package bazelmake_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+// fakeBinaryen copies the input module to -o and the graph of metadce next to the output.
+// It only validates the input without -o.
+const fakeBinaryen = `#!/bin/sh
+in="$1"; shift; out=""
+while [ $# -gt 0 ]; do
+  case "$1" in
+    -o) out="$2"; shift;;
+    --graph-file) cp "$2" "$(dirname "$in")/graph.json"; shift;;
+  esac
+  shift
+done
+[ -n "$out" ] && cp "$in" "$out"
+exit 0
+`
+
+func TestPostLink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake binaryen requires sh")
+	}
+	dir := t.TempDir()
+	tool := filepath.Join(dir, "binaryen.sh")
+	if err := os.WriteFile(tool, []byte(fakeBinaryen), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	module = append(module, wasmSection(7, 2, 3, 'r', 'u', 'n', 0x00, 0, 4, 'h', 'e', 'l', 'p', 0x00, 1)...)
+	module = append(module, wasmSection(0, 4, 'n', 'a', 'm', 'e', 1, 1, 0)...)
+	module = append(module, wasmSection(0, 9, 'p', 'r', 'o', 'd', 'u', 'c', 'e', 'r', 's', 0)...)
+	input := filepath.Join(dir, "app.linked")
+	if err := os.WriteFile(input, module, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "app")
+	cfg := &bazelmake.PostLinkConfig{
+		WasmOpt:      tool,
+		WasmMetaDCE:  tool,
+		Passes:       []string{"-O3"},
+		MetaDCE:      true,
+		Strip:        true,
+		KeepSections: []string{"name"},
+		Validate:     true,
+	}
+	if err := bazelmake.PostLink(input, output, cfg, []string{"run"}); err != nil {
+		t.Fatal(err)
+	}
+	graph, err := os.ReadFile(filepath.Join(dir, "graph.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(graph) != `[{"name":"export:run","root":true,"export":"run"}]` {
+		t.Fatalf("unexpected graph: %s", graph)
+	}
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(module)-13 {
+		t.Fatalf("producers section is not stripped: %d bytes", len(got))
+	}
+	args := bazelmake.PostLinkArguments(cfg)
+	if joined := strings.Join(args[4:], " "); joined != "--pass=-O3 --metadce --strip --keep-section name --validate" {
+		t.Fatalf("unexpected arguments: %s", joined)
+	}
+	t.Run("profile", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		content := `output: app
+wasm:
+  post_link:
+    strip: true
+profiles:
+  debug:
+    post_link:
+      strip: true
+      keep_sections: [name]
+`
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := bazelmake.LoadConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		debug, err := loaded.WithProfile("debug")
+		if err != nil {
+			t.Fatal(err)
+		}
+		project := newProject(t, debug)
+		artifact := project.Artifacts[0]
+		if got := artifact.PostLink().KeepSections; len(got) != 1 || got[0] != "name" {
+			t.Fatalf("unexpected post-link config: %+v", artifact.PostLink())
+		}
+		if artifact.LinkedPath() != artifact.Path()+".linked" {
+			t.Fatalf("unexpected linked path: %s", artifact.LinkedPath())
+		}
+	})
+}
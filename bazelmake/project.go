@@ -0,0 +1,451 @@
+package bazelmake
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Project is the resolved build shared by every output format.
+type Project struct {
+	Config       *Config
+	IncludePaths []string
+	// Targets are the libraries specified by Config.Targets and the artifacts.
+	Targets []*CCLibrary
+	// Libraries are the transitive closure of Targets in the order their sources are compiled.
+	Libraries []*CCLibrary
+	// Objects are the object files to compile. Config.Sources and the sources of the artifacts come first.
+	// The objects of a library are shared by the artifacts depending on it.
+	Objects []*Object
+	// BuildFiles are the BUILD files read to resolve the libraries.
+	BuildFiles []string
+	// Archives are the static archives of Libraries with sources in link order, dependents first.
+	// They are created only in LinkArchives mode.
+	Archives []*Archive
+	// Artifacts are the outputs of Config.ArtifactConfigs.
+	Artifacts []*Artifact
+
+	allowLinkOptions []*regexp.Regexp
+	denyLinkOptions  []*regexp.Regexp
+	compats          map[*CCLibrary]*compat
+}
+
+// Archive is the static archive of a library.
+type Archive struct {
+	Library *CCLibrary
+	Objects []*Object
+
+	dir string
+}
+
+// Path returns the path of the archive in the package directory of the library as Bazel does.
+func (a *Archive) Path() string {
+	return filepath.Join(a.dir, a.Library.File.Library.Name, a.Library.File.Path, "lib"+a.Library.Name+".a")
+}
+
+// CCompiler returns the compiler for C sources. It falls back to Config.Compiler and its options.
+func (p *Project) CCompiler() string {
+	if p.Config.CCompiler == "" {
+		return p.Config.Compiler
+	}
+	return p.Config.CCompiler
+}
+
+func (p *Project) CCompilerOptions() []string {
+	if p.Config.CCompiler == "" {
+		return p.Config.CompilerOptions
+	}
+	return p.Config.CCompilerOptions
+}
+
+// CompileArguments returns the command line compiling obj.
+func (p *Project) CompileArguments(obj *Object) []string {
+	compiler := p.Config.Compiler
+	options := p.Config.CompilerOptions
+	if obj.IsC() {
+		compiler = p.CCompiler()
+		options = p.CCompilerOptions()
+	}
+	args := []string{compiler}
+	args = append(args, options...)
+	for _, includePath := range p.IncludePaths {
+		args = append(args, "-I"+includePath)
+	}
+	args = append(args, obj.Options()...)
+	return append(args, "-c", obj.Source, "-o", obj.Path())
+}
+
+// Directories returns the directories of the objects, the archives and the artifacts.
+func (p *Project) Directories() []string {
+	dirMap := make(map[string]struct{})
+	for _, obj := range p.Objects {
+		dirMap[filepath.Dir(obj.Path())] = struct{}{}
+	}
+	for _, archive := range p.Archives {
+		dirMap[filepath.Dir(archive.Path())] = struct{}{}
+	}
+	for _, artifact := range p.Artifacts {
+		dirMap[filepath.Dir(artifact.Path())] = struct{}{}
+	}
+	dirs := make([]string, 0, len(dirMap))
+	for dir := range dirMap {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// Archiver returns the archiver creating Archives.
+func (p *Project) Archiver() string {
+	if p.Config.Archiver == "" {
+		return "ar"
+	}
+	return p.Config.Archiver
+}
+
+// UsesArchiver reports whether Archiver creates Archives or a static library artifact.
+func (p *Project) UsesArchiver() bool {
+	if len(p.Archives) != 0 {
+		return true
+	}
+	for _, artifact := range p.Artifacts {
+		if artifact.IsStaticLibrary() {
+			return true
+		}
+	}
+	return false
+}
+
+// ArchiveArguments returns the command line creating archive. The archive must be removed before running it.
+func (p *Project) ArchiveArguments(archive *Archive) []string {
+	args := []string{p.Archiver(), "rcs", archive.Path()}
+	for _, obj := range archive.Objects {
+		args = append(args, obj.Path())
+	}
+	return args
+}
+
+// LibraryLinkOptions returns the linkopts of lib filtered by Config.LinkOptions.
+func (p *Project) LibraryLinkOptions(lib *CCLibrary) []string {
+	var ret []string
+	for _, opt := range lib.LinkOptions {
+		if p.isAllowedLinkOption(opt) {
+			ret = append(ret, opt)
+		}
+	}
+	return ret
+}
+
+func (p *Project) isAllowedLinkOption(opt string) bool {
+	// like copts, make variables cannot be expanded outside Bazel.
+	if strings.Contains(opt, "$(") {
+		return false
+	}
+	for _, deny := range p.denyLinkOptions {
+		if deny.MatchString(opt) {
+			return false
+		}
+	}
+	if len(p.allowLinkOptions) == 0 {
+		return true
+	}
+	for _, allow := range p.allowLinkOptions {
+		if allow.MatchString(opt) {
+			return true
+		}
+	}
+	return false
+}
+
+type Object struct {
+	// Name is the path of the object file relative to the output directory without the extension.
+	// The objects of a library are placed in <repository>/<package>/_objs/<name>/ as Bazel does.
+	Name   string
+	Source string
+	// Library is nil for Config.Sources and the sources of artifacts.
+	Library *CCLibrary
+	// Artifact is not nil for the sources of an artifact.
+	Artifact *Artifact
+
+	dir string
+	// libraryOptions are the preprocessor options of the library.
+	libraryOptions []string
+	// compatOptions are the options of the compat rules matching the library.
+	compatOptions []string
+	// exceptionOptions select the exception model and RTTI. They come last to override the other options.
+	exceptionOptions []string
+}
+
+// Path returns the path of the object file.
+func (o *Object) Path() string {
+	return filepath.Join(o.dir, o.Name+".o")
+}
+
+// DepfilePath returns the path of the depfile listing the headers of the object.
+// Every backend names it as -MD does without -MF.
+func (o *Object) DepfilePath() string {
+	return filepath.Join(o.dir, o.Name+".d")
+}
+
+// IsC reports whether the source is written in C.
+func (o *Object) IsC() bool {
+	return isCSource(o.Source)
+}
+
+func isCSource(src string) bool {
+	return filepath.Ext(src) == ".c"
+}
+
+// IsStubs reports whether the source is generated by the stubs command of the artifact.
+func (o *Object) IsStubs() bool {
+	return o.Artifact != nil && o.Artifact.stubs == o
+}
+
+// Options returns the includes, defines and copts of the library or the compiler options of the artifact the object belongs to.
+func (o *Object) Options() []string {
+	if o.IsStubs() {
+		return nil
+	}
+	if o.Artifact != nil {
+		return append(append([]string{}, o.Artifact.Config.CompilerOptions...), o.exceptionOptions...)
+	}
+	if o.Library == nil {
+		return o.exceptionOptions
+	}
+	ret := append(append([]string{}, o.libraryOptions...), o.Library.CompilerOptions()...)
+	return append(append(ret, o.compatOptions...), o.exceptionOptions...)
+}
+
+func NewProject(cfg *Config) (*Project, error) {
+	resolver := NewResolver(cfg)
+	targetLibs, err := resolver.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	project := &Project{
+		Config:       cfg,
+		IncludePaths: includePaths(cfg),
+		Targets:      targetLibs,
+		BuildFiles:   resolver.BuildFiles(),
+		compats:      make(map[*CCLibrary]*compat),
+	}
+	exceptions := cfg.exceptionSettingOf(nil)
+	for _, src := range cfg.Sources {
+		project.Objects = append(project.Objects, &Object{
+			Name:             objectName(src),
+			Source:           src,
+			dir:              cfg.OutputDirectory(),
+			exceptionOptions: exceptions.compilerOptions(isCSource(src)),
+		})
+	}
+	for _, artifactCfg := range cfg.ArtifactConfigs() {
+		artifact := &Artifact{Config: artifactCfg, project: project}
+		for _, target := range append(append([]*BuildTargetLibraryConfig{}, cfg.Targets...), artifactCfg.Targets...) {
+			lib, err := resolver.LookupTarget(target)
+			if err != nil {
+				return nil, err
+			}
+			if lib != nil {
+				artifact.Targets = append(artifact.Targets, lib)
+			}
+		}
+		exceptions := cfg.artifactExceptionSetting(artifactCfg)
+		for _, src := range artifactCfg.Sources {
+			artifact.sources = append(artifact.sources, &Object{
+				Name:             filepath.Join("_objs", artifactCfg.Name, objectName(src)),
+				Source:           src,
+				Artifact:         artifact,
+				dir:              cfg.OutputDirectory(),
+				exceptionOptions: exceptions.compilerOptions(isCSource(src)),
+			})
+		}
+		project.Objects = append(project.Objects, artifact.sources...)
+		if wasm := artifact.wasmConfig(); wasm != nil && !artifact.IsStaticLibrary() && stubbed(wasm.Imports) {
+			// the stubs are generated from the other objects of the artifact, so they are not in artifact.Objects.
+			artifact.stubs = &Object{
+				Name:     filepath.Join("_objs", artifactCfg.Name, "_stubs"),
+				Source:   artifact.Path() + ".stubs.c",
+				Artifact: artifact,
+				dir:      cfg.OutputDirectory(),
+			}
+			project.Objects = append(project.Objects, artifact.stubs)
+		}
+		project.Artifacts = append(project.Artifacts, artifact)
+	}
+	visited := make(map[string]struct{})
+	for _, lib := range targetLibs {
+		project.addLibrary(lib, visited)
+	}
+	objectToSource := make(map[string]string)
+	for _, obj := range project.Objects {
+		if src, exists := objectToSource[obj.Path()]; exists {
+			return nil, fmt.Errorf("both %s and %s are compiled to %s", src, obj.Source, obj.Path())
+		}
+		objectToSource[obj.Path()] = obj.Source
+	}
+	if cfg.LinkMode == LinkArchives {
+		project.Archives = project.archives()
+	}
+	if cfg.LinkOptions != nil {
+		for _, pattern := range cfg.LinkOptions.Allow {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compile allowed linkopts pattern: %w", err)
+			}
+			project.allowLinkOptions = append(project.allowLinkOptions, re)
+		}
+		for _, pattern := range cfg.LinkOptions.Deny {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compile denied linkopts pattern: %w", err)
+			}
+			project.denyLinkOptions = append(project.denyLinkOptions, re)
+		}
+	}
+	for _, artifact := range project.Artifacts {
+		if err := artifact.init(); err != nil {
+			return nil, err
+		}
+	}
+	if err := project.checkExceptions(); err != nil {
+		return nil, err
+	}
+	if err := project.checkThreads(); err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+func (p *Project) addLibrary(lib *CCLibrary, visited map[string]struct{}) {
+	fqdn := lib.FQDN()
+	if _, exists := visited[fqdn]; exists {
+		return
+	}
+	visited[fqdn] = struct{}{}
+	p.Libraries = append(p.Libraries, lib)
+	objsDir := filepath.Join(lib.File.Library.Name, lib.File.Path, "_objs", lib.Name)
+	compat := p.Config.compatOf(lib)
+	exceptions := p.Config.exceptionSettingOf(lib)
+	libraryOptions := lib.PreprocessorOptions(p.Config.Root)
+	var compatOptions []string
+	if compat != nil {
+		p.compats[lib] = compat
+		compatOptions = compat.options
+	}
+	for i, src := range lib.SourcePaths(p.Config.Root) {
+		if compat != nil {
+			if replacement, exists := compat.sources[lib.Sources[i]]; exists {
+				if replacement == "" {
+					continue
+				}
+				// the replacement keeps the object name of the source so that it stays in the archive of the library.
+				src = replacement
+			}
+		}
+		p.Objects = append(p.Objects, &Object{
+			Name:             filepath.Join(objsDir, strings.TrimSuffix(lib.Sources[i], filepath.Ext(lib.Sources[i]))),
+			Source:           src,
+			Library:          lib,
+			dir:              p.Config.OutputDirectory(),
+			libraryOptions:   libraryOptions,
+			compatOptions:    compatOptions,
+			exceptionOptions: exceptions.compilerOptions(isCSource(src)),
+		})
+	}
+	if compat != nil {
+		for _, src := range compat.addSources {
+			p.Objects = append(p.Objects, &Object{
+				Name:             filepath.Join(objsDir, "_compat", objectName(filepath.Base(src))),
+				Source:           src,
+				Library:          lib,
+				dir:              p.Config.OutputDirectory(),
+				libraryOptions:   libraryOptions,
+				compatOptions:    compatOptions,
+				exceptionOptions: exceptions.compilerOptions(isCSource(src)),
+			})
+		}
+	}
+	for _, dep := range lib.ResolvedDependencies {
+		p.addLibrary(dep, visited)
+	}
+}
+
+// linkOrder returns the closure of targets in reverse topological order: every library precedes its dependencies.
+func linkOrder(targets []*CCLibrary) []*CCLibrary {
+	visited := make(map[*CCLibrary]struct{})
+	var postorder []*CCLibrary
+	var visit func(lib *CCLibrary)
+	visit = func(lib *CCLibrary) {
+		if _, exists := visited[lib]; exists {
+			return
+		}
+		visited[lib] = struct{}{}
+		for _, dep := range lib.ResolvedDependencies {
+			visit(dep)
+		}
+		postorder = append(postorder, lib)
+	}
+	for i := len(targets) - 1; i >= 0; i-- {
+		visit(targets[i])
+	}
+	ret := make([]*CCLibrary, 0, len(postorder))
+	for i := len(postorder) - 1; i >= 0; i-- {
+		ret = append(ret, postorder[i])
+	}
+	return ret
+}
+
+// archives returns the archives of libraries with sources in link order.
+func (p *Project) archives() []*Archive {
+	objects := p.libraryObjects()
+	var ret []*Archive
+	for _, lib := range linkOrder(p.Targets) {
+		if len(objects[lib]) == 0 {
+			continue
+		}
+		ret = append(ret, &Archive{Library: lib, Objects: objects[lib], dir: p.Config.OutputDirectory()})
+	}
+	return ret
+}
+
+func (p *Project) libraryObjects() map[*CCLibrary][]*Object {
+	objects := make(map[*CCLibrary][]*Object)
+	for _, obj := range p.Objects {
+		if obj.Library != nil {
+			objects[obj.Library] = append(objects[obj.Library], obj)
+		}
+	}
+	return objects
+}
+
+// objectName returns the name of the object of src, which mirrors the path of src.
+// Parent directories are renamed so that the object stays in the output directory.
+func objectName(src string) string {
+	src = strings.TrimSuffix(filepath.ToSlash(filepath.Clean(src)), filepath.Ext(src))
+	parts := strings.Split(strings.TrimPrefix(src, "/"), "/")
+	for i, part := range parts {
+		if part == ".." {
+			parts[i] = "__"
+		}
+	}
+	return filepath.Join(parts...)
+}
+
+func includePaths(cfg *Config) []string {
+	includePathMap := make(map[string]struct{})
+	for _, lib := range cfg.Libraries {
+		includePathMap[filepath.Join(cfg.Root, filepath.Dir(lib.Root))] = struct{}{}
+		includePathMap[filepath.Join(cfg.Root, lib.Root)] = struct{}{}
+	}
+	includePaths := make([]string, 0, len(includePathMap))
+	for includePath := range includePathMap {
+		includePaths = append(includePaths, includePath)
+	}
+	for _, includePath := range cfg.IncludePaths {
+		includePaths = append(includePaths, filepath.Join(cfg.Root, includePath))
+	}
+	sort.Strings(includePaths)
+	return includePaths
+}
@@ -0,0 +1,156 @@
+package bazelmake_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+func TestLinkArchives(t *testing.T) {
+	cfg := createWorkspace(t, map[string]string{
+		"b/base/BUILD": `
+cc_library(
+    name = "base",
+    srcs = ["base.cc"],
+    linkopts = ["-lpthread"],
+    deps = [":log"],
+)
+
+cc_library(
+    name = "log",
+    srcs = ["log.cc"],
+    linkopts = [
+        "-ldl",
+        "-Wl,--gc-sections",
+    ],
+    alwayslink = True,
+)
+`,
+	})
+	cfg.LinkMode = bazelmake.LinkArchives
+	cfg.LinkerOptions = []string{"-lm"}
+	project := newProject(t, cfg)
+	expected := "clang++ -Ia -Ib -o out/example out/a/lib/liblib.a out/b/base/libbase.a out/a/lib/libutil.a " +
+		"-Wl,--whole-archive out/b/base/liblog.a -Wl,--no-whole-archive " +
+		"-lpthread -ldl -Wl,--gc-sections -lm"
+	got := strings.Join(project.Artifacts[0].LinkArguments(), " ")
+	got = strings.ReplaceAll(got, cfg.Root+"/", "")
+	got = strings.ReplaceAll(got, " -I"+cfg.Root, "")
+	if got != expected {
+		t.Fatalf("unexpected link arguments:\nexpected %s\ngot      %s", expected, got)
+	}
+}
+
+func TestLinkOptions(t *testing.T) {
+	cfg := createWorkspace(t, map[string]string{
+		"a/lib/BUILD": `
+cc_library(
+    name = "lib",
+    srcs = ["lib.cc"],
+    deps = [
+        ":util",
+        "@b//base",
+    ],
+)
+
+cc_library(
+    name = "util",
+    srcs = ["util.cc"],
+    linkopts = ["-lpthread"],
+    deps = ["@b//base:log"],
+)
+`,
+		"b/base/BUILD": `
+cc_library(
+    name = "base",
+    srcs = ["base.cc"],
+    linkopts = ["-lpthread"],
+    deps = [":log"],
+)
+
+cc_library(
+    name = "log",
+    srcs = ["log.cc"],
+    linkopts = [
+        "-ldl",
+        "-Wl,--gc-sections",
+    ],
+)
+`,
+	})
+	t.Run("all", func(t *testing.T) {
+		project := newProject(t, cfg)
+		if got := strings.Join(project.Artifacts[0].LinkOptions, " "); got != "-lpthread -ldl -Wl,--gc-sections" {
+			t.Fatalf("unexpected linkopts: %s", got)
+		}
+	})
+	t.Run("filter", func(t *testing.T) {
+		cfg.LinkOptions = &bazelmake.LinkOptionsConfig{
+			Allow: []string{"^-l"},
+			Deny:  []string{"^-lpthread$"},
+		}
+		project := newProject(t, cfg)
+		if got := strings.Join(project.Artifacts[0].LinkOptions, " "); got != "-ldl" {
+			t.Fatalf("unexpected linkopts: %s", got)
+		}
+	})
+	t.Run("invalid pattern", func(t *testing.T) {
+		cfg.LinkOptions = &bazelmake.LinkOptionsConfig{Deny: []string{"("}}
+		if _, err := bazelmake.NewProject(cfg); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestObjectCollision(t *testing.T) {
+	cfg := createWorkspace(t)
+	cfg.Sources = []string{"main.cc", "./main.c"}
+	_, err := bazelmake.NewProject(cfg)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "both main.cc and ./main.c are compiled to out/main.o") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestArtifacts(t *testing.T) {
+	cfg := createWorkspace(t)
+	cfg.Output = ""
+	cfg.Targets = nil
+	cfg.Artifacts = []*bazelmake.ArtifactConfig{
+		{
+			Name:    "analyzer",
+			Output:  "analyzer.wasm",
+			Kind:    bazelmake.ArtifactWasmReactor,
+			Targets: []*bazelmake.BuildTargetLibraryConfig{{Library: "a", Path: "lib", Name: "lib"}},
+			Sources: []string{"main.cc"},
+		},
+		{
+			Name:    "base",
+			Output:  "libbase.a",
+			Kind:    bazelmake.ArtifactStaticLibrary,
+			Targets: []*bazelmake.BuildTargetLibraryConfig{{Library: "b", Path: "base", Name: "base"}},
+		},
+	}
+	project := newProject(t, cfg)
+	// the objects of @b//base are shared by both artifacts.
+	if len(project.Objects) != 5 {
+		t.Fatalf("unexpected objects: %d", len(project.Objects))
+	}
+	expected := []string{
+		"clang++ -Ia -Ib -mexec-model=reactor -o out/analyzer.wasm out/_objs/analyzer/main.o " +
+			"out/a/lib/_objs/lib/lib.o out/a/lib/_objs/util/util.o out/b/base/_objs/log/log.o " +
+			"out/b/base/_objs/base/base.o",
+		"ar rcs out/libbase.a out/b/base/_objs/base/base.o out/b/base/_objs/log/log.o",
+	}
+	for i, artifact := range project.Artifacts {
+		got := strings.Join(artifact.LinkArguments(), " ")
+		got = strings.ReplaceAll(got, cfg.Root+"/", "")
+		got = strings.ReplaceAll(got, " -I"+cfg.Root, "")
+		if got != expected[i] {
+			t.Fatalf("unexpected link arguments of %s:\nexpected %s\ngot      %s", artifact.Name(), expected[i], got)
+		}
+	}
+}
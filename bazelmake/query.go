@@ -0,0 +1,635 @@
+package bazelmake
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Query evaluates a Bazel query expression against the resolved graph.
+// The supported functions are deps, rdeps, somepath, allpaths, kind, attr and filter,
+// combined with the set operators + ( union ), - ( except ) and ^ ( intersect ).
+// Target patterns are labels like @repo//path/to:name, //path/to:name, //path/to:all and //path/...
+// The result is sorted in dependency order: every library precedes its dependencies.
+func Query(cfg *Config, expr string) ([]*CCLibrary, error) {
+	node, err := parseQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	resolver := NewResolver(cfg)
+	if _, err := resolver.Resolve(); err != nil {
+		return nil, err
+	}
+	e := newQueryEvaluator(resolver)
+	set, err := e.eval(node)
+	if err != nil {
+		return nil, err
+	}
+	return e.sort(set), nil
+}
+
+type queryNode interface {
+	String() string
+}
+
+type queryWord struct {
+	value string
+}
+
+func (n *queryWord) String() string {
+	return n.value
+}
+
+type queryCall struct {
+	name string
+	args []queryNode
+}
+
+func (n *queryCall) String() string {
+	args := make([]string, 0, len(n.args))
+	for _, arg := range n.args {
+		args = append(args, arg.String())
+	}
+	return fmt.Sprintf("%s(%s)", n.name, strings.Join(args, ", "))
+}
+
+type queryBinary struct {
+	op string
+	x  queryNode
+	y  queryNode
+}
+
+func (n *queryBinary) String() string {
+	return fmt.Sprintf("(%s %s %s)", n.x, n.op, n.y)
+}
+
+type queryToken struct {
+	value  string
+	quoted bool
+}
+
+func tokenizeQuery(expr string) ([]*queryToken, error) {
+	var tokens []*queryToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == ',' || c == '+' || c == '-' || c == '^':
+			tokens = append(tokens, &queryToken{value: string(c)})
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote in query: %s", expr)
+			}
+			tokens = append(tokens, &queryToken{value: expr[i+1 : i+1+end], quoted: true})
+			i += end + 2
+		default:
+			start := i
+			for i < len(expr) && !strings.ContainsRune(" \t\r\n(),\"'", rune(expr[i])) {
+				i++
+			}
+			tokens = append(tokens, &queryToken{value: expr[start:i]})
+		}
+	}
+	return tokens, nil
+}
+
+type queryParser struct {
+	expr   string
+	tokens []*queryToken
+	pos    int
+}
+
+func parseQuery(expr string) (queryNode, error) {
+	tokens, err := tokenizeQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{expr: expr, tokens: tokens}
+	node, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tk := p.peek(); tk != nil {
+		return nil, fmt.Errorf("unexpected token %q in query: %s", tk.value, expr)
+	}
+	return node, nil
+}
+
+func (p *queryParser) peek() *queryToken {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() *queryToken {
+	tk := p.peek()
+	if tk != nil {
+		p.pos++
+	}
+	return tk
+}
+
+func (p *queryParser) expect(value string) error {
+	tk := p.next()
+	if tk == nil || tk.quoted || tk.value != value {
+		return fmt.Errorf("expected %q in query: %s", value, p.expr)
+	}
+	return nil
+}
+
+func (p *queryParser) parseExpr() (queryNode, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tk := p.peek()
+		if tk == nil || tk.quoted {
+			return x, nil
+		}
+		var op string
+		switch tk.value {
+		case "+", "union":
+			op = "+"
+		case "-", "except":
+			op = "-"
+		case "^", "intersect":
+			op = "^"
+		default:
+			return x, nil
+		}
+		p.next()
+		y, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		x = &queryBinary{op: op, x: x, y: y}
+	}
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	tk := p.next()
+	if tk == nil {
+		return nil, fmt.Errorf("unexpected end of query: %s", p.expr)
+	}
+	if tk.quoted {
+		return &queryWord{value: tk.value}, nil
+	}
+	switch tk.value {
+	case "(":
+		node, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case ")", ",", "+", "-", "^":
+		return nil, fmt.Errorf("unexpected token %q in query: %s", tk.value, p.expr)
+	}
+	if next := p.peek(); next == nil || next.quoted || next.value != "(" {
+		return &queryWord{value: tk.value}, nil
+	}
+	p.next()
+	call := &queryCall{name: tk.value}
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		sep := p.next()
+		if sep == nil || sep.quoted {
+			return nil, fmt.Errorf("expected ')' in query: %s", p.expr)
+		}
+		if sep.value == ")" {
+			return call, nil
+		}
+		if sep.value != "," {
+			return nil, fmt.Errorf("unexpected token %q in query: %s", sep.value, p.expr)
+		}
+	}
+}
+
+type querySet map[*CCLibrary]struct{}
+
+type queryEvaluator struct {
+	resolver *Resolver
+	libs     []*CCLibrary
+	rdeps    map[*CCLibrary][]*CCLibrary
+}
+
+func newQueryEvaluator(resolver *Resolver) *queryEvaluator {
+	libs := resolver.Libraries()
+	rdeps := make(map[*CCLibrary][]*CCLibrary)
+	for _, lib := range libs {
+		for _, dep := range lib.ResolvedDependencies {
+			rdeps[dep] = append(rdeps[dep], lib)
+		}
+	}
+	return &queryEvaluator{
+		resolver: resolver,
+		libs:     libs,
+		rdeps:    rdeps,
+	}
+}
+
+func (e *queryEvaluator) eval(node queryNode) (querySet, error) {
+	switch n := node.(type) {
+	case *queryWord:
+		return e.evalPattern(n.value)
+	case *queryBinary:
+		x, err := e.eval(n.x)
+		if err != nil {
+			return nil, err
+		}
+		y, err := e.eval(n.y)
+		if err != nil {
+			return nil, err
+		}
+		ret := make(querySet)
+		switch n.op {
+		case "+":
+			for lib := range x {
+				ret[lib] = struct{}{}
+			}
+			for lib := range y {
+				ret[lib] = struct{}{}
+			}
+		case "-":
+			for lib := range x {
+				if _, exists := y[lib]; !exists {
+					ret[lib] = struct{}{}
+				}
+			}
+		case "^":
+			for lib := range x {
+				if _, exists := y[lib]; exists {
+					ret[lib] = struct{}{}
+				}
+			}
+		}
+		return ret, nil
+	case *queryCall:
+		return e.evalCall(n)
+	}
+	return nil, fmt.Errorf("unexpected query node: %s", node)
+}
+
+func (e *queryEvaluator) evalCall(call *queryCall) (querySet, error) {
+	switch call.name {
+	case "deps":
+		if err := e.checkArgs(call, 1, 2); err != nil {
+			return nil, err
+		}
+		x, err := e.eval(call.args[0])
+		if err != nil {
+			return nil, err
+		}
+		depth, err := e.depthArg(call, 1)
+		if err != nil {
+			return nil, err
+		}
+		return e.closure(x, depth, func(lib *CCLibrary) []*CCLibrary {
+			return lib.ResolvedDependencies
+		}), nil
+	case "rdeps":
+		if err := e.checkArgs(call, 2, 3); err != nil {
+			return nil, err
+		}
+		universe, err := e.eval(call.args[0])
+		if err != nil {
+			return nil, err
+		}
+		x, err := e.eval(call.args[1])
+		if err != nil {
+			return nil, err
+		}
+		depth, err := e.depthArg(call, 2)
+		if err != nil {
+			return nil, err
+		}
+		universe = e.closure(universe, -1, func(lib *CCLibrary) []*CCLibrary {
+			return lib.ResolvedDependencies
+		})
+		start := make(querySet)
+		for lib := range x {
+			if _, exists := universe[lib]; exists {
+				start[lib] = struct{}{}
+			}
+		}
+		return e.closure(start, depth, func(lib *CCLibrary) []*CCLibrary {
+			var ret []*CCLibrary
+			for _, rdep := range e.rdeps[lib] {
+				if _, exists := universe[rdep]; exists {
+					ret = append(ret, rdep)
+				}
+			}
+			return ret
+		}), nil
+	case "somepath":
+		if err := e.checkArgs(call, 2, 2); err != nil {
+			return nil, err
+		}
+		from, err := e.eval(call.args[0])
+		if err != nil {
+			return nil, err
+		}
+		to, err := e.eval(call.args[1])
+		if err != nil {
+			return nil, err
+		}
+		return e.somepath(from, to), nil
+	case "allpaths":
+		if err := e.checkArgs(call, 2, 2); err != nil {
+			return nil, err
+		}
+		from, err := e.eval(call.args[0])
+		if err != nil {
+			return nil, err
+		}
+		to, err := e.eval(call.args[1])
+		if err != nil {
+			return nil, err
+		}
+		deps := e.closure(from, -1, func(lib *CCLibrary) []*CCLibrary {
+			return lib.ResolvedDependencies
+		})
+		rdeps := e.closure(to, -1, func(lib *CCLibrary) []*CCLibrary {
+			return e.rdeps[lib]
+		})
+		ret := make(querySet)
+		for lib := range deps {
+			if _, exists := rdeps[lib]; exists {
+				ret[lib] = struct{}{}
+			}
+		}
+		return ret, nil
+	case "kind":
+		if err := e.checkArgs(call, 2, 2); err != nil {
+			return nil, err
+		}
+		pattern, err := e.regexpArg(call, 0)
+		if err != nil {
+			return nil, err
+		}
+		return e.filter(call.args[1], func(lib *CCLibrary) bool {
+			return pattern.MatchString(lib.Kind)
+		})
+	case "attr":
+		if err := e.checkArgs(call, 3, 3); err != nil {
+			return nil, err
+		}
+		name, err := e.wordArg(call, 0)
+		if err != nil {
+			return nil, err
+		}
+		pattern, err := e.regexpArg(call, 1)
+		if err != nil {
+			return nil, err
+		}
+		return e.filter(call.args[2], func(lib *CCLibrary) bool {
+			values, exists := lib.Attributes[name]
+			if !exists {
+				return false
+			}
+			if len(values) == 0 {
+				return pattern.MatchString("")
+			}
+			for _, value := range values {
+				if pattern.MatchString(value) {
+					return true
+				}
+			}
+			return false
+		})
+	case "filter":
+		if err := e.checkArgs(call, 2, 2); err != nil {
+			return nil, err
+		}
+		pattern, err := e.regexpArg(call, 0)
+		if err != nil {
+			return nil, err
+		}
+		return e.filter(call.args[1], func(lib *CCLibrary) bool {
+			return pattern.MatchString(lib.FQDN())
+		})
+	}
+	return nil, fmt.Errorf("unsupported query function: %s", call.name)
+}
+
+func (e *queryEvaluator) checkArgs(call *queryCall, min, max int) error {
+	if len(call.args) < min || len(call.args) > max {
+		if min == max {
+			return fmt.Errorf("%s takes %d arguments but got %d", call.name, min, len(call.args))
+		}
+		return fmt.Errorf("%s takes %d or %d arguments but got %d", call.name, min, max, len(call.args))
+	}
+	return nil
+}
+
+func (e *queryEvaluator) wordArg(call *queryCall, idx int) (string, error) {
+	word, ok := call.args[idx].(*queryWord)
+	if !ok {
+		return "", fmt.Errorf("argument %d of %s must be a word but got %s", idx+1, call.name, call.args[idx])
+	}
+	return word.value, nil
+}
+
+func (e *queryEvaluator) regexpArg(call *queryCall, idx int) (*regexp.Regexp, error) {
+	word, err := e.wordArg(call, idx)
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := regexp.Compile(word)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile pattern of %s: %w", call.name, err)
+	}
+	return pattern, nil
+}
+
+// depthArg returns the optional depth argument at idx. -1 means unbounded.
+func (e *queryEvaluator) depthArg(call *queryCall, idx int) (int, error) {
+	if len(call.args) <= idx {
+		return -1, nil
+	}
+	word, err := e.wordArg(call, idx)
+	if err != nil {
+		return 0, err
+	}
+	depth, err := strconv.Atoi(word)
+	if err != nil || depth < 0 {
+		return 0, fmt.Errorf("depth of %s must be a non-negative integer but got %s", call.name, word)
+	}
+	return depth, nil
+}
+
+func (e *queryEvaluator) filter(node queryNode, match func(*CCLibrary) bool) (querySet, error) {
+	x, err := e.eval(node)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(querySet)
+	for lib := range x {
+		if match(lib) {
+			ret[lib] = struct{}{}
+		}
+	}
+	return ret, nil
+}
+
+func (e *queryEvaluator) closure(start querySet, depth int, edges func(*CCLibrary) []*CCLibrary) querySet {
+	ret := make(querySet)
+	queue := make([]*CCLibrary, 0, len(start))
+	for lib := range start {
+		ret[lib] = struct{}{}
+		queue = append(queue, lib)
+	}
+	for level := 0; len(queue) > 0 && (depth < 0 || level < depth); level++ {
+		var next []*CCLibrary
+		for _, lib := range queue {
+			for _, edge := range edges(lib) {
+				if _, exists := ret[edge]; exists {
+					continue
+				}
+				ret[edge] = struct{}{}
+				next = append(next, edge)
+			}
+		}
+		queue = next
+	}
+	return ret
+}
+
+func (e *queryEvaluator) somepath(from, to querySet) querySet {
+	parents := make(map[*CCLibrary]*CCLibrary)
+	var queue []*CCLibrary
+	for _, lib := range e.sort(from) {
+		parents[lib] = nil
+		queue = append(queue, lib)
+	}
+	for len(queue) > 0 {
+		lib := queue[0]
+		queue = queue[1:]
+		if _, exists := to[lib]; exists {
+			ret := make(querySet)
+			for ; lib != nil; lib = parents[lib] {
+				ret[lib] = struct{}{}
+			}
+			return ret
+		}
+		for _, dep := range lib.ResolvedDependencies {
+			if _, exists := parents[dep]; exists {
+				continue
+			}
+			parents[dep] = lib
+			queue = append(queue, dep)
+		}
+	}
+	return querySet{}
+}
+
+func (e *queryEvaluator) evalPattern(pattern string) (querySet, error) {
+	ret := make(querySet)
+	repo := ""
+	body := pattern
+	if strings.HasPrefix(pattern, "@") {
+		idx := strings.Index(pattern, "//")
+		if idx < 0 {
+			libs, err := e.resolver.LookupLabel(pattern)
+			if err != nil {
+				return nil, err
+			}
+			for _, lib := range libs {
+				ret[lib] = struct{}{}
+			}
+			return ret, nil
+		}
+		repo = pattern[1:idx]
+		body = pattern[idx:]
+	}
+	if !strings.HasPrefix(body, "//") {
+		return nil, fmt.Errorf("unexpected target pattern: %s", pattern)
+	}
+	path := strings.TrimPrefix(body, "//")
+	var match func(lib *CCLibrary) bool
+	switch {
+	case path == "...":
+		match = func(lib *CCLibrary) bool { return true }
+	case strings.HasSuffix(path, "/..."):
+		prefix := strings.TrimSuffix(path, "/...")
+		match = func(lib *CCLibrary) bool {
+			return lib.File.Path == prefix || strings.HasPrefix(lib.File.Path, prefix+"/")
+		}
+	case strings.HasSuffix(path, ":all"), strings.HasSuffix(path, ":*"):
+		pkg := path[:strings.LastIndex(path, ":")]
+		match = func(lib *CCLibrary) bool { return lib.File.Path == pkg }
+	default:
+		libs, err := e.resolver.LookupLabel(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, lib := range libs {
+			ret[lib] = struct{}{}
+		}
+		return ret, nil
+	}
+	for _, lib := range e.libs {
+		if repo != "" && lib.File.Library.Name != repo {
+			continue
+		}
+		if match(lib) {
+			ret[lib] = struct{}{}
+		}
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no targets match pattern: %s", pattern)
+	}
+	return ret, nil
+}
+
+// sort returns the libraries of set in dependency order.
+// Libraries without an ordering constraint are sorted by label.
+func (e *queryEvaluator) sort(set querySet) []*CCLibrary {
+	visited := make(map[*CCLibrary]struct{})
+	var postorder []*CCLibrary
+	var visit func(lib *CCLibrary)
+	visit = func(lib *CCLibrary) {
+		if _, exists := visited[lib]; exists {
+			return
+		}
+		visited[lib] = struct{}{}
+		deps := append([]*CCLibrary{}, lib.ResolvedDependencies...)
+		sort.Slice(deps, func(i, j int) bool {
+			return deps[i].FQDN() > deps[j].FQDN()
+		})
+		for _, dep := range deps {
+			visit(dep)
+		}
+		postorder = append(postorder, lib)
+	}
+	roots := make([]*CCLibrary, 0, len(set))
+	for lib := range set {
+		roots = append(roots, lib)
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		return roots[i].FQDN() > roots[j].FQDN()
+	})
+	for _, lib := range roots {
+		visit(lib)
+	}
+	ret := make([]*CCLibrary, 0, len(set))
+	for i := len(postorder) - 1; i >= 0; i-- {
+		if _, exists := set[postorder[i]]; exists {
+			ret = append(ret, postorder[i])
+		}
+	}
+	return ret
+}
@@ -0,0 +1,46 @@
+package bazelmake_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+func TestQuery(t *testing.T) {
+	cfg := createWorkspace(t)
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"deps(//lib)", "@a//lib:lib @a//lib:util @b//base:base @b//base:log"},
+		{"deps(@a//lib:lib, 1)", "@a//lib:lib @a//lib:util @b//base:base"},
+		{"rdeps(//..., @b//base:log, 1)", "@a//lib:util @b//base:base @b//base:log"},
+		{"somepath(//lib, //base:log)", "@a//lib:lib @a//lib:util @b//base:log"},
+		{"allpaths(//lib:util, //base:log)", "@a//lib:util @b//base:log"},
+		{"kind(cc_library, @b//...)", "@b//base:base @b//base:log"},
+		{"attr(srcs, 'util\\.cc', //...)", "@a//lib:util"},
+		{"filter(base, deps(//lib)) - //base:log", "@b//base:base"},
+		{"//lib:all ^ deps(//base)", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			libs, err := bazelmake.Query(cfg, test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			labels := make([]string, 0, len(libs))
+			for _, lib := range libs {
+				labels = append(labels, lib.FQDN())
+			}
+			if got := strings.Join(labels, " "); got != test.expected {
+				t.Fatalf("unexpected result: expected %q but got %q", test.expected, got)
+			}
+		})
+	}
+	for _, expr := range []string{"deps(", "deps(//lib", "unknown(//lib)", "deps(//lib, x)", "kind(//lib)"} {
+		if _, err := bazelmake.Query(cfg, expr); err == nil {
+			t.Fatalf("expected error for %s", expr)
+		}
+	}
+}
@@ -27,12 +27,32 @@ func (f *File) FQDN() string {
 
 type CCLibrary struct {
 	File                 *File
+	Kind                 string
 	Name                 string
 	Sources              []string
 	Headers              []string
 	Options              []string
+	LinkOptions          []string
+	Defines              []string
+	LocalDefines         []string
+	Includes             []string
+	AlwaysLink           bool
 	Dependencies         []string
 	ResolvedDependencies []*CCLibrary
+	Attributes           map[string][]string
+	// UnresolvedDependencies are the deps of cc_test and cc_binary which are not libraries like linker scripts.
+	// They are reported when the target is built.
+	UnresolvedDependencies []string
+	// SingleThreadedConditions are the conditions of the select() branches taken by the library
+	// that drop the -pthread or -lpthread of the other branches.
+	SingleThreadedConditions []string
+}
+
+func newCCLibrary(kind string) *CCLibrary {
+	return &CCLibrary{
+		Kind:       kind,
+		Attributes: make(map[string][]string),
+	}
 }
 
 func (lib *CCLibrary) ObjectFileName() string {
@@ -47,6 +67,11 @@ func (lib *CCLibrary) FQDN() string {
 	return fmt.Sprintf("%s:%s", lib.File.FQDN(), lib.Name)
 }
 
+// IsExecutable reports whether the target is a cc_test or a cc_binary.
+func (lib *CCLibrary) IsExecutable() bool {
+	return lib.Kind == "cc_test" || lib.Kind == "cc_binary"
+}
+
 func (lib *CCLibrary) SourcePaths(root string) []string {
 	ret := make([]string, 0, len(lib.Sources))
 	for _, src := range lib.Sources {
@@ -55,6 +80,97 @@ func (lib *CCLibrary) SourcePaths(root string) []string {
 	return ret
 }
 
+func (lib *CCLibrary) HeaderPaths(root string) []string {
+	ret := make([]string, 0, len(lib.Headers))
+	for _, hdr := range lib.Headers {
+		ret = append(ret, filepath.Join(root, lib.File.Library.Root, lib.File.Path, hdr))
+	}
+	return ret
+}
+
+var headerExtensions = map[string]struct{}{
+	".h":   {},
+	".hh":  {},
+	".hpp": {},
+	".hxx": {},
+	".inc": {},
+	".inl": {},
+	".ipp": {},
+	".tcc": {},
+}
+
+// DeclaredHeaderPaths returns the existing header files listed in hdrs and textual_hdrs.
+// Labels and generated headers are skipped.
+func (lib *CCLibrary) DeclaredHeaderPaths(root string) []string {
+	var ret []string
+	for _, kind := range []string{"hdrs", "textual_hdrs"} {
+		for _, hdr := range lib.Attributes[kind] {
+			if strings.HasPrefix(hdr, ":") || strings.HasPrefix(hdr, "//") || strings.HasPrefix(hdr, "@") {
+				continue
+			}
+			if _, exists := headerExtensions[filepath.Ext(hdr)]; !exists {
+				continue
+			}
+			path := filepath.Join(root, lib.File.Library.Root, lib.File.Path, hdr)
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			ret = append(ret, path)
+		}
+	}
+	return ret
+}
+
+// CompilerOptions returns copts usable outside Bazel.
+// Options referencing Bazel's make variables like $(STACK_FRAME_UNLIMITED) cannot be expanded and are dropped.
+func (lib *CCLibrary) CompilerOptions() []string {
+	ret := make([]string, 0, len(lib.Options))
+	for _, opt := range lib.Options {
+		if strings.Contains(opt, "$(") {
+			continue
+		}
+		ret = append(ret, opt)
+	}
+	return ret
+}
+
+func (lib *CCLibrary) IncludePaths(root string) []string {
+	ret := make([]string, 0, len(lib.Includes))
+	for _, include := range lib.Includes {
+		ret = append(ret, filepath.Join(root, lib.File.Library.Root, lib.File.Path, include))
+	}
+	return ret
+}
+
+// PreprocessorOptions returns the -I options of the includes and the -D options of the defines of lib and its transitive dependencies
+// followed by the -D options of the local_defines of lib, which are not propagated as Bazel does.
+func (lib *CCLibrary) PreprocessorOptions(root string) []string {
+	var includes, defines []string
+	visited := make(map[*CCLibrary]struct{})
+	var visit func(lib *CCLibrary)
+	visit = func(lib *CCLibrary) {
+		if _, exists := visited[lib]; exists {
+			return
+		}
+		visited[lib] = struct{}{}
+		for _, includePath := range lib.IncludePaths(root) {
+			includes = append(includes, "-I"+includePath)
+		}
+		for _, define := range lib.Defines {
+			defines = append(defines, "-D"+define)
+		}
+		for _, dep := range lib.ResolvedDependencies {
+			visit(dep)
+		}
+	}
+	visit(lib)
+	ret := append(includes, defines...)
+	for _, define := range lib.LocalDefines {
+		ret = append(ret, "-D"+define)
+	}
+	return ret
+}
+
 type LibraryFileMap map[string]*File
 
 type LibraryLocation struct {
@@ -70,6 +186,9 @@ type Resolver struct {
 	ignoreMap        map[string]struct{}
 	libraryFileMap   map[*LibraryConfig]LibraryFileMap
 	pathToVariables  map[string]map[string]any
+	buildFiles       []string
+	// singleThreaded collects the single-threaded conditions of the library being resolved.
+	singleThreaded []string
 }
 
 func NewResolver(cfg *Config) *Resolver {
@@ -114,27 +233,124 @@ func (r *Resolver) Resolve() ([]*CCLibrary, error) {
 		}
 	}
 	var targetLibs []*CCLibrary
-	for _, target := range r.cfg.Targets {
-		lib, exists := r.nameToLibraryMap[target.Library]
-		if !exists {
-			return nil, fmt.Errorf("failed to find library by name: %s", target.Library)
-		}
-		cclib, err := r.lookupCCLibraryByLocation(&LibraryLocation{
-			Library:   lib,
-			Path:      target.Path,
-			CCLibName: target.Name,
-		})
+	visited := make(map[*CCLibrary]struct{})
+	for _, target := range r.cfg.AllTargets() {
+		cclib, err := r.LookupTarget(target)
 		if err != nil {
 			return nil, err
 		}
 		if cclib == nil {
 			continue
 		}
+		if _, exists := visited[cclib]; exists {
+			continue
+		}
+		visited[cclib] = struct{}{}
 		targetLibs = append(targetLibs, cclib)
 	}
 	return targetLibs, nil
 }
 
+// LookupTarget returns the library of target. It returns nil if the library is ignored.
+// It must be called after Resolve.
+func (r *Resolver) LookupTarget(target *BuildTargetLibraryConfig) (*CCLibrary, error) {
+	lib, exists := r.nameToLibraryMap[target.Library]
+	if !exists {
+		return nil, fmt.Errorf("failed to find library by name: %s", target.Library)
+	}
+	return r.lookupCCLibraryByLocation(&LibraryLocation{
+		Library:   lib,
+		Path:      target.Path,
+		CCLibName: target.Name,
+	})
+}
+
+// Libraries returns every resolved library of every configured repository sorted by label.
+// It must be called after Resolve.
+func (r *Resolver) Libraries() []*CCLibrary {
+	var ret []*CCLibrary
+	for _, fileMap := range r.libraryFileMap {
+		for _, file := range fileMap {
+			ret = append(ret, file.CCLibraries...)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].FQDN() < ret[j].FQDN()
+	})
+	return ret
+}
+
+// BuildFiles returns the paths of the BUILD files read by Resolve.
+func (r *Resolver) BuildFiles() []string {
+	return r.buildFiles
+}
+
+// LookupLabel returns the libraries referenced by label.
+// A label with a repository name ( @xyz//path/to:abcd ) matches at most one library,
+// a label without it ( //path/to:abcd ) matches the package in every configured repository.
+// It must be called after Resolve.
+func (r *Resolver) LookupLabel(label string) ([]*CCLibrary, error) {
+	if strings.HasPrefix(label, "@") {
+		loc, err := r.resolveLibraryLocation(nil, label)
+		if err != nil {
+			return nil, err
+		}
+		cclib, err := r.lookupCCLibraryByLocation(loc)
+		if err != nil {
+			return nil, err
+		}
+		if cclib == nil {
+			return nil, nil
+		}
+		return []*CCLibrary{cclib}, nil
+	}
+	if !strings.HasPrefix(label, "//") {
+		return nil, fmt.Errorf("unexpected label: %s", label)
+	}
+	path := strings.TrimPrefix(label, "//")
+	name := filepath.Base(path)
+	if idx := strings.Index(path, ":"); idx >= 0 {
+		name = path[idx+1:]
+		path = path[:idx]
+	}
+	var ret []*CCLibrary
+	for _, lib := range r.cfg.Libraries {
+		file, exists := r.libraryFileMap[lib][path]
+		if !exists {
+			continue
+		}
+		if cclib, exists := file.cclibMap[name]; exists {
+			ret = append(ret, cclib)
+		}
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("failed to find library by label: %s", label)
+	}
+	return ret, nil
+}
+
+// LookupFile returns the libraries listing path in their srcs or hdrs.
+// path is either relative to the working directory as in the generated Makefile or relative to Config.Root.
+// It must be called after Resolve.
+func (r *Resolver) LookupFile(path string) []*CCLibrary {
+	path = filepath.Clean(path)
+	candidates := map[string]struct{}{
+		path:                            {},
+		filepath.Join(r.cfg.Root, path): {},
+	}
+	var ret []*CCLibrary
+	for _, lib := range r.Libraries() {
+		paths := append(lib.SourcePaths(r.cfg.Root), lib.HeaderPaths(r.cfg.Root)...)
+		for _, p := range paths {
+			if _, exists := candidates[p]; exists {
+				ret = append(ret, lib)
+				break
+			}
+		}
+	}
+	return ret
+}
+
 func (r *Resolver) resolveLibraryBuildFiles(lib *LibraryConfig) error {
 	libRoot := filepath.Join(r.cfg.Root, lib.Root)
 	if err := filepath.Walk(libRoot, func(path string, info fs.FileInfo, err error) error {
@@ -143,6 +359,7 @@ func (r *Resolver) resolveLibraryBuildFiles(lib *LibraryConfig) error {
 		}
 		switch filepath.Base(path) {
 		case "BUILD", "BUILD.bazel":
+			r.buildFiles = append(r.buildFiles, path)
 			r.pathToVariables[path] = make(map[string]any)
 			libs, otherLibs, err := r.resolveCCLibraries(path)
 			if err != nil {
@@ -204,8 +421,8 @@ func (r *Resolver) resolveCCLibraries(path string) ([]*CCLibrary, []string, erro
 		}
 		name := r.getText(callExpr.X)
 		switch name {
-		case "cc_library":
-			libs = append(libs, r.resolveCCLibrary(path, callExpr.List))
+		case "cc_library", "cc_test", "cc_binary":
+			libs = append(libs, r.resolveCCLibrary(path, name, callExpr.List))
 		case "cc_proto_library":
 			libs = append(libs, r.resolveCCProtoLibrary(path, callExpr.List))
 		case "proto_library":
@@ -232,15 +449,27 @@ func (r *Resolver) resolveCCLibraries(path string) ([]*CCLibrary, []string, erro
 	return libs, otherLibs, nil
 }
 
-func (r *Resolver) resolveCCLibrary(path string, list []build.Expr) *CCLibrary {
-	var ret CCLibrary
+// resolveCCLibrary resolves cc_library, cc_test and cc_binary.
+// The dict of env is kept in Attributes as KEY=VALUE.
+func (r *Resolver) resolveCCLibrary(path, rule string, list []build.Expr) *CCLibrary {
+	ret := newCCLibrary(rule)
+	r.singleThreaded = nil
+	defer func() {
+		ret.SingleThreadedConditions = r.singleThreaded
+		r.singleThreaded = nil
+	}()
 	for _, item := range list {
 		assignExpr, ok := item.(*build.AssignExpr)
 		if !ok {
 			continue
 		}
 		kind := r.getText(assignExpr.LHS)
+		if dict, ok := assignExpr.RHS.(*build.DictExpr); ok && kind == "env" {
+			ret.Attributes[kind] = r.resolveDict(path, dict)
+			continue
+		}
 		value := r.resolveExpr(path, assignExpr.RHS)
+		ret.Attributes[kind] = r.toStrings(value)
 		switch kind {
 		case "name":
 			ret.Name = r.toString(value)
@@ -252,9 +481,19 @@ func (r *Resolver) resolveCCLibrary(path string, list []build.Expr) *CCLibrary {
 			ret.Dependencies = r.toStrings(value)
 		case "copts":
 			ret.Options = r.toStrings(value)
+		case "linkopts":
+			ret.LinkOptions = r.toStrings(value)
+		case "defines":
+			ret.Defines = r.toStrings(value)
+		case "local_defines":
+			ret.LocalDefines = r.toStrings(value)
+		case "includes":
+			ret.Includes = r.toStrings(value)
+		case "alwayslink":
+			ret.AlwaysLink = r.toBool(value)
 		}
 	}
-	return &ret
+	return ret
 }
 
 func (r *Resolver) resolveIdentifier(path string, expr build.Expr) string {
@@ -270,6 +509,10 @@ func (r *Resolver) resolveIdentifier(path string, expr build.Expr) string {
 func (r *Resolver) resolveExpr(path string, expr build.Expr) any {
 	switch v := expr.(type) {
 	case *build.Ident:
+		switch v.Name {
+		case "True", "False":
+			return v.Name
+		}
 		return r.pathToVariables[path][v.Name]
 	case *build.StringExpr:
 		return v.Value
@@ -329,7 +572,7 @@ func (r *Resolver) resolveExpr(path string, expr build.Expr) any {
 			sort.Strings(ret)
 			return ret
 		case "select":
-			return []string{}
+			return r.resolveSelect(path, v)
 		}
 		log.Printf("%s(%v)", r.getText(v.X), v.List)
 		return nil
@@ -358,6 +601,72 @@ func (r *Resolver) resolveExpr(path string, expr build.Expr) any {
 	return []string{}
 }
 
+// resolveSelect resolves select() to the first branch whose condition is in Config.Conditions,
+// or to //conditions:default if none matches. select() resolves to nothing unless conditions are configured.
+func (r *Resolver) resolveSelect(path string, call *build.CallExpr) any {
+	if len(r.cfg.Conditions) == 0 || len(call.List) == 0 {
+		return []string{}
+	}
+	dict, ok := call.List[0].(*build.DictExpr)
+	if !ok {
+		return []string{}
+	}
+	conditions := make(map[string]struct{}, len(r.cfg.Conditions))
+	for _, cond := range r.cfg.Conditions {
+		conditions[cond] = struct{}{}
+	}
+	var (
+		defaultValue build.Expr
+		taken        *build.KeyValueExpr
+	)
+	for _, kv := range dict.List {
+		key := r.toString(r.resolveExpr(path, kv.Key))
+		if key == "//conditions:default" {
+			defaultValue = kv.Value
+			continue
+		}
+		if _, exists := conditions[key]; exists {
+			taken = kv
+			break
+		}
+	}
+	if taken == nil {
+		if defaultValue == nil {
+			return []string{}
+		}
+		return r.resolveExpr(path, defaultValue)
+	}
+	value := r.resolveExpr(path, taken.Value)
+	if !hasThreadOption(r.toStrings(value)) {
+		for _, kv := range dict.List {
+			if kv != taken && hasThreadOption(r.toStrings(r.resolveExpr(path, kv.Value))) {
+				r.singleThreaded = append(r.singleThreaded, r.toString(r.resolveExpr(path, taken.Key)))
+				break
+			}
+		}
+	}
+	return value
+}
+
+// resolveDict resolves a dict of strings like env to KEY=VALUE.
+func (r *Resolver) resolveDict(path string, dict *build.DictExpr) []string {
+	ret := make([]string, 0, len(dict.List))
+	for _, kv := range dict.List {
+		ret = append(ret, r.toString(r.resolveExpr(path, kv.Key))+"="+r.toString(r.resolveExpr(path, kv.Value)))
+	}
+	return ret
+}
+
+// hasThreadOption reports whether the options build or link with pthread.
+func hasThreadOption(options []string) bool {
+	for _, opt := range options {
+		if opt == "-pthread" || opt == "-lpthread" {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *Resolver) resolveClause(path string, clause build.Expr, body build.Expr) []string {
 	switch v := clause.(type) {
 	case *build.ForClause:
@@ -374,7 +683,7 @@ func (r *Resolver) resolveClause(path string, clause build.Expr, body build.Expr
 }
 
 func (r *Resolver) resolveCCProtoLibrary(path string, list []build.Expr) *CCLibrary {
-	var ret CCLibrary
+	ret := newCCLibrary("cc_proto_library")
 	for _, item := range list {
 		assignExpr, ok := item.(*build.AssignExpr)
 		if !ok {
@@ -382,6 +691,7 @@ func (r *Resolver) resolveCCProtoLibrary(path string, list []build.Expr) *CCLibr
 		}
 		kind := r.getText(assignExpr.LHS)
 		value := r.resolveExpr(path, assignExpr.RHS)
+		ret.Attributes[kind] = r.toStrings(value)
 		switch kind {
 		case "name":
 			ret.Name = r.toString(value)
@@ -389,11 +699,11 @@ func (r *Resolver) resolveCCProtoLibrary(path string, list []build.Expr) *CCLibr
 			ret.Dependencies = r.toStrings(value)
 		}
 	}
-	return &ret
+	return ret
 }
 
 func (r *Resolver) resolveProtoLibrary(path string, list []build.Expr) *CCLibrary {
-	var ret CCLibrary
+	ret := newCCLibrary("proto_library")
 	for _, item := range list {
 		assignExpr, ok := item.(*build.AssignExpr)
 		if !ok {
@@ -401,6 +711,7 @@ func (r *Resolver) resolveProtoLibrary(path string, list []build.Expr) *CCLibrar
 		}
 		kind := r.getText(assignExpr.LHS)
 		value := r.resolveExpr(path, assignExpr.RHS)
+		ret.Attributes[kind] = r.toStrings(value)
 		switch kind {
 		case "name":
 			ret.Name = r.toString(value)
@@ -417,11 +728,11 @@ func (r *Resolver) resolveProtoLibrary(path string, list []build.Expr) *CCLibrar
 		fmt.Println("found wkt_proto", ret)
 		fmt.Println("path to variables", r.pathToVariables[path])
 	}
-	return &ret
+	return ret
 }
 
 func (r *Resolver) resolveConfigureMake(path string, list []build.Expr) *CCLibrary {
-	var ret CCLibrary
+	ret := newCCLibrary("configure_make")
 	for _, item := range list {
 		assignExpr, ok := item.(*build.AssignExpr)
 		if !ok {
@@ -429,6 +740,7 @@ func (r *Resolver) resolveConfigureMake(path string, list []build.Expr) *CCLibra
 		}
 		kind := r.getText(assignExpr.LHS)
 		value := r.resolveExpr(path, assignExpr.RHS)
+		ret.Attributes[kind] = r.toStrings(value)
 		switch kind {
 		case "name":
 			ret.Name = r.toString(value)
@@ -438,11 +750,11 @@ func (r *Resolver) resolveConfigureMake(path string, list []build.Expr) *CCLibra
 			ret.Dependencies = r.toStrings(value)
 		}
 	}
-	return &ret
+	return ret
 }
 
 func (r *Resolver) resolveFilegroup(path string, list []build.Expr) *CCLibrary {
-	var ret CCLibrary
+	ret := newCCLibrary("filegroup")
 	for _, item := range list {
 		assignExpr, ok := item.(*build.AssignExpr)
 		if !ok {
@@ -450,6 +762,7 @@ func (r *Resolver) resolveFilegroup(path string, list []build.Expr) *CCLibrary {
 		}
 		kind := r.getText(assignExpr.LHS)
 		value := r.resolveExpr(path, assignExpr.RHS)
+		ret.Attributes[kind] = r.toStrings(value)
 		switch kind {
 		case "name":
 			ret.Name = r.toString(value)
@@ -457,7 +770,7 @@ func (r *Resolver) resolveFilegroup(path string, list []build.Expr) *CCLibrary {
 			ret.Sources = r.filterSource(r.toStrings(value))
 		}
 	}
-	return &ret
+	return ret
 }
 
 func (r *Resolver) filterSource(srcs []string) []string {
@@ -488,27 +801,35 @@ func (r *Resolver) resolveLibraryDependencies(file *File) error {
 	for _, lib := range file.CCLibraries {
 		var depLibs []*CCLibrary
 		for _, dep := range lib.Dependencies {
-			loc, err := r.resolveLibraryLocation(file, dep)
+			depLib, err := r.lookupDependency(file, dep)
 			if err != nil {
-				return err
-			}
-			if loc == nil {
+				if !lib.IsExecutable() {
+					return err
+				}
+				// nothing depends on executables, so their unresolved deps matter only when they are built.
+				lib.UnresolvedDependencies = append(lib.UnresolvedDependencies, dep)
 				continue
 			}
-			depLib, err := r.lookupCCLibraryByLocation(loc)
-			if err != nil {
-				return err
-			}
-			if depLib == nil {
-				continue
+			if depLib != nil {
+				depLibs = append(depLibs, depLib)
 			}
-			depLibs = append(depLibs, depLib)
 		}
 		lib.ResolvedDependencies = depLibs
 	}
 	return nil
 }
 
+func (r *Resolver) lookupDependency(file *File, dep string) (*CCLibrary, error) {
+	loc, err := r.resolveLibraryLocation(file, dep)
+	if err != nil {
+		return nil, err
+	}
+	if loc == nil {
+		return nil, nil
+	}
+	return r.lookupCCLibraryByLocation(loc)
+}
+
 func (r *Resolver) resolveLibraryLocation(file *File, dep string) (*LibraryLocation, error) {
 	var ret LibraryLocation
 	ret.Original = dep
@@ -637,6 +958,14 @@ func (r *Resolver) toString(v any) string {
 	return ""
 }
 
+func (r *Resolver) toBool(v any) bool {
+	switch r.toString(v) {
+	case "True", "1":
+		return true
+	}
+	return false
+}
+
 func (r *Resolver) toStrings(v any) []string {
 	if v == nil {
 		return nil
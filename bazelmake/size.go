@@ -0,0 +1,282 @@
+package bazelmake
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SizeGroup decides the entries of a size report.
+type SizeGroup string
+
+const (
+	SizeByLibrary SizeGroup = "library"
+	SizeBySource  SizeGroup = "source"
+)
+
+// SizeOrder decides the order of the entries of a size report.
+type SizeOrder string
+
+const (
+	// SortBySize sorts the entries by code and data bytes in descending order. It is the default.
+	SortBySize SizeOrder = "size"
+	SortByCode SizeOrder = "code"
+	SortByData SizeOrder = "data"
+	SortByName SizeOrder = "name"
+)
+
+// MapChunk is an input chunk of the CODE or DATA section in the map file written by wasm-ld.
+type MapChunk struct {
+	// Section is either CODE or DATA.
+	Section string
+	// File is the object file. The member of an archive is written like lib.a(obj.o).
+	// It is <internal> for the functions synthesized by the linker.
+	File string
+	// Name is the function or the data segment of the chunk.
+	Name string
+	Size int64
+}
+
+// MapFile is the map file written by wasm-ld with -Map.
+type MapFile struct {
+	Chunks []*MapChunk
+	// CodeSize and DataSize are the sizes of the CODE and DATA sections.
+	CodeSize int64
+	DataSize int64
+}
+
+// ReadMapFile parses the map file at path.
+func ReadMapFile(path string) (*MapFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := ParseMapFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// ParseMapFile parses a map file of wasm-ld.
+// Every line starts with the address, the offset and the size in hex, followed by an output section at no indent,
+// an input chunk at 8 spaces of indent, or a symbol at 16 spaces of indent.
+func ParseMapFile(r io.Reader) (*MapFile, error) {
+	const columns = 27
+	ret := &MapFile{}
+	var section string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if lineNum == 1 || strings.TrimSpace(line) == "" {
+			continue
+		}
+		if len(line) <= columns {
+			return nil, fmt.Errorf("line %d: unexpected line %q", lineNum, line)
+		}
+		fields := strings.Fields(line[:columns])
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: unexpected line %q", lineNum, line)
+		}
+		size, err := strconv.ParseInt(fields[2], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid size %q", lineNum, fields[2])
+		}
+		text := line[columns:]
+		indent := len(text) - len(strings.TrimLeft(text, " "))
+		text = strings.TrimSpace(text)
+		switch {
+		case indent == 0 && (text == "CODE" || text == "DATA"):
+			section = text
+			if section == "CODE" {
+				ret.CodeSize += size
+			} else {
+				ret.DataSize += size
+			}
+		case indent == 0 && section == "DATA" && strings.HasPrefix(text, "."):
+			// an output segment like .rodata of the data section.
+		case indent == 0:
+			section = ""
+		case indent == 8 && section != "":
+			i := strings.LastIndex(text, ":(")
+			if i < 0 || !strings.HasSuffix(text, ")") {
+				return nil, fmt.Errorf("line %d: unexpected input chunk %q", lineNum, text)
+			}
+			ret.Chunks = append(ret.Chunks, &MapChunk{
+				Section: section,
+				File:    text[:i],
+				Name:    text[i+2 : len(text)-1],
+				Size:    size,
+			})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// SizeEntry is the bytes a library, a source or an external file contributes to the module.
+type SizeEntry struct {
+	Name string `json:"name"`
+	// Library is the label of the library of a source.
+	Library string `json:"library,omitempty"`
+	// External is true for the files outside the project like libc.
+	External bool `json:"external,omitempty"`
+	// Ambiguous are the sources compiled to the archive members of the same name, whose sizes cannot be told apart.
+	Ambiguous []string `json:"ambiguous,omitempty"`
+	Code      int64    `json:"code"`
+	Data      int64    `json:"data"`
+}
+
+// Size returns the code and data bytes.
+func (e *SizeEntry) Size() int64 {
+	return e.Code + e.Data
+}
+
+// SizeReport attributes the code and data sections of a linked artifact.
+type SizeReport struct {
+	Artifact string `json:"artifact"`
+	// FileSize is the size of the module including the other sections like the name section.
+	FileSize int64        `json:"file_size"`
+	Code     int64        `json:"code"`
+	Data     int64        `json:"data"`
+	Entries  []*SizeEntry `json:"entries"`
+}
+
+// Sort sorts the entries by order.
+func (r *SizeReport) Sort(order SizeOrder) error {
+	var key func(e *SizeEntry) int64
+	switch order {
+	case "", SortBySize:
+		key = (*SizeEntry).Size
+	case SortByCode:
+		key = func(e *SizeEntry) int64 { return e.Code }
+	case SortByData:
+		key = func(e *SizeEntry) int64 { return e.Data }
+	case SortByName:
+	default:
+		return fmt.Errorf("unsupported order: %s", order)
+	}
+	sort.SliceStable(r.Entries, func(i, j int) bool {
+		a, b := r.Entries[i], r.Entries[j]
+		if key != nil && key(a) != key(b) {
+			return key(a) > key(b)
+		}
+		return a.Name < b.Name
+	})
+	return nil
+}
+
+// MapPath returns the path of the map file written when the artifact is linked with wasm.map_file.
+// It is empty otherwise.
+func (a *Artifact) MapPath() string {
+	if a.wasm == nil || !a.wasm.MapFile || a.IsStaticLibrary() {
+		return ""
+	}
+	return a.Path() + ".map"
+}
+
+// SizeReport attributes the sections of the linked artifact to the libraries or the sources with the map file.
+func (a *Artifact) SizeReport(group SizeGroup) (*SizeReport, error) {
+	switch group {
+	case "", SizeByLibrary, SizeBySource:
+	default:
+		return nil, fmt.Errorf("unsupported size group: %s", group)
+	}
+	path := a.MapPath()
+	if path == "" {
+		return nil, fmt.Errorf("artifact %s is not linked with wasm.map_file", a.Name())
+	}
+	m, err := ReadMapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(a.Path())
+	if err != nil {
+		return nil, err
+	}
+	objects := make(map[string]*Object)
+	for _, obj := range a.linkedObjects() {
+		objects[filepath.Clean(obj.Path())] = obj
+	}
+	// ar names the members by the base names, so the objects of x/util.cc and y/util.cc are both util.o.
+	members := make(map[string][]*Object)
+	for _, archive := range a.Archives {
+		for _, obj := range archive.Objects {
+			key := fmt.Sprintf("%s(%s)", filepath.Clean(archive.Path()), filepath.Base(obj.Path()))
+			if _, exists := objects[key]; !exists {
+				members[key] = append(members[key], obj)
+			}
+		}
+	}
+	for key, objs := range members {
+		if len(objs) == 1 {
+			objects[key] = objs[0]
+		}
+	}
+	report := &SizeReport{Artifact: a.Name(), FileSize: info.Size(), Code: m.CodeSize, Data: m.DataSize}
+	entries := make(map[string]*SizeEntry)
+	for _, chunk := range m.Chunks {
+		var entry *SizeEntry
+		if objs := members[filepath.Clean(chunk.File)]; len(objs) > 1 {
+			entry = ambiguousSizeEntry(objs, chunk.File, group)
+		} else {
+			entry = sizeEntry(objects[filepath.Clean(chunk.File)], chunk.File, group)
+		}
+		if e, exists := entries[entry.Name]; exists {
+			entry = e
+		} else {
+			entries[entry.Name] = entry
+			report.Entries = append(report.Entries, entry)
+		}
+		if chunk.Section == "CODE" {
+			entry.Code += chunk.Size
+		} else {
+			entry.Data += chunk.Size
+		}
+	}
+	if err := report.Sort(SortBySize); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// sizeEntry returns the empty entry of obj. Files outside the project are grouped by the archive.
+func sizeEntry(obj *Object, file string, group SizeGroup) *SizeEntry {
+	if obj == nil {
+		if i := strings.Index(file, "("); i > 0 && strings.HasSuffix(file, ")") {
+			file = file[:i]
+		}
+		return &SizeEntry{Name: file, External: true}
+	}
+	var library string
+	if obj.Library != nil {
+		library = obj.Library.FQDN()
+	}
+	if group == SizeBySource || library == "" {
+		return &SizeEntry{Name: obj.Source, Library: library}
+	}
+	return &SizeEntry{Name: library}
+}
+
+// ambiguousSizeEntry returns the empty entry of the archive member compiled from objs.
+// They belong to the library of the archive, but the member is reported as is by source.
+func ambiguousSizeEntry(objs []*Object, member string, group SizeGroup) *SizeEntry {
+	library := objs[0].Library.FQDN()
+	if group != SizeBySource {
+		return &SizeEntry{Name: library}
+	}
+	entry := &SizeEntry{Name: member, Library: library}
+	for _, obj := range objs {
+		entry.Ambiguous = append(entry.Ambiguous, obj.Source)
+	}
+	return entry
+}
@@ -0,0 +1,141 @@
+package bazelmake_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+func TestSizeReport(t *testing.T) {
+	cfg := createWorkspace(t)
+	cfg.OutputDir = t.TempDir()
+	cfg.Wasm = &bazelmake.WasmLinkConfig{MapFile: true}
+	project := newProject(t, cfg)
+	artifact := project.Artifacts[0]
+	if opts := strings.Join(artifact.LinkerOptions(), " "); opts != "-Wl,-Map="+artifact.MapPath() {
+		t.Fatalf("unexpected linker options: %s", opts)
+	}
+	objects := make(map[string]string)
+	for _, obj := range artifact.Objects {
+		objects[filepath.Base(obj.Source)] = obj.Path()
+	}
+	line := func(addr string, off, size int, text string) string {
+		return fmt.Sprintf("%8s %8x %8x %s\n", addr, off, size, text)
+	}
+	mapFile := "    Addr      Off     Size Out     In      Symbol\n" +
+		line("-", 8, 10, "TYPE") +
+		line("-", 0x100, 0x90, "CODE") +
+		line("-", 0x101, 2, "        <internal>:(__wasm_call_ctors)") +
+		line("-", 0x103, 0x40, "        "+objects["lib.cc"]+":(_Z3runv)") +
+		line("-", 0x103, 0x40, "                run()") +
+		line("-", 0x143, 0x20, "        "+objects["util.cc"]+":(util)") +
+		line("-", 0x163, 0x10, "        "+objects["base.cc"]+":(base)") +
+		line("-", 0x173, 0x1d, "        /sysroot/lib/libc.a(printf.o):(printf)") +
+		line("400", 0x200, 0x30, "DATA") +
+		line("400", 0x200, 0x30, ".rodata") +
+		line("400", 0x200, 0x18, "        "+objects["util.cc"]+":(.rodata.table)") +
+		line("418", 0x218, 0x18, "        /sysroot/lib/libc.a(printf.o):(.rodata.digits)") +
+		line("-", 0x300, 0x20, "name")
+	if err := os.WriteFile(artifact.MapPath(), []byte(mapFile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(artifact.Path(), make([]byte, 1000), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	format := func(report *bazelmake.SizeReport) string {
+		var entries []string
+		for _, e := range report.Entries {
+			entries = append(entries, fmt.Sprintf("%s=%d+%d", e.Name, e.Code, e.Data))
+		}
+		return strings.Join(entries, " ")
+	}
+	report, err := artifact.SizeReport(bazelmake.SizeByLibrary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Code != 0x90 || report.Data != 0x30 || report.FileSize != 1000 {
+		t.Fatalf("unexpected totals: %+v", report)
+	}
+	expected := "@a//lib:lib=64+0 @a//lib:util=32+24 /sysroot/lib/libc.a=29+24 @b//base:base=16+0 <internal>=2+0"
+	if got := format(report); got != expected {
+		t.Fatalf("unexpected entries:\nexpected %s\ngot      %s", expected, got)
+	}
+	if err := report.Sort(bazelmake.SortByName); err != nil {
+		t.Fatal(err)
+	}
+	if got := report.Entries[0].Name; got != "/sysroot/lib/libc.a" {
+		t.Fatalf("unexpected first entry by name: %s", got)
+	}
+	report, err = artifact.SizeReport(bazelmake.SizeBySource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := report.Sort(bazelmake.SortByCode); err != nil {
+		t.Fatal(err)
+	}
+	if got := report.Entries[0]; !strings.HasSuffix(got.Name, "lib.cc") || got.Library != "@a//lib:lib" {
+		t.Fatalf("unexpected entry: %+v", got)
+	}
+}
+
+func TestSizeReportArchiveMembers(t *testing.T) {
+	cfg := createWorkspace(t, map[string]string{
+		"a/dup/BUILD": `
+cc_library(
+    name = "dup",
+    srcs = [
+        "dup.cc",
+        "x/util.cc",
+        "y/util.cc",
+    ],
+    deps = ["//lib"],
+)
+`,
+	})
+	cfg.Targets = []*bazelmake.BuildTargetLibraryConfig{{Library: "a", Path: "dup", Name: "dup"}}
+	cfg.OutputDir = t.TempDir()
+	cfg.LinkMode = bazelmake.LinkArchives
+	cfg.Wasm = &bazelmake.WasmLinkConfig{MapFile: true}
+	artifact := newProject(t, cfg).Artifacts[0]
+	archive := filepath.Join(cfg.OutputDir, "a", "dup", "libdup.a")
+	mapFile := "    Addr      Off     Size Out     In      Symbol\n" +
+		fmt.Sprintf("%8s %8x %8x %s\n", "-", 0x100, 0x70, "CODE") +
+		fmt.Sprintf("%8s %8x %8x %s\n", "-", 0x100, 0x10, "        "+archive+"(dup.o):(dup)") +
+		fmt.Sprintf("%8s %8x %8x %s\n", "-", 0x110, 0x20, "        "+archive+"(util.o):(x)") +
+		fmt.Sprintf("%8s %8x %8x %s\n", "-", 0x130, 0x40, "        "+archive+"(util.o):(y)")
+	if err := os.WriteFile(artifact.MapPath(), []byte(mapFile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(artifact.Path(), make([]byte, 1000), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	report, err := artifact.SizeReport(bazelmake.SizeByLibrary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Entries) != 1 || report.Entries[0].Name != "@a//dup:dup" || report.Entries[0].Code != 0x70 {
+		t.Fatalf("unexpected entries: %+v", report.Entries)
+	}
+	report, err = artifact.SizeReport(bazelmake.SizeBySource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Entries) != 2 {
+		t.Fatalf("unexpected entries: %+v", report.Entries)
+	}
+	member := report.Entries[0]
+	if member.Name != archive+"(util.o)" || member.Library != "@a//dup:dup" || member.Code != 0x60 {
+		t.Fatalf("unexpected entry: %+v", member)
+	}
+	expected := []string{filepath.Join(cfg.Root, "a", "dup", "x", "util.cc"), filepath.Join(cfg.Root, "a", "dup", "y", "util.cc")}
+	if got := strings.Join(member.Ambiguous, " "); got != strings.Join(expected, " ") {
+		t.Fatalf("unexpected ambiguous sources: %s", got)
+	}
+	if dup := report.Entries[1]; !strings.HasSuffix(dup.Name, "dup.cc") || len(dup.Ambiguous) != 0 {
+		t.Fatalf("unexpected entry: %+v", dup)
+	}
+}
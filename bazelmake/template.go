@@ -0,0 +1,330 @@
+package bazelmake
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// TemplateData is the model user templates configured by Config.Templates are rendered against.
+//
+// Paths of sources and headers include Config.Root, and paths of generated files include Config.OutputDirectory,
+// so they are usable from the working directory as in the generated Makefile.
+type TemplateData struct {
+	Config           *Config
+	OutputDir        string
+	Compiler         string
+	CCompiler        string
+	CompilerOptions  []string
+	CCompilerOptions []string
+	LinkerOptions    []string
+	// IncludePaths are shared by every source.
+	IncludePaths []string
+	// Artifacts are the outputs linked from Objects.
+	Artifacts []*TemplateArtifact
+	// Targets are the libraries specified by Config.Targets and the artifacts.
+	Targets []*TemplateLibrary
+	// Libraries are the transitive closure of Targets in topological order: every library follows its dependencies.
+	Libraries []*TemplateLibrary
+	// Sources are Config.Sources, which belong to no library and are linked into every artifact.
+	Sources []*TemplateSource
+	// Objects are every source to compile in the order of the generated Makefile.
+	Objects []*TemplateSource
+	// Archives are the archives in link order. They are empty unless Config.LinkMode is archives.
+	Archives []*TemplateArchive
+	// GeneratedFiles are the sorted paths of every file the build writes: objects, depfiles, archives and artifacts.
+	GeneratedFiles []string
+	// Directories are the directories of GeneratedFiles.
+	Directories []string
+	// BuildFiles are the BUILD files read to resolve the libraries.
+	BuildFiles []string
+}
+
+// TemplateLibrary is a resolved library.
+type TemplateLibrary struct {
+	// Label is the canonical label like @repo//path/to:name.
+	Label      string
+	Kind       string
+	Name       string
+	Repository string
+	Package    string
+	Sources    []*TemplateSource
+	// Headers are the existing files of hdrs and textual_hdrs.
+	Headers         []string
+	CompilerOptions []string
+	Defines         []string
+	LocalDefines    []string
+	IncludePaths    []string
+	LinkOptions     []string
+	AlwaysLink      bool
+	// Deps are the direct dependencies.
+	Deps []*TemplateLibrary
+	// Attributes are the raw attributes of the rule.
+	Attributes map[string][]string
+}
+
+// TemplateSource is a source and the object compiled from it.
+type TemplateSource struct {
+	Path    string
+	Object  string
+	Depfile string
+	IsC     bool
+	// Compiler and Options are Config.Compiler and Config.CompilerOptions or their C variants.
+	Compiler string
+	Options  []string
+	// Arguments is the complete command line compiling the source.
+	Arguments []string
+	// Library is nil for Config.Sources and the sources of artifacts.
+	Library *TemplateLibrary
+}
+
+// TemplateArtifact is an output of the build.
+type TemplateArtifact struct {
+	Name string
+	Kind ArtifactKind
+	Path string
+	// Targets are Config.Targets and the targets of the artifact.
+	Targets []*TemplateLibrary
+	// Sources are the sources of the artifact compiled with its compiler options.
+	Sources []*TemplateSource
+	// Libraries are the transitive closure of Targets in topological order.
+	Libraries []*TemplateLibrary
+	// Inputs are the objects and archives linked into Path.
+	Inputs []string
+	// LinkOptions are the filtered linkopts of Libraries in link order.
+	LinkOptions []string
+	// Arguments is the complete command line linking or archiving the artifact.
+	Arguments []string
+}
+
+// TemplateArchive is the static archive of a library.
+type TemplateArchive struct {
+	Path      string
+	Library   *TemplateLibrary
+	Objects   []string
+	Arguments []string
+}
+
+// templateFuncs are the helper functions available in user templates.
+//
+//	join SEP LIST        joins LIST with SEP
+//	prefix P LIST        prepends P to each element, e.g. prefix "-I" .IncludePaths
+//	suffix S LIST        appends S to each element
+//	quote S              quotes S for POSIX shells if needed
+//	shell LIST           quotes and joins LIST as a shell command line
+//	make S               escapes $ in Makefile recipes
+//	ninjaPath S          escapes S in ninja build statements
+//	ninjaValue S         escapes S in ninja variables
+//	cmake S              quotes S as a CMake argument
+//	json V               encodes V as JSON
+//	dir, base, ext       as in path/filepath
+//	trimExt S            removes the extension of S
+//	rel BASE TARGET      returns TARGET relative to BASE
+var templateFuncs = template.FuncMap{
+	"join": func(sep string, list []string) string {
+		return strings.Join(list, sep)
+	},
+	"prefix": func(prefix string, list []string) []string {
+		ret := make([]string, 0, len(list))
+		for _, v := range list {
+			ret = append(ret, prefix+v)
+		}
+		return ret
+	},
+	"suffix": func(suffix string, list []string) []string {
+		ret := make([]string, 0, len(list))
+		for _, v := range list {
+			ret = append(ret, v+suffix)
+		}
+		return ret
+	},
+	"quote": func(s string) string {
+		return shellCommand([]string{s})
+	},
+	"shell":      shellCommand,
+	"make":       makeEscape,
+	"ninjaPath":  ninjaPath,
+	"ninjaValue": ninjaValue,
+	"cmake":      cmakeArgument,
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	},
+	"dir":  filepath.Dir,
+	"base": filepath.Base,
+	"ext":  filepath.Ext,
+	"trimExt": func(s string) string {
+		return strings.TrimSuffix(s, filepath.Ext(s))
+	},
+	"rel": filepath.Rel,
+}
+
+// NewTemplateData creates the model of project.
+func NewTemplateData(project *Project) *TemplateData {
+	cfg := project.Config
+	data := &TemplateData{
+		Config:           cfg,
+		OutputDir:        cfg.OutputDirectory(),
+		Compiler:         cfg.Compiler,
+		CCompiler:        project.CCompiler(),
+		CompilerOptions:  cfg.CompilerOptions,
+		CCompilerOptions: project.CCompilerOptions(),
+		LinkerOptions:    cfg.LinkerOptions,
+		IncludePaths:     project.IncludePaths,
+		BuildFiles:       project.BuildFiles,
+	}
+	libMap := make(map[*CCLibrary]*TemplateLibrary)
+	order := linkOrder(project.Targets)
+	for i := len(order) - 1; i >= 0; i-- {
+		lib := order[i]
+		tlib := &TemplateLibrary{
+			Label:           lib.FQDN(),
+			Kind:            lib.Kind,
+			Name:            lib.Name,
+			Repository:      lib.File.Library.Name,
+			Package:         lib.File.Path,
+			Headers:         lib.DeclaredHeaderPaths(cfg.Root),
+			CompilerOptions: lib.CompilerOptions(),
+			Defines:         lib.Defines,
+			LocalDefines:    lib.LocalDefines,
+			IncludePaths:    lib.IncludePaths(cfg.Root),
+			LinkOptions:     project.LibraryLinkOptions(lib),
+			AlwaysLink:      lib.AlwaysLink,
+			Attributes:      lib.Attributes,
+		}
+		for _, dep := range lib.ResolvedDependencies {
+			tlib.Deps = append(tlib.Deps, libMap[dep])
+		}
+		libMap[lib] = tlib
+		data.Libraries = append(data.Libraries, tlib)
+	}
+	for _, lib := range project.Targets {
+		data.Targets = append(data.Targets, libMap[lib])
+	}
+	var generated []string
+	srcMap := make(map[*Object]*TemplateSource)
+	for _, obj := range project.Objects {
+		compiler := cfg.Compiler
+		options := cfg.CompilerOptions
+		if obj.IsC() {
+			compiler = project.CCompiler()
+			options = project.CCompilerOptions()
+		}
+		src := &TemplateSource{
+			Path:      obj.Source,
+			Object:    obj.Path(),
+			Depfile:   obj.DepfilePath(),
+			IsC:       obj.IsC(),
+			Compiler:  compiler,
+			Options:   options,
+			Arguments: project.CompileArguments(obj),
+		}
+		srcMap[obj] = src
+		if obj.Library == nil {
+			if obj.Artifact == nil {
+				data.Sources = append(data.Sources, src)
+			}
+		} else {
+			src.Library = libMap[obj.Library]
+			src.Library.Sources = append(src.Library.Sources, src)
+		}
+		data.Objects = append(data.Objects, src)
+		generated = append(generated, src.Object, src.Depfile)
+	}
+	for _, archive := range project.Archives {
+		tarchive := &TemplateArchive{
+			Path:      archive.Path(),
+			Library:   libMap[archive.Library],
+			Arguments: project.ArchiveArguments(archive),
+		}
+		for _, obj := range archive.Objects {
+			tarchive.Objects = append(tarchive.Objects, obj.Path())
+		}
+		data.Archives = append(data.Archives, tarchive)
+		generated = append(generated, tarchive.Path)
+	}
+	for _, artifact := range project.Artifacts {
+		tartifact := &TemplateArtifact{
+			Name:        artifact.Name(),
+			Kind:        artifact.Kind(),
+			Path:        artifact.Path(),
+			Inputs:      artifact.LinkInputs(),
+			LinkOptions: artifact.LinkOptions,
+			Arguments:   artifact.LinkArguments(),
+		}
+		for _, lib := range artifact.Targets {
+			tartifact.Targets = append(tartifact.Targets, libMap[lib])
+		}
+		for _, obj := range artifact.sources {
+			tartifact.Sources = append(tartifact.Sources, srcMap[obj])
+		}
+		order := linkOrder(artifact.Targets)
+		for i := len(order) - 1; i >= 0; i-- {
+			tartifact.Libraries = append(tartifact.Libraries, libMap[order[i]])
+		}
+		data.Artifacts = append(data.Artifacts, tartifact)
+		generated = append(generated, tartifact.Path)
+	}
+	sort.Strings(generated)
+	data.GeneratedFiles = generated
+	data.Directories = project.Directories()
+	return data
+}
+
+// RenderTemplate renders the template file at path against the model of cfg.
+func RenderTemplate(cfg *Config, path string) ([]byte, error) {
+	project, err := NewProject(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return renderTemplate(NewTemplateData(project), path)
+}
+
+func renderTemplate(data *TemplateData, path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderTemplates renders every template of Config.Templates and writes the results.
+func RenderTemplates(cfg *Config) error {
+	if len(cfg.Templates) == 0 {
+		return fmt.Errorf("no templates are configured")
+	}
+	project, err := NewProject(cfg)
+	if err != nil {
+		return err
+	}
+	data := NewTemplateData(project)
+	for _, t := range cfg.Templates {
+		content, err := renderTemplate(data, cfg.resolvePath(t.Path))
+		if err != nil {
+			return fmt.Errorf("failed to render %s: %w", t.Path, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(t.Output), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(t.Output, content, 0o600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
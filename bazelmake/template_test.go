@@ -0,0 +1,58 @@
+package bazelmake_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	cfg := createDefinesWorkspace(t)
+	path := filepath.Join(t.TempDir(), "libs.tmpl")
+	tmpl := `{{- range .Libraries }}
+{{ .Label }}: {{ range .Deps }}{{ .Label }} {{ end }}
+{{- range .Sources }}
+  {{ rel $.Config.Root .Path }} -> {{ .Object }}
+{{- end }}
+{{- end }}
+{{ join " " (prefix "-D" (index .Libraries 4).Defines) }}
+{{ shell (list "a b") }}
+`
+	// list is not a helper, so parsing must fail.
+	if err := os.WriteFile(path, []byte(tmpl), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bazelmake.RenderTemplate(cfg, path); err == nil {
+		t.Fatal("expected error")
+	}
+	tmpl = strings.Replace(tmpl, `{{ shell (list "a b") }}`, `{{ quote "a b" }}`, 1)
+	if err := os.WriteFile(path, []byte(tmpl), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	content, err := bazelmake.RenderTemplate(cfg, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+@b//base:log: 
+  b/base/log.cc -> out/b/base/_objs/log/log.o
+@a//lib:util: @b//base:log 
+  a/lib/util.cc -> out/a/lib/_objs/util/util.o
+@b//base:base: @b//base:log 
+  b/base/base.cc -> out/b/base/_objs/base/base.o
+@a//lib:lib: @a//lib:util @b//base:base 
+  a/lib/lib.cc -> out/a/lib/_objs/lib/lib.o
+@b//defs:defs: @b//base:base 
+  b/defs/defs.cc -> out/b/defs/_objs/defs/defs.o
+@a//app:app: @a//lib:lib @b//defs:defs 
+  a/app/app.cc -> out/a/app/_objs/app/app.o
+-DDEFS
+'a b'
+`
+	if string(content) != expected {
+		t.Fatalf("unexpected output:\nexpected %q\ngot      %q", expected, content)
+	}
+}
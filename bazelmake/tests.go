@@ -0,0 +1,421 @@
+package bazelmake
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// WithTests returns a copy of the config building the cc_test targets matching the label pattern as wasm executables.
+// Every test becomes an artifact written to tests/<repository>/<package>/<name>.wasm in the output directory,
+// and Targets, Sources, Bind and the exports of Wasm are dropped because they belong to the configured artifacts.
+func (c *Config) WithTests(pattern string) (*Config, error) {
+	if _, _, _, err := parseLabelPattern(pattern); err != nil {
+		return nil, err
+	}
+	resolver := NewResolver(c)
+	if _, err := resolver.Resolve(); err != nil {
+		return nil, err
+	}
+	var (
+		tests      []*CCLibrary
+		unresolved []string
+	)
+	for _, lib := range resolver.Libraries() {
+		if lib.Kind != "cc_test" || !matchLabelPattern(pattern, lib) {
+			continue
+		}
+		if len(lib.UnresolvedDependencies) != 0 {
+			unresolved = append(unresolved, fmt.Sprintf("%s: %s", lib.FQDN(), strings.Join(lib.UnresolvedDependencies, ", ")))
+			continue
+		}
+		tests = append(tests, lib)
+	}
+	if len(unresolved) != 0 {
+		return nil, fmt.Errorf("failed to resolve the deps of tests:\n%s", strings.Join(unresolved, "\n"))
+	}
+	if len(tests) == 0 {
+		return nil, fmt.Errorf("no cc_test matches %s", pattern)
+	}
+	ret := *c
+	ret.Targets = nil
+	ret.Sources = nil
+	ret.Output = ""
+	ret.Bind = nil
+	ret.Templates = nil
+	ret.postLink = nil
+	if c.Wasm != nil {
+		wasm := *c.Wasm
+		wasm.ExecModel = ExecModelCommand
+		wasm.Exports = nil
+		wasm.ExportsFile = ""
+		wasm.ExportPatterns = nil
+		wasm.MapFile = false
+		wasm.PostLink = nil
+		ret.Wasm = &wasm
+	}
+	ret.Artifacts = nil
+	for _, test := range tests {
+		ret.Artifacts = append(ret.Artifacts, &ArtifactConfig{
+			Name:   test.FQDN(),
+			Output: filepath.Join("tests", test.File.Library.Name, test.File.Path, test.Name+".wasm"),
+			Kind:   ArtifactExecutable,
+			Targets: []*BuildTargetLibraryConfig{
+				{Library: test.File.Library.Name, Path: test.File.Path, Name: test.Name},
+			},
+		})
+	}
+	return &ret, nil
+}
+
+// TestStatus is the outcome of a test shard.
+type TestStatus string
+
+const (
+	TestPassed TestStatus = "PASSED"
+	TestFailed TestStatus = "FAILED"
+	// TestTimeout means the shard ran longer than the timeout of the test.
+	TestTimeout TestStatus = "TIMEOUT"
+	// TestError means the shard could not run, for example because the module failed to compile.
+	TestError TestStatus = "ERROR"
+)
+
+// TestOption configures RunTests.
+type TestOption struct {
+	// Jobs is the number of tests run in parallel. It defaults to the number of CPUs.
+	Jobs int
+	// Timeout overrides the timeout decided by the size and timeout attributes of the tests.
+	Timeout time.Duration
+}
+
+// TestResult is the result of a cc_test.
+type TestResult struct {
+	Test   *CCLibrary
+	Shards []*TestShardResult
+}
+
+// Status returns the worst status of the shards.
+func (r *TestResult) Status() TestStatus {
+	ret := TestPassed
+	for _, shard := range r.Shards {
+		switch shard.Status {
+		case TestError:
+			return TestError
+		case TestTimeout:
+			ret = TestTimeout
+		case TestFailed:
+			if ret == TestPassed {
+				ret = TestFailed
+			}
+		}
+	}
+	return ret
+}
+
+// Duration returns the total time of the shards.
+func (r *TestResult) Duration() time.Duration {
+	var ret time.Duration
+	for _, shard := range r.Shards {
+		ret += shard.Duration
+	}
+	return ret
+}
+
+// TestShardResult is the result of a run of a test. Tests without shard_count run as the single shard.
+type TestShardResult struct {
+	Index    int
+	Total    int
+	Status   TestStatus
+	ExitCode uint32
+	// Message describes why the shard did not pass.
+	Message  string
+	Duration time.Duration
+	// Output is the stdout and the stderr of the shard.
+	Output []byte
+}
+
+// testTimeouts are the timeouts of the timeout attribute. The size attribute selects them as Bazel does.
+var testTimeouts = map[string]time.Duration{
+	"short":    time.Minute,
+	"moderate": 5 * time.Minute,
+	"long":     15 * time.Minute,
+	"eternal":  time.Hour,
+}
+
+var testSizeTimeouts = map[string]string{
+	"small":    "short",
+	"medium":   "moderate",
+	"large":    "long",
+	"enormous": "eternal",
+}
+
+// testTimeout returns the timeout of the test. It defaults to the timeout of the medium size.
+func testTimeout(test *CCLibrary) time.Duration {
+	timeout := "moderate"
+	if size := test.Attributes["size"]; len(size) != 0 {
+		if t, exists := testSizeTimeouts[size[0]]; exists {
+			timeout = t
+		}
+	}
+	if t := test.Attributes["timeout"]; len(t) != 0 {
+		if _, exists := testTimeouts[t[0]]; exists {
+			timeout = t[0]
+		}
+	}
+	return testTimeouts[timeout]
+}
+
+// testShardCount returns the shard_count of the test or 1.
+func testShardCount(test *CCLibrary) (int, error) {
+	count := test.Attributes["shard_count"]
+	if len(count) == 0 {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(count[0])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s: unexpected shard_count: %s", test.FQDN(), count[0])
+	}
+	return n, nil
+}
+
+// testRunfiles is the directory the repositories are mounted on as the runfiles of Bazel.
+const testRunfiles = "/runfiles"
+
+// testDataPath returns the path of a data entry or an argument like $(location testdata/a.txt) relative to the repository.
+// It returns false for the labels of rules, which are not files.
+func testDataPath(test *CCLibrary, label string) (string, bool) {
+	switch {
+	case strings.HasPrefix(label, "@"):
+		return "", false
+	case strings.HasPrefix(label, "//"):
+		label = strings.Replace(strings.TrimPrefix(label, "//"), ":", "/", 1)
+		return label, true
+	case strings.HasPrefix(label, ":"):
+		label = label[1:]
+	}
+	if strings.Contains(label, ":") {
+		return "", false
+	}
+	return filepath.ToSlash(filepath.Join(test.File.Path, label)), true
+}
+
+// testArgs returns the args of the test with $(location), $(rootpath) and $(execpath) expanded to the paths in the repository.
+func testArgs(test *CCLibrary) []string {
+	ret := make([]string, 0, len(test.Attributes["args"]))
+	for _, arg := range test.Attributes["args"] {
+		for _, fn := range []string{"location", "locations", "rootpath", "rootpaths", "execpath", "execpaths"} {
+			prefix := "$(" + fn + " "
+			for {
+				start := strings.Index(arg, prefix)
+				if start < 0 {
+					break
+				}
+				end := strings.Index(arg[start:], ")")
+				if end < 0 {
+					break
+				}
+				label := strings.TrimSpace(arg[start+len(prefix) : start+end])
+				p, _ := testDataPath(test, label)
+				arg = arg[:start] + p + arg[start+end+1:]
+			}
+		}
+		ret = append(ret, arg)
+	}
+	return ret
+}
+
+// checkTestData reports the data files of the test which do not exist.
+func checkTestData(root string, test *CCLibrary) error {
+	var missing []string
+	for _, data := range test.Attributes["data"] {
+		if strings.HasPrefix(data, "@") || strings.Contains(data, ":") {
+			// labels may refer to rules like filegroup.
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(root, test.File.Library.Root, test.File.Path, data)); err != nil {
+			missing = append(missing, data)
+		}
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("missing data files: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// RunTests runs the cc_test artifacts of the project created from WithTests with wazero and returns the results in the order of the artifacts.
+// The root directory of a test is its repository, which is also mounted on /runfiles/<repository> with the others,
+// and get the environment variables of the Bazel test encyclopedia like TEST_SRCDIR, TEST_TMPDIR and TEST_SHARD_INDEX.
+// The shards of a test run one after another with the timeout of the test each.
+func RunTests(ctx context.Context, project *Project, opt *TestOption) ([]*TestResult, error) {
+	if opt == nil {
+		opt = &TestOption{}
+	}
+	if project.Config.Threads != nil {
+		return nil, fmt.Errorf("tests cannot run in the threads mode because wazero does not support wasi-threads")
+	}
+	jobs := opt.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	var artifacts []*Artifact
+	for _, artifact := range project.Artifacts {
+		if len(artifact.Targets) == 1 && artifact.Targets[0].Kind == "cc_test" {
+			artifacts = append(artifacts, artifact)
+		}
+	}
+	results := make([]*TestResult, len(artifacts))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, artifact := range artifacts {
+		wg.Add(1)
+		go func(i int, artifact *Artifact) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = runTest(ctx, project.Config, artifact, opt)
+		}(i, artifact)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+func runTest(ctx context.Context, cfg *Config, artifact *Artifact, opt *TestOption) *TestResult {
+	test := artifact.Targets[0]
+	ret := &TestResult{Test: test}
+	fail := func(err error) *TestResult {
+		ret.Shards = []*TestShardResult{{Total: 1, Status: TestError, Message: err.Error()}}
+		return ret
+	}
+	shards, err := testShardCount(test)
+	if err != nil {
+		return fail(err)
+	}
+	if err := checkTestData(cfg.Root, test); err != nil {
+		return fail(err)
+	}
+	wasm, err := os.ReadFile(artifact.Path())
+	if err != nil {
+		return fail(err)
+	}
+	timeout := testTimeout(test)
+	if opt.Timeout > 0 {
+		timeout = opt.Timeout
+	}
+	for i := 0; i < shards; i++ {
+		ret.Shards = append(ret.Shards, runTestShard(ctx, cfg, test, wasm, i, shards, timeout))
+	}
+	return ret
+}
+
+func runTestShard(ctx context.Context, cfg *Config, test *CCLibrary, wasm []byte, index, total int, timeout time.Duration) *TestShardResult {
+	ret := &TestShardResult{Index: index, Total: total}
+	tmpDir, err := os.MkdirTemp("", "bazelmake-test-")
+	if err != nil {
+		ret.Status = TestError
+		ret.Message = err.Error()
+		return ret
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	defer r.Close(context.Background())
+	wasi_snapshot_preview1.MustInstantiate(ctx, r)
+	mod, err := r.CompileModule(ctx, wasm)
+	if err != nil {
+		ret.Status = TestError
+		ret.Message = err.Error()
+		return ret
+	}
+
+	repo := test.File.Library.Name
+	fsConfig := wazero.NewFSConfig().
+		WithReadOnlyDirMount(filepath.Join(cfg.Root, test.File.Library.Root), "/").
+		WithDirMount(tmpDir, "/tmp")
+	for _, lib := range cfg.Libraries {
+		if lib.Root != "" {
+			fsConfig = fsConfig.WithReadOnlyDirMount(filepath.Join(cfg.Root, lib.Root), testRunfiles+"/"+lib.Name)
+		}
+	}
+	var output bytes.Buffer
+	modConfig := wazero.NewModuleConfig().
+		WithArgs(append([]string{test.Name}, testArgs(test)...)...).
+		WithStdout(&output).
+		WithStderr(&output).
+		WithFSConfig(fsConfig).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithSysNanosleep()
+	env := map[string]string{
+		"TEST_SRCDIR":        testRunfiles,
+		"TEST_WORKSPACE":     repo,
+		"TEST_TARGET":        test.FQDN(),
+		"TEST_TMPDIR":        "/tmp",
+		"TEST_TOTAL_SHARDS":  strconv.Itoa(total),
+		"TEST_SHARD_INDEX":   strconv.Itoa(index),
+		"GTEST_TOTAL_SHARDS": strconv.Itoa(total),
+		"GTEST_SHARD_INDEX":  strconv.Itoa(index),
+	}
+	if total == 1 {
+		for _, key := range []string{"TEST_TOTAL_SHARDS", "TEST_SHARD_INDEX", "GTEST_TOTAL_SHARDS", "GTEST_SHARD_INDEX"} {
+			delete(env, key)
+		}
+	}
+	for _, kv := range test.Attributes["env"] {
+		if k, v, found := strings.Cut(kv, "="); found {
+			env[k] = v
+		}
+	}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		modConfig = modConfig.WithEnv(k, env[k])
+	}
+
+	start := time.Now()
+	_, err = r.InstantiateModule(ctx, mod, modConfig)
+	ret.Duration = time.Since(start)
+	ret.Output = output.Bytes()
+	var exitErr *sys.ExitError
+	switch {
+	case err == nil:
+		ret.Status = TestPassed
+	case errors.Is(err, context.DeadlineExceeded):
+		ret.Status = TestTimeout
+		ret.Message = fmt.Sprintf("timed out after %s", timeout)
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 0:
+		ret.Status = TestPassed
+	case errors.As(err, &exitErr) && exitErr.ExitCode() != sys.ExitCodeContextCanceled:
+		ret.Status = TestFailed
+		ret.ExitCode = exitErr.ExitCode()
+		ret.Message = fmt.Sprintf("exit code %d", exitErr.ExitCode())
+	default:
+		// traps like unreachable from abort() fail the test, the others could not run it.
+		ret.Status = TestFailed
+		if errors.As(err, &exitErr) {
+			ret.Status = TestError
+		}
+		ret.Message = err.Error()
+	}
+	return ret
+}
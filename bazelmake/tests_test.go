@@ -0,0 +1,159 @@
+package bazelmake_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+// wasiCommand returns a module whose _start exits with the count written by a WASI function like environ_sizes_get.
+// The module returns from _start without calling anything if fn is empty.
+func wasiCommand(fn string) []byte {
+	const wasi = "wasi_snapshot_preview1"
+	imports := []byte{2}
+	for _, imp := range []struct {
+		name string
+		typ  byte
+	}{{name: fn, typ: 0}, {name: "proc_exit", typ: 1}} {
+		imports = append(imports, byte(len(wasi)))
+		imports = append(imports, wasi...)
+		imports = append(imports, byte(len(imp.name)))
+		imports = append(imports, imp.name...)
+		imports = append(imports, 0x00, imp.typ)
+	}
+	body := []byte{0x00, 0x41, 0, 0x41, 4, 0x10, 0, 0x1a, 0x41, 0, 0x28, 2, 0, 0x10, 1, 0x0b}
+	start := byte(2)
+	if fn == "" {
+		imports = []byte{0}
+		body = []byte{0x00, 0x0b}
+		start = 0
+	}
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	for _, sec := range [][]byte{
+		wasmSection(1, 3, 0x60, 2, 0x7f, 0x7f, 1, 0x7f, 0x60, 1, 0x7f, 0, 0x60, 0, 0),
+		wasmSection(2, imports...),
+		wasmSection(3, 1, 2),
+		wasmSection(5, 1, 0x00, 1),
+		wasmSection(7, 2, 6, '_', 's', 't', 'a', 'r', 't', 0x00, start, 6, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0),
+		wasmSection(10, append([]byte{1, byte(len(body))}, body...)...),
+	} {
+		module = append(module, sec...)
+	}
+	return module
+}
+
+func TestRunTests(t *testing.T) {
+	cfg := createWorkspace(t, map[string]string{
+		"a/tests/testdata/in.txt": "",
+		"a/tests/BUILD": `
+cc_test(
+    name = "args_test",
+    srcs = ["args_test.cc"],
+    args = [
+        "--input=$(location testdata/in.txt)",
+        "--verbose",
+    ],
+    data = ["testdata/in.txt"],
+    size = "small",
+    deps = ["//lib"],
+)
+
+cc_test(
+    name = "env_test",
+    srcs = ["env_test.cc"],
+    env = {"FOO": "bar"},
+    shard_count = 2,
+)
+
+cc_test(
+    name = "pass_test",
+    srcs = ["pass_test.cc"],
+)
+
+cc_test(
+    name = "data_test",
+    srcs = ["data_test.cc"],
+    data = ["testdata/missing.txt"],
+)
+
+cc_binary(
+    name = "tool",
+    srcs = ["tool.cc"],
+)
+`,
+		"a/broken/BUILD": `
+cc_test(
+    name = "broken_test",
+    srcs = ["broken_test.cc"],
+    deps = ["//lib:missing"],
+)
+`,
+	})
+	cfg.OutputDir = filepath.Join(t.TempDir(), "out")
+	if _, err := cfg.WithTests("//broken/..."); err == nil || !strings.Contains(err.Error(), "@a//broken:broken_test: //lib:missing") {
+		t.Fatalf("expected unresolved deps error: %v", err)
+	}
+	if _, err := cfg.WithTests("//tests:tool"); err == nil {
+		t.Fatal("expected error for cc_binary")
+	}
+	testCfg, err := cfg.WithTests("//tests:all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	project := newProject(t, testCfg)
+	modules := map[string][]byte{
+		"args_test": wasiCommand("args_sizes_get"),
+		"env_test":  wasiCommand("environ_sizes_get"),
+		"pass_test": wasiCommand(""),
+		"data_test": wasiCommand(""),
+	}
+	var outputs []string
+	for _, artifact := range project.Artifacts {
+		outputs = append(outputs, artifact.Config.Output)
+		if err := os.MkdirAll(filepath.Dir(artifact.Path()), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(artifact.Path(), modules[artifact.Targets[0].Name], 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := "tests/a/tests/args_test.wasm tests/a/tests/data_test.wasm tests/a/tests/env_test.wasm tests/a/tests/pass_test.wasm"
+	if got := strings.Join(outputs, " "); got != expected {
+		t.Fatalf("unexpected outputs: %s", got)
+	}
+	results, err := bazelmake.RunTests(context.Background(), project, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, result := range results {
+		for _, shard := range result.Shards {
+			got = append(got, fmt.Sprintf("%s/%d:%s:%d", result.Test.Name, shard.Index, shard.Status, shard.ExitCode))
+		}
+	}
+	// args_test gets its name and two args, env_test nine variables with FOO and the shard ones.
+	expected = "args_test/0:FAILED:3 data_test/0:ERROR:0 env_test/0:FAILED:9 env_test/1:FAILED:9 pass_test/0:PASSED:0"
+	if got := strings.Join(got, " "); got != expected {
+		t.Fatalf("unexpected results:\nexpected %s\ngot      %s", expected, got)
+	}
+	var report bytes.Buffer
+	if err := bazelmake.WriteJUnitReport(&report, results); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<testsuites tests="5" failures="3" errors="1"`,
+		`<testsuite name="@a//tests:env_test" tests="2" failures="2" errors="0"`,
+		`<testcase name="env_test (shard 2 of 2)" classname="@a//tests:env_test"`,
+		`<error message="missing data files: testdata/missing.txt" type="ERROR">`,
+	} {
+		if !strings.Contains(report.String(), want) {
+			t.Fatalf("%s is not found in the report:\n%s", want, report.String())
+		}
+	}
+}
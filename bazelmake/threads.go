@@ -0,0 +1,125 @@
+package bazelmake
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ThreadsConfig builds wasm32 with threads: atomics, bulk memory, the shared memory imported from the host and the wasi-threads sysroot.
+type ThreadsConfig struct {
+	// Allow are label patterns of the libraries allowed to take the single-threaded select() branches,
+	// like the ones dropping only -pthread, which the threads mode adds anyway.
+	Allow []string `yaml:"allow"`
+}
+
+func (c *ThreadsConfig) validate() error {
+	for _, pattern := range c.Allow {
+		if _, _, _, err := parseLabelPattern(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *ThreadsConfig) allows(lib *CCLibrary) bool {
+	for _, pattern := range c.Allow {
+		if matchLabelPattern(pattern, lib) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	threadsCompilerOptions = []string{"-pthread", "-matomics", "-mbulk-memory"}
+	// the shared memory must be imported so that the threads spawned by the host share it, and it requires the maximum size.
+	threadsLinkerOptions = []string{
+		"-pthread",
+		"-Wl,--shared-memory",
+		"-Wl,--import-memory",
+		"-Wl,--export-memory",
+		"-Wl,--max-memory=4294967296",
+	}
+)
+
+// withThreads returns a copy of the config with the options of the threads mode which are not configured yet.
+func (c *Config) withThreads() *Config {
+	if c.Threads == nil {
+		return c
+	}
+	ret := *c
+	ret.CompilerOptions = appendMissingOptions(c.CompilerOptions, threadsCompilerOptions)
+	ret.CCompilerOptions = appendMissingOptions(c.CCompilerOptions, threadsCompilerOptions)
+	ret.LinkerOptions = appendMissingOptions(c.LinkerOptions, threadsLinkerOptions)
+	return &ret
+}
+
+func appendMissingOptions(options, added []string) []string {
+	ret := append([]string{}, options...)
+	exists := make(map[string]struct{}, len(options))
+	for _, opt := range options {
+		exists[opt] = struct{}{}
+	}
+	for _, opt := range added {
+		if _, found := exists[opt]; !found {
+			ret = append(ret, opt)
+		}
+	}
+	return ret
+}
+
+// emulatesPthread reports whether opt links the single-threaded pthread emulation of wasi-libc.
+func emulatesPthread(opt string) bool {
+	return opt == "_WASI_EMULATED_PTHREAD" || opt == "-D_WASI_EMULATED_PTHREAD" || opt == "-lwasi-emulated-pthread"
+}
+
+// withoutPthreadEmulation returns the options except the ones of emulatesPthread.
+func withoutPthreadEmulation(options []string) []string {
+	var ret []string
+	for _, opt := range options {
+		if !emulatesPthread(opt) {
+			ret = append(ret, opt)
+		}
+	}
+	return ret
+}
+
+// checkThreads reports what keeps the closure from running with threads:
+// targets of single-threaded WASI, compat rules emulating pthread and libraries taking single-threaded select() branches.
+func (p *Project) checkThreads() error {
+	threads := p.Config.Threads
+	if threads == nil {
+		return nil
+	}
+	var conflicts []string
+	for _, opt := range append(append([]string{}, p.Config.CompilerOptions...), p.Config.LinkerOptions...) {
+		if target := strings.TrimPrefix(opt, "--target="); target != opt && strings.HasPrefix(target, "wasm32-wasi") && !strings.HasSuffix(target, "-threads") {
+			conflicts = append(conflicts, fmt.Sprintf("%s targets single-threaded WASI", opt))
+		}
+	}
+	for _, rule := range p.Config.Compat {
+		if rule.Preset != "" {
+			continue
+		}
+		options := append(append(append([]string{}, rule.Defines...), rule.CompilerOptions...), rule.LinkerOptions...)
+		for _, opt := range options {
+			if emulatesPthread(opt) {
+				conflicts = append(conflicts, fmt.Sprintf("compat rule %s emulates pthread with %s", rule.Label, opt))
+			}
+		}
+	}
+	for _, lib := range p.Libraries {
+		if threads.allows(lib) {
+			continue
+		}
+		for _, cond := range lib.SingleThreadedConditions {
+			conflicts = append(conflicts, fmt.Sprintf("%s selects the single-threaded branch of %s", lib.FQDN(), cond))
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	sort.Strings(conflicts)
+	return fmt.Errorf("incompatible with threads:\n%s", strings.Join(conflicts, "\n"))
+}
@@ -0,0 +1,86 @@
+package bazelmake_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+func TestThreads(t *testing.T) {
+	t.Run("toolchain", func(t *testing.T) {
+		sdk := t.TempDir()
+		t.Setenv("WASI_SDK_PATH", sdk)
+		cfg := createWorkspace(t)
+		cfg.Compiler = ""
+		cfg.Toolchain = &bazelmake.ToolchainConfig{Preset: "wasi-sdk"}
+		cfg.Threads = &bazelmake.ThreadsConfig{}
+		cfg.Compat = []*bazelmake.CompatConfig{{Preset: "wasi-posix"}}
+		cfg, err := cfg.WithToolchain()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sysroot := "--sysroot=" + filepath.Join(sdk, "share", "wasi-sysroot")
+		if got := strings.Join(cfg.CompilerOptions, " "); got != "--target=wasm32-wasi-threads "+sysroot+" -pthread -matomics -mbulk-memory" {
+			t.Fatalf("unexpected compiler options: %s", got)
+		}
+		expected := "--target=wasm32-wasi-threads " + sysroot + " -pthread -Wl,--import-memory -Wl,--export-memory " +
+			"-Wl,--max-memory=4294967296 -Wl,--shared-memory"
+		if got := strings.Join(cfg.LinkerOptions, " "); got != expected {
+			t.Fatalf("unexpected linker options: %s", got)
+		}
+		project := newProject(t, cfg)
+		// the wasi-posix preset does not emulate pthread with threads.
+		if got := strings.Join(project.Artifacts[0].LinkOptions, " "); !strings.Contains(got, "-lwasi-emulated-signal") || strings.Contains(got, "-lwasi-emulated-pthread") {
+			t.Fatalf("unexpected linkopts: %s", got)
+		}
+	})
+	t.Run("unsupported toolchain", func(t *testing.T) {
+		cfg := createWorkspace(t)
+		cfg.Toolchain = &bazelmake.ToolchainConfig{Preset: "clang-wasm32-unknown"}
+		cfg.Threads = &bazelmake.ThreadsConfig{}
+		if _, err := cfg.WithToolchain(); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+	t.Run("check", func(t *testing.T) {
+		cfg := createWorkspace(t)
+		build := `
+cc_library(
+    name = "lib",
+    srcs = ["lib.cc"],
+    linkopts = select({
+        ":wasm": [],
+        "//conditions:default": ["-pthread"],
+    }),
+    deps = ["@b//base"],
+)
+`
+		if err := os.WriteFile(filepath.Join(cfg.Root, "a", "lib", "BUILD"), []byte(build), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cfg.Conditions = []string{":wasm"}
+		cfg.CompilerOptions = []string{"--target=wasm32-wasi"}
+		cfg.Threads = &bazelmake.ThreadsConfig{}
+		cfg.Compat = []*bazelmake.CompatConfig{{Label: "@b//...", Defines: []string{"_WASI_EMULATED_PTHREAD"}}}
+		_, err := bazelmake.NewProject(cfg)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		expected := "incompatible with threads:\n" +
+			"--target=wasm32-wasi targets single-threaded WASI\n" +
+			"@a//lib:lib selects the single-threaded branch of :wasm\n" +
+			"compat rule @b//... emulates pthread with _WASI_EMULATED_PTHREAD"
+		if err.Error() != expected {
+			t.Fatalf("unexpected error:\nexpected %s\ngot      %s", expected, err)
+		}
+		cfg.CompilerOptions = nil
+		cfg.Compat = nil
+		cfg.Threads.Allow = []string{"//lib:all"}
+		if _, err := bazelmake.NewProject(cfg); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
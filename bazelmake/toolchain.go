@@ -0,0 +1,165 @@
+package bazelmake
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ToolchainConfig selects a built-in toolchain preset.
+// The compilers, the archiver and the options of Config take precedence over the preset:
+// empty ones are filled by the preset and the preset options come before the configured ones.
+type ToolchainConfig struct {
+	Preset string `yaml:"preset"`
+	// SDK is the root directory of the SDK, relative to the config file.
+	// It defaults to the environment variable of the preset.
+	SDK string `yaml:"sdk"`
+}
+
+// toolchainPreset describes the tools of an SDK. Paths are relative to the SDK root.
+type toolchainPreset struct {
+	// env names the environment variable locating the SDK.
+	env string
+	// defaultSDK is used if neither ToolchainConfig.SDK nor env is set. Empty means the tools are looked up in PATH.
+	defaultSDK string
+	// bin is the directory of the tools in the SDK.
+	bin       string
+	compiler  string
+	ccompiler string
+	archiver  string
+	target    string
+	// sysroot is passed as --sysroot if it is not empty.
+	sysroot         string
+	compilerOptions []string
+	linkerOptions   []string
+	// threads is the preset replacing this one in the threads mode. Empty means the SDK has no threads support.
+	threads string
+}
+
+var toolchainPresets = map[string]*toolchainPreset{
+	"wasi-sdk": {
+		env:        "WASI_SDK_PATH",
+		defaultSDK: "/opt/wasi-sdk",
+		bin:        "bin",
+		compiler:   "clang++",
+		ccompiler:  "clang",
+		archiver:   "llvm-ar",
+		target:     "wasm32-wasi",
+		sysroot:    "share/wasi-sysroot",
+		threads:    "wasi-sdk-threads",
+	},
+	"wasi-sdk-threads": {
+		env:             "WASI_SDK_PATH",
+		defaultSDK:      "/opt/wasi-sdk",
+		bin:             "bin",
+		compiler:        "clang++",
+		ccompiler:       "clang",
+		archiver:        "llvm-ar",
+		target:          "wasm32-wasi-threads",
+		sysroot:         "share/wasi-sysroot",
+		compilerOptions: []string{"-pthread"},
+		linkerOptions: []string{
+			"-pthread",
+			"-Wl,--import-memory",
+			"-Wl,--export-memory",
+			"-Wl,--max-memory=4294967296",
+		},
+		threads: "wasi-sdk-threads",
+	},
+	"emscripten-standalone": {
+		env:           "EMSDK",
+		bin:           "upstream/emscripten",
+		compiler:      "em++",
+		ccompiler:     "emcc",
+		archiver:      "emar",
+		linkerOptions: []string{"-sSTANDALONE_WASM"},
+	},
+	"clang-wasm32-unknown": {
+		env:       "LLVM_PATH",
+		bin:       "bin",
+		compiler:  "clang++",
+		ccompiler: "clang",
+		archiver:  "llvm-ar",
+		target:    "wasm32-unknown-unknown",
+		linkerOptions: []string{
+			"-nostdlib",
+			"-Wl,--no-entry",
+		},
+	},
+}
+
+// ToolchainPresets returns the names of the built-in toolchain presets.
+func ToolchainPresets() []string {
+	names := make([]string, 0, len(toolchainPresets))
+	for name := range toolchainPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithToolchain returns a copy of the config whose compilers, archiver and options are filled by Toolchain.
+// In the threads mode, the threads variant of the preset is used and the options of threadsCompilerOptions and threadsLinkerOptions are added.
+// It returns the config itself if neither Toolchain nor Threads is configured.
+func (c *Config) WithToolchain() (*Config, error) {
+	if c.Toolchain == nil || c.Toolchain.Preset == "" {
+		return c.withThreads(), nil
+	}
+	preset, exists := toolchainPresets[c.Toolchain.Preset]
+	if !exists {
+		return nil, fmt.Errorf("unsupported toolchain preset: %s", c.Toolchain.Preset)
+	}
+	if c.Threads != nil {
+		if preset.threads == "" {
+			return nil, fmt.Errorf("toolchain preset %s does not support threads", c.Toolchain.Preset)
+		}
+		preset = toolchainPresets[preset.threads]
+	}
+	sdk := c.Toolchain.SDK
+	if sdk != "" {
+		sdk = c.resolvePath(sdk)
+	} else if env := os.Getenv(preset.env); env != "" {
+		sdk = env
+	} else {
+		sdk = preset.defaultSDK
+	}
+	if sdk != "" {
+		if _, err := os.Stat(sdk); err != nil {
+			return nil, fmt.Errorf("failed to find the SDK of %s. specify toolchain.sdk or %s: %w", c.Toolchain.Preset, preset.env, err)
+		}
+	}
+	tool := func(name string) string {
+		if sdk == "" {
+			return name
+		}
+		return filepath.Join(sdk, preset.bin, name)
+	}
+	var options []string
+	if preset.target != "" {
+		options = append(options, "--target="+preset.target)
+	}
+	if preset.sysroot != "" && sdk != "" {
+		options = append(options, "--sysroot="+filepath.Join(sdk, preset.sysroot))
+	}
+
+	ret := *c
+	ret.Toolchain = nil
+	if ret.Compiler == "" {
+		ret.Compiler = tool(preset.compiler)
+	}
+	if ret.CCompiler == "" {
+		ret.CCompiler = tool(preset.ccompiler)
+		// the C compiler used to fall back to Compiler and its options.
+		ret.CCompilerOptions = c.CompilerOptions
+	}
+	if ret.Archiver == "" {
+		ret.Archiver = tool(preset.archiver)
+	}
+	compilerOptions := append(append([]string{}, options...), preset.compilerOptions...)
+	ret.CompilerOptions = append(append([]string{}, compilerOptions...), ret.CompilerOptions...)
+	ret.CCompilerOptions = append(append([]string{}, compilerOptions...), ret.CCompilerOptions...)
+	linkerOptions := append(append([]string{}, options...), preset.linkerOptions...)
+	ret.LinkerOptions = append(linkerOptions, ret.LinkerOptions...)
+	return ret.withThreads(), nil
+}
@@ -0,0 +1,60 @@
+package bazelmake_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+func TestToolchain(t *testing.T) {
+	t.Run("wasi-sdk", func(t *testing.T) {
+		sdk := t.TempDir()
+		t.Setenv("WASI_SDK_PATH", sdk)
+		cfg := createWorkspace(t)
+		cfg.Compiler = ""
+		cfg.CompilerOptions = []string{"-O2"}
+		cfg.LinkerOptions = []string{"-Wl,--no-entry"}
+		cfg.Toolchain = &bazelmake.ToolchainConfig{Preset: "wasi-sdk"}
+		cfg, err := cfg.WithToolchain()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Compiler != filepath.Join(sdk, "bin", "clang++") || cfg.CCompiler != filepath.Join(sdk, "bin", "clang") {
+			t.Fatalf("unexpected compilers: %s, %s", cfg.Compiler, cfg.CCompiler)
+		}
+		if cfg.Archiver != filepath.Join(sdk, "bin", "llvm-ar") {
+			t.Fatalf("unexpected archiver: %s", cfg.Archiver)
+		}
+		sysroot := "--sysroot=" + filepath.Join(sdk, "share", "wasi-sysroot")
+		if got := strings.Join(cfg.CompilerOptions, " "); got != "--target=wasm32-wasi "+sysroot+" -O2" {
+			t.Fatalf("unexpected compiler options: %s", got)
+		}
+		if got := strings.Join(cfg.CCompilerOptions, " "); got != "--target=wasm32-wasi "+sysroot+" -O2" {
+			t.Fatalf("unexpected C compiler options: %s", got)
+		}
+		if got := strings.Join(cfg.LinkerOptions, " "); got != "--target=wasm32-wasi "+sysroot+" -Wl,--no-entry" {
+			t.Fatalf("unexpected linker options: %s", got)
+		}
+	})
+	t.Run("configured compiler", func(t *testing.T) {
+		t.Setenv("EMSDK", "")
+		cfg := createWorkspace(t)
+		cfg.Toolchain = &bazelmake.ToolchainConfig{Preset: "emscripten-standalone"}
+		cfg, err := cfg.WithToolchain()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Compiler != "clang++" || cfg.CCompiler != "emcc" || cfg.Archiver != "emar" {
+			t.Fatalf("unexpected tools: %s, %s, %s", cfg.Compiler, cfg.CCompiler, cfg.Archiver)
+		}
+	})
+	t.Run("missing sdk", func(t *testing.T) {
+		cfg := createWorkspace(t)
+		cfg.Toolchain = &bazelmake.ToolchainConfig{Preset: "wasi-sdk", SDK: filepath.Join(t.TempDir(), "missing")}
+		if _, err := cfg.WithToolchain(); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -0,0 +1,217 @@
+package bazelmake
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-wasmbind-tools/wasm"
+)
+
+// ExecModel decides the entry point of a WebAssembly module.
+type ExecModel string
+
+const (
+	// ExecModelCommand runs _start once like a program. It is the default.
+	ExecModelCommand ExecModel = "command"
+	// ExecModelReactor exports _initialize and keeps the instance alive for calls of the host.
+	ExecModelReactor ExecModel = "reactor"
+	// ExecModelNoEntry links a module without an entry point.
+	ExecModelNoEntry ExecModel = "no_entry"
+)
+
+// wasmPageSize is the unit of the memory of a WebAssembly module.
+const wasmPageSize = 64 << 10
+
+// WasmLinkConfig generates the wasm-ld options of an artifact.
+type WasmLinkConfig struct {
+	ExecModel ExecModel `yaml:"exec_model"`
+	// Exports are the symbols exported by the module.
+	Exports []string `yaml:"exports"`
+	// ExportsFile lists exported symbols one per line. Empty lines and lines starting with # are ignored.
+	ExportsFile string `yaml:"exports_file"`
+	// ExportPatterns are regular expressions of exported symbols.
+	// They are matched against the global functions defined in the linked objects when the artifact is linked.
+	ExportPatterns []string `yaml:"export_patterns"`
+	// AllowUndefinedFile lists the symbols allowed to be undefined, which become imports of the module.
+	AllowUndefinedFile string `yaml:"allow_undefined_file"`
+	// InitialMemory, MaxMemory and StackSize are sizes like 16MB. The memory sizes must be multiples of 64KB.
+	InitialMemory string `yaml:"initial_memory"`
+	MaxMemory     string `yaml:"max_memory"`
+	StackSize     string `yaml:"stack_size"`
+	GrowableTable bool   `yaml:"growable_table"`
+	// MapFile writes the linker map next to the artifact, which the size command reads.
+	MapFile bool `yaml:"map_file"`
+	// PostLink optimizes and strips the linked module.
+	PostLink *PostLinkConfig `yaml:"post_link"`
+	// Imports declare how the functions left undefined by the objects are satisfied.
+	// Host imports in env must be allowed to be undefined by AllowUndefinedFile or the import_module attribute.
+	Imports []*ImportConfig `yaml:"imports"`
+}
+
+func (c *WasmLinkConfig) validate() error {
+	switch c.ExecModel {
+	case "", ExecModelCommand, ExecModelReactor, ExecModelNoEntry:
+	default:
+		return fmt.Errorf("unsupported exec_model: %s", c.ExecModel)
+	}
+	for _, size := range []struct {
+		name  string
+		value string
+		page  bool
+	}{
+		{name: "initial_memory", value: c.InitialMemory, page: true},
+		{name: "max_memory", value: c.MaxMemory, page: true},
+		{name: "stack_size", value: c.StackSize},
+	} {
+		if size.value == "" {
+			continue
+		}
+		n, err := ParseSize(size.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", size.name, err)
+		}
+		if size.page && n%wasmPageSize != 0 {
+			return fmt.Errorf("%s must be a multiple of 64KB: %s", size.name, size.value)
+		}
+	}
+	for _, pattern := range c.ExportPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid export pattern: %w", err)
+		}
+	}
+	for _, imp := range c.Imports {
+		if err := imp.validate(); err != nil {
+			return err
+		}
+	}
+	if c.PostLink != nil {
+		return c.PostLink.validate()
+	}
+	return nil
+}
+
+// wasmLinkerOptions returns the linker options of cfg.
+// The symbols of cfg.ExportsFile are read here, so the build must be regenerated when it changes.
+func wasmLinkerOptions(c *Config, cfg *WasmLinkConfig, kind ArtifactKind) ([]string, error) {
+	var ret []string
+	execModel := cfg.ExecModel
+	if execModel == "" && kind == ArtifactWasmReactor {
+		execModel = ExecModelReactor
+	}
+	switch execModel {
+	case ExecModelReactor:
+		ret = append(ret, "-mexec-model=reactor")
+	case ExecModelNoEntry:
+		ret = append(ret, "-Wl,--no-entry")
+	}
+	exports := append([]string{}, cfg.Exports...)
+	if cfg.ExportsFile != "" {
+		symbols, err := readSymbolList(c.resolvePath(cfg.ExportsFile))
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, symbols...)
+	}
+	for _, export := range exports {
+		ret = append(ret, "-Wl,--export="+export)
+	}
+	if cfg.AllowUndefinedFile != "" {
+		ret = append(ret, "-Wl,--allow-undefined-file="+c.resolvePath(cfg.AllowUndefinedFile))
+	}
+	for _, size := range []struct {
+		option string
+		value  string
+	}{
+		{option: "-Wl,--initial-memory=", value: cfg.InitialMemory},
+		{option: "-Wl,--max-memory=", value: cfg.MaxMemory},
+		{option: "-Wl,-z,stack-size=", value: cfg.StackSize},
+	} {
+		if size.value == "" {
+			continue
+		}
+		n, err := ParseSize(size.value)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, size.option+strconv.FormatInt(n, 10))
+	}
+	if cfg.GrowableTable {
+		ret = append(ret, "-Wl,--growable-table")
+	}
+	return ret, nil
+}
+
+func readSymbolList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ret []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ret = append(ret, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ExportedSymbols returns the global functions defined in the relocatable objects that match one of patterns.
+func ExportedSymbols(objects []string, patterns []string) ([]string, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	symbolMap := make(map[string]struct{})
+	for _, obj := range objects {
+		m, err := wasm.ReadFile(obj)
+		if err != nil {
+			return nil, err
+		}
+		for _, sym := range m.Symbols {
+			if sym.Kind != wasm.SymbolFunction || !sym.IsDefined() || !sym.IsGlobal() {
+				continue
+			}
+			for _, re := range res {
+				if re.MatchString(sym.Name) {
+					symbolMap[sym.Name] = struct{}{}
+					break
+				}
+			}
+		}
+	}
+	symbols := make([]string, 0, len(symbolMap))
+	for sym := range symbolMap {
+		symbols = append(symbols, sym)
+	}
+	sort.Strings(symbols)
+	return symbols, nil
+}
+
+// WriteExportsFile writes the --export options of the symbols matching patterns in objects as a response file of the compiler driver.
+func WriteExportsFile(path string, objects []string, patterns []string) error {
+	symbols, err := ExportedSymbols(objects, patterns)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, sym := range symbols {
+		fmt.Fprintf(&b, "-Wl,--export=%s\n", sym)
+	}
+	return writeFile(path, []byte(b.String()))
+}
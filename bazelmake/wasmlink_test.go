@@ -0,0 +1,82 @@
+package bazelmake_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+func TestWasmLink(t *testing.T) {
+	cfg := createWorkspace(t)
+	exportsFile := filepath.Join(t.TempDir(), "exports.txt")
+	if err := os.WriteFile(exportsFile, []byte("# exported by the host\nmalloc\n\nfree\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Wasm = &bazelmake.WasmLinkConfig{
+		ExecModel:      bazelmake.ExecModelNoEntry,
+		Exports:        []string{"run"},
+		ExportsFile:    exportsFile,
+		ExportPatterns: []string{"^api_"},
+		InitialMemory:  "1MB",
+		StackSize:      "64KB",
+		GrowableTable:  true,
+	}
+	project := newProject(t, cfg)
+	artifact := project.Artifacts[0]
+	expected := "-Wl,--no-entry -Wl,--export=run -Wl,--export=malloc -Wl,--export=free " +
+		"-Wl,--initial-memory=1048576 -Wl,-z,stack-size=65536 -Wl,--growable-table @out/example.exports"
+	if got := strings.Join(artifact.LinkerOptions(), " "); got != expected {
+		t.Fatalf("unexpected linker options:\nexpected %s\ngot      %s", expected, got)
+	}
+	args := artifact.ExportsArguments()
+	if got := strings.Join(args[:6], " "); got != "bazel2makefile exports -o out/example.exports --pattern ^api_" {
+		t.Fatalf("unexpected exports arguments: %s", got)
+	}
+	t.Run("invalid memory", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte("output: example\nwasm:\n  initial_memory: 1000KB\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bazelmake.LoadConfig(path); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestExportedSymbols(t *testing.T) {
+	// a relocatable object defining api_run and helper, and importing api_host.
+	symtab := []byte{
+		4,                                                      // count
+		0x00, 0x00, 0x00, 7, 'a', 'p', 'i', '_', 'r', 'u', 'n', // function 0 api_run
+		0x00, 0x02, 0x01, 6, 'a', 'p', 'i', '_', 'l', 'o', // local function 1 api_lo
+		0x00, 0x00, 0x02, 6, 'h', 'e', 'l', 'p', 'e', 'r', // function 2 helper
+		0x00, 0x10, 0x03, // undefined function 3
+	}
+	payload := append([]byte{7, 'l', 'i', 'n', 'k', 'i', 'n', 'g', 2, 8, byte(len(symtab))}, symtab...)
+	obj := append([]byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x00, byte(len(payload))}, payload...)
+	path := filepath.Join(t.TempDir(), "api.o")
+	if err := os.WriteFile(path, obj, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	symbols, err := bazelmake.ExportedSymbols([]string{path}, []string{"^api_", "^main$"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(symbols, " "); got != "api_run" {
+		t.Fatalf("unexpected symbols: %s", got)
+	}
+	exports := filepath.Join(t.TempDir(), "out", "app.exports")
+	if err := bazelmake.WriteExportsFile(exports, []string{path}, []string{"^api_"}); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(exports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "-Wl,--export=api_run\n" {
+		t.Fatalf("unexpected exports file: %q", content)
+	}
+}
@@ -0,0 +1,191 @@
+package bazelmake
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WhyResult explains how the libraries matched by Query entered the build.
+type WhyResult struct {
+	Query string
+	// Matches are the libraries referenced by the queried label or listing the queried file.
+	Matches []*CCLibrary
+	// ConfigSource reports whether the queried file is listed in Config.Sources or the sources of an artifact.
+	ConfigSource bool
+	// Paths are the dependency paths from a configured target to one of Matches.
+	Paths []*DependencyPath
+	// Cuts are the ignore rules cutting every path.
+	Cuts []*IgnoreConfig
+	// Truncated reports whether path enumeration stopped at the limit.
+	Truncated bool
+}
+
+type DependencyPath struct {
+	Libraries []*CCLibrary
+	// Cuts are the ignore rules cutting this path. Adding any of them to Config.Ignores removes the path.
+	Cuts []*IgnoreConfig
+}
+
+func (p *DependencyPath) String() string {
+	labels := make([]string, 0, len(p.Libraries))
+	for _, lib := range p.Libraries {
+		labels = append(labels, lib.FQDN())
+	}
+	return strings.Join(labels, " -> ")
+}
+
+func (c *IgnoreConfig) String() string {
+	return fmt.Sprintf("%s:%s", c.Path, c.Name)
+}
+
+// Why enumerates the dependency paths from Config.Targets to query, which is either a label or a source/header path.
+// If maxPaths is positive, enumeration stops after maxPaths paths.
+func Why(cfg *Config, query string, maxPaths int) (*WhyResult, error) {
+	resolver := NewResolver(cfg)
+	targetLibs, err := resolver.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	ret := &WhyResult{Query: query}
+	if strings.HasPrefix(query, "@") || strings.HasPrefix(query, "//") {
+		matches, err := resolver.LookupLabel(query)
+		if err != nil {
+			return nil, err
+		}
+		ret.Matches = matches
+	} else {
+		ret.Matches = resolver.LookupFile(query)
+		for _, src := range cfg.AllSources() {
+			if src == query {
+				ret.ConfigSource = true
+			}
+		}
+		if len(ret.Matches) == 0 && !ret.ConfigSource {
+			return nil, fmt.Errorf("failed to find library containing file: %s", query)
+		}
+	}
+
+	w := &pathWalker{
+		matches:  make(map[*CCLibrary]struct{}),
+		reach:    make(map[*CCLibrary]struct{}),
+		visiting: make(map[*CCLibrary]struct{}),
+		maxPaths: maxPaths,
+	}
+	for _, lib := range ret.Matches {
+		w.matches[lib] = struct{}{}
+	}
+	w.markAncestors(resolver.Libraries())
+	for _, target := range targetLibs {
+		if !w.walk(target, nil) {
+			break
+		}
+	}
+	ret.Paths = w.paths
+	ret.Truncated = w.truncated
+	ret.Cuts = commonCuts(ret.Paths)
+	return ret, nil
+}
+
+type pathWalker struct {
+	matches   map[*CCLibrary]struct{}
+	reach     map[*CCLibrary]struct{}
+	visiting  map[*CCLibrary]struct{}
+	paths     []*DependencyPath
+	maxPaths  int
+	truncated bool
+}
+
+// walk appends every path from lib to a match. It returns false when the path limit is reached.
+func (w *pathWalker) walk(lib *CCLibrary, stack []*CCLibrary) bool {
+	if !w.reachable(lib) {
+		return true
+	}
+	if _, exists := w.visiting[lib]; exists {
+		return true
+	}
+	stack = append(stack, lib)
+	if _, exists := w.matches[lib]; exists {
+		if w.maxPaths > 0 && len(w.paths) >= w.maxPaths {
+			w.truncated = true
+			return false
+		}
+		libs := append([]*CCLibrary{}, stack...)
+		w.paths = append(w.paths, &DependencyPath{
+			Libraries: libs,
+			Cuts:      cutsOf(libs),
+		})
+		return true
+	}
+	w.visiting[lib] = struct{}{}
+	defer delete(w.visiting, lib)
+	for _, dep := range lib.ResolvedDependencies {
+		if !w.walk(dep, stack) {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *pathWalker) reachable(lib *CCLibrary) bool {
+	_, exists := w.reach[lib]
+	return exists
+}
+
+// markAncestors marks every library depending on one of the matches directly or transitively as reachable.
+func (w *pathWalker) markAncestors(libs []*CCLibrary) {
+	rdeps := make(map[*CCLibrary][]*CCLibrary)
+	for _, lib := range libs {
+		for _, dep := range lib.ResolvedDependencies {
+			rdeps[dep] = append(rdeps[dep], lib)
+		}
+	}
+	queue := make([]*CCLibrary, 0, len(w.matches))
+	for lib := range w.matches {
+		w.reach[lib] = struct{}{}
+		queue = append(queue, lib)
+	}
+	for len(queue) > 0 {
+		lib := queue[0]
+		queue = queue[1:]
+		for _, rdep := range rdeps[lib] {
+			if _, exists := w.reach[rdep]; exists {
+				continue
+			}
+			w.reach[rdep] = struct{}{}
+			queue = append(queue, rdep)
+		}
+	}
+}
+
+func cutsOf(libs []*CCLibrary) []*IgnoreConfig {
+	ret := make([]*IgnoreConfig, 0, len(libs))
+	for _, lib := range libs {
+		ret = append(ret, &IgnoreConfig{Path: lib.File.Path, Name: lib.Name})
+	}
+	return ret
+}
+
+func commonCuts(paths []*DependencyPath) []*IgnoreConfig {
+	if len(paths) == 0 {
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, path := range paths {
+		seen := make(map[string]struct{})
+		for _, cut := range path.Cuts {
+			key := cut.String()
+			if _, exists := seen[key]; exists {
+				continue
+			}
+			seen[key] = struct{}{}
+			counts[key]++
+		}
+	}
+	var ret []*IgnoreConfig
+	for _, cut := range paths[0].Cuts {
+		if counts[cut.String()] == len(paths) {
+			ret = append(ret, cut)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,50 @@
+package bazelmake_test
+
+import (
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+func TestWhy(t *testing.T) {
+	cfg := createWorkspace(t)
+	t.Run("file", func(t *testing.T) {
+		result, err := bazelmake.Why(cfg, "b/base/log.cc", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{
+			"@a//lib:lib -> @a//lib:util -> @b//base:log",
+			"@a//lib:lib -> @b//base:base -> @b//base:log",
+		}
+		if len(result.Paths) != len(expected) {
+			t.Fatalf("failed to get paths: %v", result.Paths)
+		}
+		for i, path := range result.Paths {
+			if path.String() != expected[i] {
+				t.Fatalf("unexpected path: expected %s but got %s", expected[i], path)
+			}
+		}
+		var cuts []string
+		for _, cut := range result.Cuts {
+			cuts = append(cuts, cut.String())
+		}
+		if len(cuts) != 2 || cuts[0] != "lib:lib" || cuts[1] != "base:log" {
+			t.Fatalf("unexpected cuts: %v", cuts)
+		}
+	})
+	t.Run("label with limit", func(t *testing.T) {
+		result, err := bazelmake.Why(cfg, "//base:log", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Paths) != 1 || !result.Truncated {
+			t.Fatalf("failed to truncate paths: %v", result.Paths)
+		}
+	})
+	t.Run("unknown file", func(t *testing.T) {
+		if _, err := bazelmake.Why(cfg, "b/base/unknown.cc", 0); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package cheader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// evaluator evaluates the integer constant expressions of enum values and array sizes.
+type evaluator struct {
+	tokens    []*token
+	pos       int
+	constants map[string]int64
+}
+
+func evaluate(tokens []*token, constants map[string]int64) (int64, error) {
+	e := &evaluator{tokens: tokens, constants: constants}
+	v, err := e.binary(0)
+	if err != nil {
+		return 0, err
+	}
+	if e.pos != len(tokens) {
+		return 0, fmt.Errorf("unexpected %s in the constant expression", tokens[e.pos].value)
+	}
+	return v, nil
+}
+
+var binaryPrecedences = map[string]int{
+	"|":  1,
+	"^":  2,
+	"&":  3,
+	"<<": 4,
+	">>": 4,
+	"+":  5,
+	"-":  5,
+	"*":  6,
+	"/":  6,
+	"%":  6,
+}
+
+func (e *evaluator) binary(minPrecedence int) (int64, error) {
+	lhs, err := e.unary()
+	if err != nil {
+		return 0, err
+	}
+	for e.pos < len(e.tokens) {
+		op := e.tokens[e.pos]
+		precedence, exists := binaryPrecedences[op.value]
+		if op.kind != tokenPunct || !exists || precedence <= minPrecedence {
+			break
+		}
+		e.pos++
+		rhs, err := e.binary(precedence)
+		if err != nil {
+			return 0, err
+		}
+		switch op.value {
+		case "|":
+			lhs |= rhs
+		case "^":
+			lhs ^= rhs
+		case "&":
+			lhs &= rhs
+		case "<<":
+			lhs <<= uint64(rhs)
+		case ">>":
+			lhs >>= uint64(rhs)
+		case "+":
+			lhs += rhs
+		case "-":
+			lhs -= rhs
+		case "*":
+			lhs *= rhs
+		case "/", "%":
+			if rhs == 0 {
+				return 0, fmt.Errorf("division by zero in the constant expression")
+			}
+			if op.value == "/" {
+				lhs /= rhs
+			} else {
+				lhs %= rhs
+			}
+		}
+	}
+	return lhs, nil
+}
+
+func (e *evaluator) unary() (int64, error) {
+	if e.pos >= len(e.tokens) {
+		return 0, fmt.Errorf("unexpected end of the constant expression")
+	}
+	t := e.tokens[e.pos]
+	e.pos++
+	switch {
+	case t.is("-"), t.is("+"), t.is("~"), t.is("!"):
+		v, err := e.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch t.value {
+		case "-":
+			return -v, nil
+		case "~":
+			return ^v, nil
+		case "!":
+			if v == 0 {
+				return 1, nil
+			}
+			return 0, nil
+		}
+		return v, nil
+	case t.is("("):
+		v, err := e.binary(0)
+		if err != nil {
+			return 0, err
+		}
+		if e.pos >= len(e.tokens) || !e.tokens[e.pos].is(")") {
+			return 0, fmt.Errorf("unbalanced parentheses in the constant expression")
+		}
+		e.pos++
+		return v, nil
+	case t.kind == tokenNumber:
+		return parseInteger(t.value)
+	case t.kind == tokenChar:
+		v, _, _, err := strconv.UnquoteChar(t.value, '\'')
+		if err != nil {
+			return 0, err
+		}
+		return int64(v), nil
+	case t.kind == tokenIdent:
+		v, exists := e.constants[t.value]
+		if !exists {
+			return 0, fmt.Errorf("unknown constant %s", t.value)
+		}
+		return v, nil
+	}
+	return 0, fmt.Errorf("unexpected %s in the constant expression", t.value)
+}
+
+func parseInteger(s string) (int64, error) {
+	s = strings.TrimRight(strings.ReplaceAll(s, "'", ""), "uUlL")
+	if v, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return v, nil
+	}
+	v, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer %s", s)
+	}
+	return int64(v), nil
+}
@@ -0,0 +1,134 @@
+package cheader
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenChar
+	tokenPunct
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	line  int
+}
+
+func (t *token) is(value string) bool {
+	return t.kind != tokenString && t.kind != tokenChar && t.value == value
+}
+
+// tokenize splits src into tokens. Comments and preprocessor directives are removed,
+// so both branches of conditionals like #ifdef __cplusplus are read.
+func tokenize(src string) ([]*token, error) {
+	var (
+		tokens    []*token
+		line      = 1
+		lineStart = true
+	)
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			lineStart = true
+			i++
+			continue
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			i++
+			continue
+		case c == '\\' && i+1 < len(src) && src[i+1] == '\n':
+			line++
+			i += 2
+			continue
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+			continue
+		case c == '#' && lineStart:
+			for i < len(src) && src[i] != '\n' {
+				if src[i] == '\\' && i+1 < len(src) && src[i+1] == '\n' {
+					line++
+					i++
+				} else if strings.HasPrefix(src[i:], "/*") {
+					end := strings.Index(src[i+2:], "*/")
+					if end < 0 {
+						return nil, fmt.Errorf("line %d: unterminated comment", line)
+					}
+					line += strings.Count(src[i:i+2+end], "\n")
+					i += end + 3
+				}
+				i++
+			}
+			continue
+		}
+		lineStart = false
+		start := i
+		switch {
+		case isIdentStart(c):
+			for i < len(src) && isIdentPart(src[i]) {
+				i++
+			}
+			tokens = append(tokens, &token{kind: tokenIdent, value: src[start:i], line: line})
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			for i < len(src) && (isIdentPart(src[i]) || src[i] == '.' || src[i] == '\'') {
+				i++
+			}
+			tokens = append(tokens, &token{kind: tokenNumber, value: src[start:i], line: line})
+		case c == '"' || c == '\'':
+			i++
+			for i < len(src) && src[i] != c {
+				if src[i] == '\\' {
+					i++
+				} else if src[i] == '\n' {
+					return nil, fmt.Errorf("line %d: unterminated literal", line)
+				}
+				i++
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("line %d: unterminated literal", line)
+			}
+			i++
+			kind := tokenString
+			if c == '\'' {
+				kind = tokenChar
+			}
+			tokens = append(tokens, &token{kind: kind, value: src[start+1 : i-1], line: line})
+		default:
+			value := string(c)
+			for _, punct := range []string{"...", "::", "<<", ">>", "->"} {
+				if strings.HasPrefix(src[i:], punct) {
+					value = punct
+					break
+				}
+			}
+			i += len(value)
+			tokens = append(tokens, &token{kind: tokenPunct, value: value, line: line})
+		}
+	}
+	return tokens, nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || c >= '0' && c <= '9'
+}
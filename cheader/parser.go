@@ -0,0 +1,775 @@
+// Package cheader parses the declarations of C headers into the IDL of wasmbind.
+//
+// It is not a preprocessor: directives are removed and both branches of conditionals are read,
+// so macros used in declarations like visibility attributes must be listed by Options.StripMacros.
+package cheader
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/goccy/go-wasmbind-tools/wasmbind"
+)
+
+// Options configures the parser.
+type Options struct {
+	// StripMacros are identifiers removed from declarations like MYLIB_API.
+	// The arguments of an identifier followed by parentheses are removed too.
+	StripMacros []string
+}
+
+// Parser collects the functions, structs and enums of headers.
+// Types defined by a header are visible from the headers parsed after it.
+type Parser struct {
+	strip      map[string]struct{}
+	typedefs   map[string]*ctype
+	tagAliases map[string]string
+	aggregates map[string]*aggregate
+	constants  map[string]int64
+	functions  map[string]struct{}
+	listed     map[*wasmbind.Struct]struct{}
+	idl        *wasmbind.IDL
+	warnings   []string
+}
+
+func NewParser(opts *Options) *Parser {
+	p := &Parser{
+		strip:      make(map[string]struct{}),
+		typedefs:   make(map[string]*ctype),
+		tagAliases: make(map[string]string),
+		aggregates: make(map[string]*aggregate),
+		constants:  make(map[string]int64),
+		functions:  make(map[string]struct{}),
+		listed:     make(map[*wasmbind.Struct]struct{}),
+		idl:        &wasmbind.IDL{},
+	}
+	if opts != nil {
+		for _, macro := range opts.StripMacros {
+			p.strip[macro] = struct{}{}
+		}
+	}
+	return p
+}
+
+// IDL returns the declarations collected from the parsed headers.
+func (p *Parser) IDL() *wasmbind.IDL {
+	return p.idl
+}
+
+// Warnings returns the declarations skipped because they cannot be bound.
+func (p *Parser) Warnings() []string {
+	return p.warnings
+}
+
+// ParseFile parses the header at path.
+func (p *Parser) ParseFile(path string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return p.Parse(path, src)
+}
+
+// Parse parses a header. name is used in warnings.
+//
+// The functions declared in extern "C" are collected. Every function is collected from a header without extern "C",
+// which is assumed to be a C header. Static and inline functions are not collected because they are not exported.
+func (p *Parser) Parse(name string, src []byte) error {
+	tokens, err := tokenize(string(src))
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	f := &fileParser{Parser: p, name: name, tokens: tokens, all: true}
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i].is("extern") && tokens[i+1].kind == tokenString && tokens[i+1].value == "C" {
+			f.all = false
+			break
+		}
+	}
+	if err := f.scope(false, false); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+type fileParser struct {
+	*Parser
+	name   string
+	tokens []*token
+	pos    int
+	// all is true if every function is collected.
+	all bool
+}
+
+func (f *fileParser) warn(t *token, format string, args ...any) {
+	f.warnings = append(f.warnings, fmt.Sprintf("%s:%d: %s", f.name, t.line, fmt.Sprintf(format, args...)))
+}
+
+func (f *fileParser) scope(externC, nested bool) error {
+	for f.pos < len(f.tokens) {
+		t := f.tokens[f.pos]
+		switch {
+		case t.is("}"):
+			f.pos++
+			if nested {
+				return nil
+			}
+			// the closing brace of extern "C" { in a conditional branch.
+		case t.is(";"):
+			f.pos++
+		case t.is("extern") && f.pos+1 < len(f.tokens) && f.tokens[f.pos+1].kind == tokenString:
+			lang := f.tokens[f.pos+1].value
+			f.pos += 2
+			if f.pos < len(f.tokens) && f.tokens[f.pos].is("{") {
+				f.pos++
+				if err := f.scope(lang == "C", true); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := f.declaration(lang == "C"); err != nil {
+				return err
+			}
+		case t.is("namespace"):
+			for f.pos < len(f.tokens) && !f.tokens[f.pos].is("{") && !f.tokens[f.pos].is(";") {
+				f.pos++
+			}
+			if f.pos < len(f.tokens) && f.tokens[f.pos].is("{") {
+				f.pos = groupEnd(f.tokens, f.pos) + 1
+			} else {
+				f.pos++
+			}
+		case t.is("template"), t.is("class"), t.is("using"), t.is("static_assert"), t.is("_Static_assert"):
+			// C++ declarations and assertions are not bound.
+			f.collect()
+		default:
+			if err := f.declaration(externC); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// groupEnd returns the index of the bracket closing tokens[start], or the last index if it is unbalanced.
+func groupEnd(tokens []*token, start int) int {
+	var depth int
+	for i := start; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.is("("), t.is("["), t.is("{"):
+			depth++
+		case t.is(")"), t.is("]"), t.is("}"):
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(tokens) - 1
+}
+
+// collect returns the tokens of the next declaration. hasBody is true if it is a function definition, whose body is skipped.
+func (f *fileParser) collect() (decl []*token, hasBody bool) {
+	for f.pos < len(f.tokens) {
+		t := f.tokens[f.pos]
+		switch {
+		case t.is(";"):
+			f.pos++
+			return decl, false
+		case t.is("}"):
+			return decl, false
+		case t.is("{"):
+			end := groupEnd(f.tokens, f.pos)
+			stripped, _ := f.stripTokens(decl)
+			if topIndex(stripped, "(") >= 0 {
+				f.pos = end + 1
+				return decl, true
+			}
+			decl = append(decl, f.tokens[f.pos:end+1]...)
+			f.pos = end + 1
+		case t.is("("), t.is("["):
+			end := groupEnd(f.tokens, f.pos)
+			decl = append(decl, f.tokens[f.pos:end+1]...)
+			f.pos = end + 1
+		default:
+			decl = append(decl, t)
+			f.pos++
+		}
+	}
+	return decl, false
+}
+
+// ignoredKeywords do not change the binding of declarations.
+var ignoredKeywords = map[string]struct{}{
+	"extern":        {},
+	"inline":        {},
+	"__inline":      {},
+	"__inline__":    {},
+	"_Noreturn":     {},
+	"noexcept":      {},
+	"restrict":      {},
+	"__restrict":    {},
+	"__restrict__":  {},
+	"register":      {},
+	"thread_local":  {},
+	"_Thread_local": {},
+	"__extension__": {},
+	"constexpr":     {},
+}
+
+// attributeKeywords are followed by parenthesized arguments.
+var attributeKeywords = map[string]struct{}{
+	"__attribute__": {},
+	"__attribute":   {},
+	"__declspec":    {},
+	"alignas":       {},
+	"_Alignas":      {},
+	"__asm__":       {},
+	"__asm":         {},
+	"asm":           {},
+}
+
+// stripTokens removes attributes, macros and ignored keywords. isStatic is true if tokens contain static.
+func (f *fileParser) stripTokens(tokens []*token) (ret []*token, isStatic bool) {
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		next := func() bool {
+			return i+1 < len(tokens) && tokens[i+1].is("(")
+		}
+		if t.kind == tokenIdent {
+			_, strip := f.strip[t.value]
+			_, attribute := attributeKeywords[t.value]
+			if strip || attribute {
+				if next() {
+					i = groupEnd(tokens, i+1)
+				}
+				continue
+			}
+			if _, exists := ignoredKeywords[t.value]; exists {
+				continue
+			}
+			if t.value == "static" {
+				isStatic = true
+				continue
+			}
+		}
+		if t.is("[") && i+1 < len(tokens) && tokens[i+1].is("[") {
+			i = groupEnd(tokens, i)
+			continue
+		}
+		ret = append(ret, t)
+	}
+	return ret, isStatic
+}
+
+// topIndex returns the index of the first value outside of brackets or -1.
+func topIndex(tokens []*token, value string) int {
+	var depth int
+	for i, t := range tokens {
+		if depth == 0 && t.is(value) {
+			return i
+		}
+		switch {
+		case t.is("("), t.is("["), t.is("{"):
+			depth++
+		case t.is(")"), t.is("]"), t.is("}"):
+			depth--
+		}
+	}
+	return -1
+}
+
+// splitTop splits tokens by sep outside of brackets.
+func splitTop(tokens []*token, sep string) [][]*token {
+	var (
+		ret   [][]*token
+		depth int
+		start int
+	)
+	for i, t := range tokens {
+		switch {
+		case t.is("("), t.is("["), t.is("{"):
+			depth++
+		case t.is(")"), t.is("]"), t.is("}"):
+			depth--
+		case depth == 0 && t.is(sep):
+			ret = append(ret, tokens[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(tokens) {
+		ret = append(ret, tokens[start:])
+	}
+	return ret
+}
+
+func (f *fileParser) declaration(externC bool) error {
+	if f.pos >= len(f.tokens) {
+		return nil
+	}
+	first := f.tokens[f.pos]
+	decl, hasBody := f.collect()
+	decl, isStatic := f.stripTokens(decl)
+	if len(decl) == 0 {
+		return nil
+	}
+	switch {
+	case decl[0].is("typedef"):
+		f.typedef(first, decl[1:])
+	case isDefinition(decl):
+		// declarators following the definition are variables.
+		f.define(first, decl)
+	case topIndex(decl, "(") >= 0:
+		if isStatic || hasBody || !(externC || f.all) {
+			return nil
+		}
+		f.function(first, decl)
+	}
+	return nil
+}
+
+// isDefinition reports whether decl starts with the definition of a struct, a union or an enum.
+func isDefinition(decl []*token) bool {
+	if len(decl) < 2 || !(decl[0].is("struct") || decl[0].is("union") || decl[0].is("enum")) {
+		return false
+	}
+	for _, t := range decl[1:] {
+		switch {
+		case t.is("{"):
+			return true
+		case t.kind == tokenIdent, t.is(":"):
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// definition is a struct, a union or an enum defined by a declaration.
+type definition struct {
+	tag       string
+	aggregate *aggregate
+	enum      *wasmbind.Enum
+	// rest are the declarators following the definition.
+	rest []*token
+}
+
+// define returns nil if the body is unclosed.
+func (f *fileParser) define(first *token, decl []*token) *definition {
+	kind := decl[0].value
+	i := 1
+	def := &definition{}
+	if decl[i].kind == tokenIdent {
+		def.tag = decl[i].value
+		i++
+	}
+	for i < len(decl) && !decl[i].is("{") {
+		// the underlying type of an enum.
+		i++
+	}
+	end := groupEnd(decl, i)
+	if i == len(decl) || !decl[end].is("}") {
+		// an unbalanced branch of #if or a truncated header.
+		f.warn(first, "skipped %s: unclosed body", strings.TrimSpace(kind+" "+def.tag))
+		return nil
+	}
+	body := decl[i+1 : end]
+	def.rest = decl[end+1:]
+	if kind == "enum" {
+		def.enum = f.defineEnum(first, def.tag, body)
+		if def.enum != nil && def.tag != "" {
+			f.idl.Enums = append(f.idl.Enums, def.enum)
+		}
+		return def
+	}
+	def.aggregate = f.defineAggregate(first, kind, def.tag, body)
+	if def.tag != "" {
+		f.aggregates[kind+" "+def.tag] = def.aggregate
+		f.list(def.aggregate)
+	}
+	return def
+}
+
+func (f *fileParser) list(agg *aggregate) {
+	if !agg.complete {
+		return
+	}
+	if _, exists := f.listed[agg.def]; exists {
+		return
+	}
+	f.listed[agg.def] = struct{}{}
+	f.idl.Structs = append(f.idl.Structs, agg.def)
+}
+
+func (f *fileParser) defineEnum(first *token, name string, body []*token) *wasmbind.Enum {
+	enum := &wasmbind.Enum{Name: name}
+	var next int64
+	for _, part := range splitTop(body, ",") {
+		if len(part) == 0 {
+			continue
+		}
+		v := &wasmbind.EnumValue{Name: part[0].value, Value: next}
+		if len(part) > 1 {
+			if !part[1].is("=") {
+				f.warn(first, "skipped enum %s: unsupported enumerator %s", name, spell(part))
+				return nil
+			}
+			value, err := evaluate(part[2:], f.constants)
+			if err != nil {
+				f.warn(first, "skipped enum %s: %s: %v", name, v.Name, err)
+				return nil
+			}
+			v.Value = value
+		}
+		f.constants[v.Name] = v.Value
+		next = v.Value + 1
+		enum.Values = append(enum.Values, v)
+	}
+	return enum
+}
+
+func (f *fileParser) defineAggregate(first *token, kind, name string, body []*token) *aggregate {
+	st := &wasmbind.Struct{Name: name, Align: 1}
+	agg := &aggregate{def: st, complete: true}
+	incomplete := func(format string, args ...any) *aggregate {
+		f.warn(first, "%s %s cannot be bound: %s", kind, name, fmt.Sprintf(format, args...))
+		st.Fields = nil
+		agg.complete = false
+		return agg
+	}
+	var offset uint32
+	for _, member := range splitTop(body, ";") {
+		member, _ = f.stripTokens(member)
+		if len(member) == 0 {
+			continue
+		}
+		if isDefinition(member) {
+			return incomplete("nested definition of %s", spell(member[:2]))
+		}
+		var base []*token
+		for i, part := range splitTop(member, ",") {
+			if i != 0 {
+				part = append(append([]*token{}, base...), part...)
+			}
+			d, err := splitDeclarator(part, true)
+			if err != nil {
+				return incomplete("%v", err)
+			}
+			if i == 0 {
+				base = d.typ
+				for len(base) != 0 && base[len(base)-1].is("*") {
+					base = base[:len(base)-1]
+				}
+			}
+			if d.bits {
+				return incomplete("bit-field %s", d.name)
+			}
+			t, err := f.resolveType(d.typ)
+			if err != nil {
+				return incomplete("%s: %v", d.name, err)
+			}
+			if t.void || t.size == 0 {
+				return incomplete("%s has no size", d.name)
+			}
+			count := uint32(1)
+			ctype := t.spelling
+			for _, dim := range d.dims {
+				n, err := evaluate(dim, f.constants)
+				if err != nil || n <= 0 {
+					return incomplete("array size of %s", d.name)
+				}
+				count *= uint32(n)
+				ctype += "[" + spell(dim) + "]"
+			}
+			field := &wasmbind.Field{Name: d.name, CType: ctype, Size: t.size * count}
+			if len(d.dims) == 0 && t.aggregate == nil {
+				field.Type = t.typ
+			}
+			if t.align > st.Align {
+				st.Align = t.align
+			}
+			if kind == "union" {
+				if field.Size > offset {
+					offset = field.Size
+				}
+			} else {
+				field.Offset = alignUp(offset, t.align)
+				offset = field.Offset + field.Size
+			}
+			st.Fields = append(st.Fields, field)
+		}
+	}
+	st.Size = alignUp(offset, st.Align)
+	return agg
+}
+
+func alignUp(n, align uint32) uint32 {
+	if align <= 1 {
+		return n
+	}
+	return (n + align - 1) / align * align
+}
+
+// declarator is a name declared with its type like the name of char *name[4].
+type declarator struct {
+	name string
+	// typ are the tokens of the type including the pointers of the declarator.
+	typ []*token
+	// dims are the expressions of the array sizes.
+	dims [][]*token
+	bits bool
+}
+
+var pointerToken = &token{kind: tokenPunct, value: "*"}
+
+// splitDeclarator splits tokens into the type and the declarator.
+// The last identifier is the name if named is true or it follows a type.
+func splitDeclarator(tokens []*token, named bool) (*declarator, error) {
+	d := &declarator{}
+	// function pointers like void (*name)(int) are pointers.
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i].is("(") && tokens[i+1].is("*") {
+			end := groupEnd(tokens, i)
+			if !tokens[end].is(")") {
+				return nil, fmt.Errorf("unbalanced ( in %s", spell(tokens))
+			}
+			for _, t := range tokens[i+2 : end] {
+				if t.kind == tokenIdent && !t.is("const") {
+					d.name = t.value
+				}
+			}
+			d.typ = append(append([]*token{}, tokens[:i]...), pointerToken)
+			return d, nil
+		}
+	}
+	if i := topIndex(tokens, ":"); i >= 0 {
+		d.bits = true
+		tokens = tokens[:i]
+	}
+	for len(tokens) != 0 && tokens[len(tokens)-1].is("]") {
+		start := len(tokens) - 1
+		for start >= 0 && !tokens[start].is("[") {
+			start--
+		}
+		if start < 0 {
+			return nil, fmt.Errorf("unbalanced ] in %s", spell(tokens))
+		}
+		d.dims = append([][]*token{tokens[start+1 : len(tokens)-1]}, d.dims...)
+		tokens = tokens[:start]
+	}
+	d.typ = tokens
+	if len(tokens) == 0 {
+		return d, nil
+	}
+	last := tokens[len(tokens)-1]
+	if last.kind != tokenIdent {
+		return d, nil
+	}
+	if _, builtin := builtinWords[last.value]; builtin || last.is("const") || last.is("volatile") {
+		return d, nil
+	}
+	if !named && !hasTypeName(tokens[:len(tokens)-1]) {
+		return d, nil
+	}
+	d.name = last.value
+	d.typ = tokens[:len(tokens)-1]
+	return d, nil
+}
+
+// hasTypeName reports whether tokens contain the name of a type.
+func hasTypeName(tokens []*token) bool {
+	for _, t := range tokens {
+		if t.kind == tokenIdent && !t.is("const") && !t.is("volatile") && !t.is("struct") && !t.is("union") && !t.is("enum") {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fileParser) typedef(first *token, decl []*token) {
+	var (
+		base []*token
+		def  *definition
+	)
+	if isDefinition(decl) {
+		def = f.define(first, decl)
+		if def == nil {
+			return
+		}
+		base = append([]*token{}, decl[0])
+		decl = def.rest
+	}
+	for i, part := range splitTop(decl, ",") {
+		if def != nil {
+			part = append(append([]*token{}, base...), part...)
+		} else if i != 0 {
+			part = append(append([]*token{}, base...), part...)
+		}
+		d, err := splitDeclarator(part, true)
+		if err != nil {
+			f.warn(first, "skipped typedef: %v", err)
+			return
+		}
+		if def == nil && i == 0 {
+			base = d.typ
+			for len(base) != 0 && base[len(base)-1].is("*") {
+				base = base[:len(base)-1]
+			}
+		}
+		if d.name == "" || len(d.dims) != 0 {
+			continue
+		}
+		pointer := len(d.typ) != 0 && d.typ[len(d.typ)-1].is("*")
+		switch {
+		case def != nil && def.enum != nil && !pointer:
+			if def.tag == "" {
+				def.enum.Name = d.name
+				f.idl.Enums = append(f.idl.Enums, def.enum)
+			}
+			f.typedefs[d.name] = &ctype{base: d.name, typ: wasmbind.TypeI32, size: 4, align: 4}
+		case def != nil && def.aggregate != nil && !pointer:
+			def.aggregate.def.Name = d.name
+			f.aggregates[d.name] = def.aggregate
+			f.list(def.aggregate)
+		case def != nil:
+			f.typedefs[d.name] = &ctype{base: d.name, pointer: 1, typ: wasmbind.TypeU32, size: 4, align: 4}
+		case len(d.typ) == 2 && (d.typ[0].is("struct") || d.typ[0].is("union")):
+			f.tagAliases[d.name] = d.typ[0].value + " " + d.typ[1].value
+		default:
+			t, err := f.resolveType(d.typ)
+			if err != nil {
+				// the typedef is reported when it is used.
+				continue
+			}
+			f.typedefs[d.name] = t
+		}
+	}
+}
+
+// lengthName matches the names of the length parameters following pointers.
+var lengthName = regexp.MustCompile(`(?i)(len|length|size|count)$|^n$`)
+
+func (f *fileParser) function(first *token, decl []*token) {
+	open := topIndex(decl, "(")
+	if open == 0 || decl[open-1].kind != tokenIdent || open+1 < len(decl) && decl[open+1].is("*") {
+		// function pointer variables.
+		return
+	}
+	if topIndex(decl, "::") >= 0 || decl[open-1].is("operator") {
+		return
+	}
+	name := decl[open-1].value
+	if _, exists := f.functions[name]; exists {
+		return
+	}
+	end := groupEnd(decl, open)
+	if end <= open || !decl[end].is(")") {
+		// an unbalanced branch of #if or a truncated header.
+		f.warn(first, "skipped %s: unclosed parameter list", name)
+		return
+	}
+	fn, err := f.newFunction(name, decl[:open-1], decl[open+1:end])
+	if err != nil {
+		f.warn(first, "skipped %s: %v", name, err)
+		return
+	}
+	f.functions[name] = struct{}{}
+	f.idl.Functions = append(f.idl.Functions, fn)
+}
+
+func (f *fileParser) newFunction(name string, result, params []*token) (*wasmbind.Function, error) {
+	fn := &wasmbind.Function{Name: name, Params: []*wasmbind.Param{}, Results: []wasmbind.Type{}}
+	rt, err := f.resolveType(result)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case rt.void:
+	case rt.aggregate != nil:
+		return nil, fmt.Errorf("%s is returned by value", rt.spelling)
+	case isCString(rt):
+		fn.Results = append(fn.Results, wasmbind.TypeCString)
+	default:
+		fn.Results = append(fn.Results, rt.typ)
+	}
+	parts := splitTop(params, ",")
+	if len(parts) == 1 && len(parts[0]) == 1 && parts[0][0].is("void") {
+		parts = nil
+	}
+	type param struct {
+		name string
+		typ  *ctype
+	}
+	var ps []*param
+	for _, part := range parts {
+		if len(part) == 1 && part[0].is("...") {
+			return nil, fmt.Errorf("variadic functions are not supported")
+		}
+		d, err := splitDeclarator(part, false)
+		if err != nil {
+			return nil, err
+		}
+		typ := d.typ
+		if len(d.dims) != 0 {
+			// array parameters are pointers.
+			typ = append(append([]*token{}, typ...), pointerToken)
+		}
+		t, err := f.resolveType(typ)
+		if err != nil {
+			return nil, err
+		}
+		if t.void {
+			return nil, fmt.Errorf("parameter %s is void", d.name)
+		}
+		if t.aggregate != nil {
+			return nil, fmt.Errorf("%s is passed by value", t.spelling)
+		}
+		ps = append(ps, &param{name: d.name, typ: t})
+	}
+	for i := 0; i < len(ps); i++ {
+		p := ps[i]
+		if isBuffer(p.typ) && i+1 < len(ps) && isLength(ps[i+1].typ, ps[i+1].name) {
+			typ := wasmbind.TypeBytes
+			if p.typ.base == "char" {
+				typ = wasmbind.TypeString
+			}
+			fn.Params = append(fn.Params, &wasmbind.Param{Name: p.name, Type: typ})
+			i++
+			continue
+		}
+		if isCString(p.typ) {
+			fn.Params = append(fn.Params, &wasmbind.Param{Name: p.name, Type: wasmbind.TypeCString})
+			continue
+		}
+		fn.Params = append(fn.Params, &wasmbind.Param{Name: p.name, Type: p.typ.typ})
+	}
+	return fn, nil
+}
+
+// isCString reports whether t is const char *.
+func isCString(t *ctype) bool {
+	return t.pointer == 1 && t.isConst && t.base == "char"
+}
+
+// isBuffer reports whether t is a pointer to const bytes.
+func isBuffer(t *ctype) bool {
+	if t.pointer != 1 || !t.isConst {
+		return false
+	}
+	switch t.base {
+	case "char", "signed char", "unsigned char", "int8_t", "uint8_t", "void":
+		return true
+	}
+	return false
+}
+
+// isLength reports whether the parameter is the length of the preceding buffer.
+func isLength(t *ctype, name string) bool {
+	if t.pointer != 0 || t.size != 4 || !strings.HasPrefix(string(t.typ), "i") && !strings.HasPrefix(string(t.typ), "u") {
+		return false
+	}
+	return t.base == "size_t" || lengthName.MatchString(name)
+}
@@ -0,0 +1,216 @@
+package cheader_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/cheader"
+	"github.com/goccy/go-wasmbind-tools/wasmbind"
+)
+
+const header = `
+#ifndef WORDS_H
+#define WORDS_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+#define WORDS_API __attribute__((visibility("default")))
+#define MAX_WORDS \
+  64
+
+#ifdef __cplusplus
+#include <string>
+
+namespace words {
+class Counter {
+ public:
+  int Count(const std::string& s);
+};
+}  // namespace words
+
+extern "C" {
+#endif
+
+typedef struct words_ctx words_ctx; /* opaque */
+
+typedef enum {
+  WORDS_OK = 0,
+  WORDS_ERROR = -1,
+  WORDS_FLAG = 1 << 4,
+  WORDS_NEXT,
+} words_status;
+
+enum words_mode { MODE_A = 'a', MODE_B };
+
+typedef struct {
+  int32_t x;
+  char c;
+  double y;
+  const char *label;
+  uint8_t tags[4];
+} words_point;
+
+struct words_packed {
+  uint16_t a;
+  unsigned long long b;
+};
+
+WORDS_API words_ctx* words_new(void);
+WORDS_API void words_free(words_ctx* ctx);
+WORDS_API words_status words_count(words_ctx* ctx, const char* text, size_t len, uint32_t* out);
+WORDS_API int words_hash(const uint8_t *data, size_t size);
+WORDS_API const char* words_version(void);
+WORDS_API int words_find(const char* word);
+WORDS_API float words_scale(float v, enum words_mode mode);
+WORDS_API words_point words_origin(void);
+WORDS_API int words_log(const char* fmt, ...);
+static inline int words_inline(int v) { return v + 1; }
+int words_callback(words_ctx* ctx, void (*cb)(int, void*), void* user_data);
+
+#ifdef __cplusplus
+}  // extern "C"
+
+int not_exported(int v);
+#endif
+
+#endif
+`
+
+func TestParse(t *testing.T) {
+	p := cheader.NewParser(&cheader.Options{StripMacros: []string{"WORDS_API"}})
+	if err := p.Parse("words.h", []byte(header)); err != nil {
+		t.Fatal(err)
+	}
+	idl := p.IDL()
+	var signatures []string
+	for _, fn := range idl.Functions {
+		var params []string
+		for _, p := range fn.Params {
+			params = append(params, p.Name+" "+string(p.Type))
+		}
+		var results []string
+		for _, r := range fn.Results {
+			results = append(results, string(r))
+		}
+		signatures = append(signatures, fn.Name+"("+strings.Join(params, ", ")+") "+strings.Join(results, ", "))
+	}
+	expected := []string{
+		"words_new() u32",
+		"words_free(ctx u32) ",
+		"words_count(ctx u32, text string, out u32) i32",
+		"words_hash(data bytes) i32",
+		"words_version() cstring",
+		"words_find(word cstring) i32",
+		"words_scale(v f32, mode i32) f32",
+		"words_callback(ctx u32, cb u32, user_data u32) i32",
+	}
+	if got := strings.Join(signatures, "\n"); got != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected functions:\nexpected\n%s\ngot\n%s", strings.Join(expected, "\n"), got)
+	}
+	if len(p.Warnings()) != 2 {
+		t.Fatalf("unexpected warnings: %v", p.Warnings())
+	}
+	for i, warning := range []string{"words.h:56: skipped words_origin", "words.h:57: skipped words_log"} {
+		if !strings.HasPrefix(p.Warnings()[i], warning) {
+			t.Fatalf("unexpected warning: %s", p.Warnings()[i])
+		}
+	}
+
+	if len(idl.Enums) != 2 {
+		t.Fatalf("unexpected enums: %d", len(idl.Enums))
+	}
+	status := idl.Enums[0]
+	if status.Name != "words_status" {
+		t.Fatalf("unexpected enum name: %s", status.Name)
+	}
+	for i, v := range []int64{0, -1, 16, 17} {
+		if status.Values[i].Value != v {
+			t.Fatalf("unexpected value of %s: %d", status.Values[i].Name, status.Values[i].Value)
+		}
+	}
+	if mode := idl.Enums[1]; mode.Name != "words_mode" || mode.Values[1].Value != 'b' {
+		t.Fatalf("unexpected enum: %+v", mode)
+	}
+
+	if len(idl.Structs) != 2 {
+		t.Fatalf("unexpected structs: %d", len(idl.Structs))
+	}
+	point := idl.Structs[0]
+	if point.Name != "words_point" || point.Size != 24 || point.Align != 8 {
+		t.Fatalf("unexpected layout of %s: size %d align %d", point.Name, point.Size, point.Align)
+	}
+	fields := []*wasmbind.Field{
+		{Name: "x", CType: "int32_t", Type: wasmbind.TypeI32, Offset: 0, Size: 4},
+		{Name: "c", CType: "char", Type: wasmbind.TypeI32, Offset: 4, Size: 1},
+		{Name: "y", CType: "double", Type: wasmbind.TypeF64, Offset: 8, Size: 8},
+		{Name: "label", CType: "const char *", Type: wasmbind.TypeU32, Offset: 16, Size: 4},
+		{Name: "tags", CType: "uint8_t[4]", Offset: 20, Size: 4},
+	}
+	for i, field := range fields {
+		if *point.Fields[i] != *field {
+			t.Fatalf("unexpected field:\nexpected %+v\ngot      %+v", field, point.Fields[i])
+		}
+	}
+	if packed := idl.Structs[1]; packed.Name != "words_packed" || packed.Size != 16 || packed.Fields[1].Offset != 8 {
+		t.Fatalf("unexpected layout of %s: %+v", packed.Name, packed)
+	}
+}
+
+func TestParseCHeader(t *testing.T) {
+	p := cheader.NewParser(nil)
+	src := "int add(int a, int b);\nstatic int hidden(void);\nextern long long total;\n"
+	if err := p.Parse("add.h", []byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(p.IDL().FunctionNames(), " "); got != "add" {
+		t.Fatalf("unexpected functions: %s", got)
+	}
+}
+
+func TestParseUnclosedParams(t *testing.T) {
+	p := cheader.NewParser(nil)
+	// the parser reads both branches, so the declaration of the first one swallows the second one.
+	src := "int g(int a);\n#if defined(OLD)\nint f(\n#else\nint f(int a);\n#endif\n"
+	if err := p.Parse("unclosed.h", []byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(p.IDL().FunctionNames(), " "); got != "g" {
+		t.Fatalf("unexpected functions: %s", got)
+	}
+	if len(p.Warnings()) != 1 || !strings.HasPrefix(p.Warnings()[0], "unclosed.h:3: skipped f: unclosed parameter list") {
+		t.Fatalf("unexpected warnings: %v", p.Warnings())
+	}
+	p = cheader.NewParser(nil)
+	if err := p.Parse("truncated.h", []byte("int f(")); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.IDL().Functions) != 0 || len(p.Warnings()) != 1 {
+		t.Fatalf("unexpected result: %v %v", p.IDL().FunctionNames(), p.Warnings())
+	}
+}
+
+func TestParseUnbalancedBrackets(t *testing.T) {
+	for _, test := range []struct {
+		src     string
+		warning string
+	}{
+		{src: "typedef int x];\nint f(int a);\n", warning: "unbalanced.h:1: skipped typedef: unbalanced ] in int x]"},
+		{src: "int f(int a);\ntypedef void (*cb;\n", warning: "unbalanced.h:2: skipped typedef: unbalanced ( in void(* cb;"},
+		{src: "struct s { int a]; };\nint f(int a);\n", warning: "unbalanced.h:1: skipped struct s: unclosed body"},
+		{src: "int f(int a);\ntypedef enum {", warning: "unbalanced.h:2: skipped enum: unclosed body"},
+		{src: "int f(int a);\nstruct s {\n", warning: "unbalanced.h:2: skipped struct s: unclosed body"},
+		{src: "int f(int a);\nenum e : int {", warning: "unbalanced.h:2: skipped enum e: unclosed body"},
+	} {
+		p := cheader.NewParser(nil)
+		if err := p.Parse("unbalanced.h", []byte(test.src)); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(p.IDL().FunctionNames(), " "); got != "f" {
+			t.Fatalf("unexpected functions of %q: %s", test.src, got)
+		}
+		if len(p.Warnings()) != 1 || p.Warnings()[0] != test.warning {
+			t.Fatalf("unexpected warnings of %q: %q", test.src, p.Warnings())
+		}
+	}
+}
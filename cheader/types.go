@@ -0,0 +1,234 @@
+package cheader
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/goccy/go-wasmbind-tools/wasmbind"
+)
+
+// ctype is a resolved C type in wasm32.
+type ctype struct {
+	// spelling is the normalized C spelling like const char *.
+	spelling string
+	// typ is empty for void, aggregates and unsupported types.
+	typ   wasmbind.Type
+	size  uint32
+	align uint32
+	// base is the name of the type without qualifiers and pointers like char or struct point.
+	base    string
+	pointer int
+	// isConst reports whether the pointee of a pointer is const.
+	isConst bool
+	void    bool
+	// aggregate is the struct or union passed by value.
+	aggregate *aggregate
+}
+
+type aggregate struct {
+	def *wasmbind.Struct
+	// complete is false for forward declarations and aggregates whose layout is unknown.
+	complete bool
+}
+
+type scalar struct {
+	typ  wasmbind.Type
+	size uint32
+}
+
+// namedScalars are the typedefs of the standard headers in wasm32.
+var namedScalars = map[string]scalar{
+	"int8_t":    {typ: wasmbind.TypeI32, size: 1},
+	"uint8_t":   {typ: wasmbind.TypeU32, size: 1},
+	"int16_t":   {typ: wasmbind.TypeI32, size: 2},
+	"uint16_t":  {typ: wasmbind.TypeU32, size: 2},
+	"int32_t":   {typ: wasmbind.TypeI32, size: 4},
+	"uint32_t":  {typ: wasmbind.TypeU32, size: 4},
+	"int64_t":   {typ: wasmbind.TypeI64, size: 8},
+	"uint64_t":  {typ: wasmbind.TypeU64, size: 8},
+	"size_t":    {typ: wasmbind.TypeU32, size: 4},
+	"ssize_t":   {typ: wasmbind.TypeI32, size: 4},
+	"ptrdiff_t": {typ: wasmbind.TypeI32, size: 4},
+	"intptr_t":  {typ: wasmbind.TypeI32, size: 4},
+	"uintptr_t": {typ: wasmbind.TypeU32, size: 4},
+	"off_t":     {typ: wasmbind.TypeI64, size: 8},
+	"wchar_t":   {typ: wasmbind.TypeI32, size: 4},
+	"char16_t":  {typ: wasmbind.TypeU32, size: 2},
+	"char32_t":  {typ: wasmbind.TypeU32, size: 4},
+}
+
+// builtinWords are the keywords composing the fundamental types.
+var builtinWords = map[string]struct{}{
+	"void":     {},
+	"char":     {},
+	"short":    {},
+	"int":      {},
+	"long":     {},
+	"signed":   {},
+	"unsigned": {},
+	"float":    {},
+	"double":   {},
+	"bool":     {},
+	"_Bool":    {},
+}
+
+// builtinType resolves a fundamental type like unsigned long long.
+func builtinType(words []string) (*ctype, error) {
+	counts := make(map[string]int)
+	for _, w := range words {
+		counts[w]++
+	}
+	t := &ctype{base: strings.Join(words, " ")}
+	switch {
+	case counts["void"] != 0:
+		t.void = true
+		return t, nil
+	case counts["float"] != 0:
+		t.typ, t.size = wasmbind.TypeF32, 4
+	case counts["double"] != 0:
+		if counts["long"] != 0 {
+			return nil, fmt.Errorf("long double is not supported")
+		}
+		t.typ, t.size = wasmbind.TypeF64, 8
+	case counts["bool"] != 0 || counts["_Bool"] != 0:
+		t.typ, t.size = wasmbind.TypeU32, 1
+	case counts["char"] != 0:
+		t.typ, t.size = wasmbind.TypeI32, 1
+	case counts["short"] != 0:
+		t.typ, t.size = wasmbind.TypeI32, 2
+	case counts["long"] >= 2:
+		t.typ, t.size = wasmbind.TypeI64, 8
+	default:
+		// int and long are 32 bits in wasm32.
+		t.typ, t.size = wasmbind.TypeI32, 4
+	}
+	if counts["unsigned"] != 0 {
+		switch t.typ {
+		case wasmbind.TypeI32:
+			t.typ = wasmbind.TypeU32
+		case wasmbind.TypeI64:
+			t.typ = wasmbind.TypeU64
+		}
+	}
+	t.align = t.size
+	return t, nil
+}
+
+// resolveType resolves the tokens of a type without declarator names.
+func (p *Parser) resolveType(tokens []*token) (*ctype, error) {
+	var (
+		words   []string
+		pointer int
+		isConst bool
+		tag     string
+	)
+	for _, t := range tokens {
+		switch {
+		case t.is("const"):
+			if pointer == 0 {
+				isConst = true
+			}
+		case t.is("volatile"):
+		case t.is("*"):
+			pointer++
+		case t.is("&"), t.is("::"), t.is("<"):
+			return nil, fmt.Errorf("C++ type %s is not supported", spell(tokens))
+		case t.is("struct"), t.is("union"), t.is("enum"):
+			tag = t.value
+		case t.kind == tokenIdent:
+			words = append(words, t.value)
+		default:
+			return nil, fmt.Errorf("unsupported type %s", spell(tokens))
+		}
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("missing type in %s", spell(tokens))
+	}
+	base, err := p.resolveBase(tag, words)
+	if err != nil {
+		if pointer == 0 {
+			return nil, err
+		}
+		// pointers to unknown types are opaque handles.
+		base = &ctype{base: strings.TrimSpace(tag + " " + strings.Join(words, " "))}
+	}
+	ret := *base
+	ret.spelling = spell(tokens)
+	if pointer != 0 {
+		ret.pointer += pointer
+		ret.isConst = isConst
+		ret.void = false
+		ret.aggregate = nil
+		ret.typ, ret.size, ret.align = wasmbind.TypeU32, 4, 4
+	}
+	return &ret, nil
+}
+
+func (p *Parser) resolveBase(tag string, words []string) (*ctype, error) {
+	name := strings.Join(words, " ")
+	if tag != "" {
+		if len(words) != 1 {
+			return nil, fmt.Errorf("invalid type %s %s", tag, name)
+		}
+		if tag == "enum" {
+			return &ctype{base: "enum " + name, typ: wasmbind.TypeI32, size: 4, align: 4}, nil
+		}
+		agg, exists := p.aggregates[tag+" "+name]
+		if !exists {
+			return nil, fmt.Errorf("%s %s is not defined", tag, name)
+		}
+		return aggregateType(tag+" "+name, agg)
+	}
+	for _, w := range words {
+		if _, exists := builtinWords[w]; !exists {
+			if len(words) != 1 {
+				return nil, fmt.Errorf("unknown type %s", name)
+			}
+			return p.resolveNamed(name)
+		}
+	}
+	return builtinType(words)
+}
+
+func (p *Parser) resolveNamed(name string) (*ctype, error) {
+	if s, exists := namedScalars[name]; exists {
+		return &ctype{base: name, typ: s.typ, size: s.size, align: s.size}, nil
+	}
+	if tag, exists := p.tagAliases[name]; exists {
+		agg, exists := p.aggregates[tag]
+		if !exists {
+			return nil, fmt.Errorf("%s is incomplete", name)
+		}
+		return aggregateType(name, agg)
+	}
+	if t, exists := p.typedefs[name]; exists {
+		ret := *t
+		if t.pointer == 0 {
+			ret.base = name
+		}
+		return &ret, nil
+	}
+	if agg, exists := p.aggregates[name]; exists {
+		return aggregateType(name, agg)
+	}
+	return nil, fmt.Errorf("unknown type %s", name)
+}
+
+func aggregateType(name string, agg *aggregate) (*ctype, error) {
+	if !agg.complete {
+		return nil, fmt.Errorf("%s is incomplete", name)
+	}
+	return &ctype{base: name, size: agg.def.Size, align: agg.def.Align, aggregate: agg}, nil
+}
+
+// spell joins tokens as C source.
+func spell(tokens []*token) string {
+	var b strings.Builder
+	for i, t := range tokens {
+		if i != 0 && (t.kind == tokenIdent || t.kind == tokenNumber || t.is("*")) && !tokens[i-1].is("(") && !tokens[i-1].is("[") {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t.value)
+	}
+	return b.String()
+}
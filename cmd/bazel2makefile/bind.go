@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+type BindCommand struct {
+	Args struct {
+		Artifacts []string `positional-arg-name:"artifact"`
+	} `positional-args:"yes"`
+}
+
+func runBind(cfg *bazelmake.Config, cmd *BindCommand) error {
+	return bazelmake.WriteBindings(cfg, cmd.Args.Artifacts)
+}
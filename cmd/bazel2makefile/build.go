@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+type BuildCommand struct {
+	Jobs      int    `description:"number of actions run in parallel. defaults to the number of CPUs" short:"j" long:"jobs"`
+	Check     string `description:"how to decide whether an output is up to date" long:"check" default:"mtime" choice:"mtime" choice:"hash"`
+	ActionLog string `description:"write the executed actions as Makefile rules to the file" long:"action-log"`
+	DiskCache string `description:"directory of the disk cache storing the outputs of actions" long:"disk-cache"`
+	CacheSize string `description:"size the disk cache is trimmed to after the build like 512MB or 10GB" long:"disk-cache-size" default:"10GB"`
+}
+
+func runBuild(cfg *bazelmake.Config, cmd *BuildCommand) error {
+	project, err := bazelmake.NewProject(cfg)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return build(ctx, project, cmd)
+}
+
+func build(ctx context.Context, project *bazelmake.Project, cmd *BuildCommand) error {
+	opt := &bazelmake.ExecutorOption{
+		Jobs:  cmd.Jobs,
+		Check: cmd.Check,
+	}
+	if cmd.ActionLog != "" {
+		f, err := os.Create(cmd.ActionLog)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		opt.ActionLog = f
+	}
+	if cmd.DiskCache != "" {
+		maxSize, err := bazelmake.ParseSize(cmd.CacheSize)
+		if err != nil {
+			return err
+		}
+		opt.Cache = bazelmake.NewActionCache(cmd.DiskCache, maxSize)
+	}
+	executor, err := bazelmake.NewExecutor(project, opt)
+	if err != nil {
+		return err
+	}
+	return executor.Build(ctx)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+type CacheCommand struct {
+	GC CacheGCCommand `command:"gc" description:"remove the least recently used outputs from the disk cache"`
+}
+
+type CacheGCCommand struct {
+	DiskCache string `description:"directory of the disk cache" long:"disk-cache" required:"yes"`
+	MaxSize   string `description:"size the disk cache is trimmed to like 512MB or 10GB" long:"max-size" default:"10GB"`
+}
+
+func runCacheGC(w io.Writer, cmd *CacheGCCommand) error {
+	maxSize, err := bazelmake.ParseSize(cmd.MaxSize)
+	if err != nil {
+		return err
+	}
+	removed, freed, err := bazelmake.NewActionCache(cmd.DiskCache, maxSize).Trim(maxSize)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "removed %d outputs ( %d bytes )\n", removed, freed)
+	return nil
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+type ExportsCommand struct {
+	Output   string   `description:"path of the exports file" short:"o" long:"output" required:"yes"`
+	Patterns []string `description:"regular expression of exported symbols" long:"pattern" required:"yes"`
+	Args     struct {
+		Objects []string `positional-arg-name:"object"`
+	} `positional-args:"yes"`
+}
+
+func runExports(cmd *ExportsCommand) error {
+	return bazelmake.WriteExportsFile(cmd.Output, cmd.Args.Objects, cmd.Patterns)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+type IDLCommand struct {
+	Output  string `description:"path of the IDL. it is written to stdout by default" short:"o" long:"output"`
+	Exports string `description:"write the exported symbols one per line to the file" long:"exports"`
+	Args    struct {
+		Artifact string `positional-arg-name:"artifact" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func runIDL(w io.Writer, cfg *bazelmake.Config, cmd *IDLCommand) error {
+	project, err := bazelmake.NewProject(cfg)
+	if err != nil {
+		return err
+	}
+	var artifact *bazelmake.Artifact
+	for _, a := range project.Artifacts {
+		if a.Name() == cmd.Args.Artifact {
+			artifact = a
+		}
+	}
+	if artifact == nil {
+		return fmt.Errorf("unknown artifact: %s", cmd.Args.Artifact)
+	}
+	idl, warnings := artifact.IDL()
+	if idl == nil {
+		return fmt.Errorf("artifact %s has no headers or idl in the bind config", artifact.Name())
+	}
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+	content, err := idl.Marshal()
+	if err != nil {
+		return err
+	}
+	if cmd.Exports != "" {
+		symbols := strings.Join(idl.FunctionNames(), "\n") + "\n"
+		if err := os.WriteFile(cmd.Exports, []byte(symbols), 0o600); err != nil {
+			return err
+		}
+	}
+	if cmd.Output == "" {
+		_, err := w.Write(content)
+		return err
+	}
+	return os.WriteFile(cmd.Output, content, 0o600)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+type ImportsCommand struct {
+	Args struct {
+		Artifact string `positional-arg-name:"artifact" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+// runImports prints the function imports of the linked artifact with their actions.
+// The imports matching no config are marked as unresolved because the host must implement them.
+func runImports(w io.Writer, cfg *bazelmake.Config, cmd *ImportsCommand) error {
+	project, err := bazelmake.NewProject(cfg)
+	if err != nil {
+		return err
+	}
+	var artifact *bazelmake.Artifact
+	for _, a := range project.Artifacts {
+		if a.Name() == cmd.Args.Artifact {
+			artifact = a
+		}
+	}
+	if artifact == nil {
+		return fmt.Errorf("unknown artifact: %s", cmd.Args.Artifact)
+	}
+	imports, err := artifact.ModuleImports()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODULE\tNAME\tTYPE\tACTION")
+	for _, imp := range imports {
+		action := string(imp.Action())
+		if imp.Config == nil {
+			action += " (unresolved)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", imp.Module, imp.Name, imp.Type, action)
+	}
+	return tw.Flush()
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 
@@ -10,19 +11,112 @@ import (
 )
 
 type Option struct {
-	Config string `description:"specify config.yaml" short:"c" long:"config" default:"config.yaml"`
+	Config          string          `description:"specify config.yaml" short:"c" long:"config" default:"config.yaml"`
+	Format          string          `description:"specify output format" short:"f" long:"format" default:"make" choice:"make" choice:"ninja" choice:"cmake" choice:"compile_commands" choice:"template"`
+	CompileCommands bool            `description:"write compile_commands.json alongside the output" long:"compile-commands"`
+	Profile         string          `description:"apply the profile defined in the config" short:"p" long:"profile"`
+	Why             WhyCommand      `command:"why" description:"print the dependency paths from the configured targets to a label or file"`
+	Query           QueryCommand    `command:"query" description:"evaluate a bazel query expression against the resolved graph"`
+	Build           BuildCommand    `command:"build" description:"compile and link the resolved libraries without make"`
+	Cache           CacheCommand    `command:"cache" description:"manage the disk cache of the build command"`
+	Bind            BindCommand     `command:"bind" description:"generate the Go wazero bindings of the linked wasm modules"`
+	IDL             IDLCommand      `command:"idl" description:"write the IDL parsed from the C headers of an artifact"`
+	Size            SizeCommand     `command:"size" description:"print the code and data bytes each library or source contributes to a linked wasm module"`
+	Imports         ImportsCommand  `command:"imports" description:"print the function imports of a linked wasm module with their actions"`
+	Exports         ExportsCommand  `command:"exports" description:"write the wasm-ld export options of the symbols defined in wasm objects"`
+	PostLink        PostLinkCommand `command:"postlink" description:"optimize, strip and validate a linked wasm module"`
+	Stubs           StubsCommand    `command:"stubs" description:"write the C stubs of the functions left undefined by wasm objects"`
+	Test            TestCommand     `command:"test" description:"build the cc_test targets matching a pattern to wasm and run them with wazero"`
 }
 
-func run(args []string, opt *Option) error {
+func run(parser *flags.Parser, args []string, opt *Option) error {
+	if parser.Active != nil && parser.Active.Name == "cache" {
+		// the cache is shared by configs.
+		return runCacheGC(os.Stdout, &opt.Cache.GC)
+	}
+	if parser.Active != nil && parser.Active.Name == "exports" {
+		// exports runs from the generated build files without the config.
+		return runExports(&opt.Exports)
+	}
+	if parser.Active != nil && parser.Active.Name == "stubs" {
+		return runStubs(&opt.Stubs)
+	}
+	if parser.Active != nil && parser.Active.Name == "postlink" {
+		return runPostLink(&opt.PostLink)
+	}
 	cfg, err := bazelmake.LoadConfig(opt.Config)
 	if err != nil {
 		return err
 	}
-	makefile, err := bazelmake.CreateMakefile(cfg)
+	if opt.Profile != "" {
+		cfg, err = cfg.WithProfile(opt.Profile)
+		if err != nil {
+			return err
+		}
+	}
+	cfg, err = cfg.WithToolchain()
+	if err != nil {
+		return err
+	}
+	if parser.Active == nil || parser.Active.Name == "build" {
+		// the sources and the headers of the compat presets are compiled from the output directory.
+		if err := bazelmake.WriteCompatFiles(cfg); err != nil {
+			return err
+		}
+	}
+	if parser.Active != nil {
+		switch parser.Active.Name {
+		case "why":
+			return runWhy(os.Stdout, cfg, &opt.Why)
+		case "query":
+			return runQuery(os.Stdout, cfg, &opt.Query)
+		case "build":
+			return runBuild(cfg, &opt.Build)
+		case "bind":
+			return runBind(cfg, &opt.Bind)
+		case "idl":
+			return runIDL(os.Stdout, cfg, &opt.IDL)
+		case "size":
+			return runSize(os.Stdout, cfg, &opt.Size)
+		case "imports":
+			return runImports(os.Stdout, cfg, &opt.Imports)
+		case "test":
+			// the compat files are written by runTest after the tests replace the targets.
+			return runTest(os.Stdout, cfg, &opt.Test)
+		}
+	}
+	if err := generate(cfg, opt.Format); err != nil {
+		return err
+	}
+	if opt.CompileCommands && opt.Format != "compile_commands" {
+		return generate(cfg, "compile_commands")
+	}
+	return nil
+}
+
+var generators = map[string]struct {
+	fileName string
+	create   func(*bazelmake.Config) ([]byte, error)
+}{
+	"make":             {fileName: "Makefile", create: bazelmake.CreateMakefile},
+	"ninja":            {fileName: "build.ninja", create: bazelmake.CreateNinjaFile},
+	"cmake":            {fileName: "CMakeLists.txt", create: bazelmake.CreateCMakeLists},
+	"compile_commands": {fileName: "compile_commands.json", create: bazelmake.CreateCompileCommands},
+}
+
+func generate(cfg *bazelmake.Config, format string) error {
+	if format == "template" {
+		return bazelmake.RenderTemplates(cfg)
+	}
+	generator, exists := generators[format]
+	if !exists {
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+	content, err := generator.create(cfg)
 	if err != nil {
 		return err
 	}
-	if err := os.WriteFile("Makefile", makefile, 0o600); err != nil {
+	if err := os.WriteFile(generator.fileName, content, 0o600); err != nil {
 		return err
 	}
 	return nil
@@ -31,11 +125,12 @@ func run(args []string, opt *Option) error {
 func main() {
 	var opt Option
 	parser := flags.NewParser(&opt, flags.Default)
+	parser.SubcommandsOptional = true
 	args, err := parser.Parse()
 	if err != nil {
 		return
 	}
-	if err := run(args, &opt); err != nil {
-		log.Print(err)
+	if err := run(parser, args, &opt); err != nil {
+		log.Fatal(err)
 	}
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+type PostLinkCommand struct {
+	Output       string   `description:"path of the processed module" short:"o" long:"output" required:"yes"`
+	WasmOpt      string   `description:"command of wasm-opt" long:"wasm-opt"`
+	WasmMetaDCE  string   `description:"command of wasm-metadce" long:"wasm-metadce"`
+	Passes       []string `description:"option of wasm-opt like --pass=-O3" long:"pass"`
+	MetaDCE      bool     `description:"remove the exports outside the export list with wasm-metadce" long:"metadce"`
+	KeepExports  []string `description:"export kept by metadce" long:"keep-export"`
+	ExportsFile  string   `description:"file of the exports kept by metadce" long:"exports-file"`
+	Strip        bool     `description:"strip the custom sections" long:"strip"`
+	KeepSections []string `description:"custom section kept by strip like name" long:"keep-section"`
+	Validate     bool     `description:"validate the processed module" long:"validate"`
+	Args         struct {
+		Input string `positional-arg-name:"module" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func runPostLink(cmd *PostLinkCommand) error {
+	exports := cmd.KeepExports
+	if cmd.ExportsFile != "" {
+		symbols, err := bazelmake.ReadExportList(cmd.ExportsFile)
+		if err != nil {
+			return err
+		}
+		exports = append(exports, symbols...)
+	}
+	return bazelmake.PostLink(cmd.Args.Input, cmd.Output, &bazelmake.PostLinkConfig{
+		WasmOpt:      cmd.WasmOpt,
+		WasmMetaDCE:  cmd.WasmMetaDCE,
+		Passes:       cmd.Passes,
+		MetaDCE:      cmd.MetaDCE,
+		Strip:        cmd.Strip,
+		KeepSections: cmd.KeepSections,
+		Validate:     cmd.Validate,
+	}, exports)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+type QueryCommand struct {
+	Output string `description:"output format. label, label_kind, files or attr:<name>" long:"output" default:"label"`
+	Args   struct {
+		Expr string `positional-arg-name:"expression" description:"query expression like deps(@repo//path/to:name)"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func runQuery(w io.Writer, cfg *bazelmake.Config, cmd *QueryCommand) error {
+	output := cmd.Output
+	var attr string
+	if strings.HasPrefix(output, "attr:") {
+		attr = strings.TrimPrefix(output, "attr:")
+		output = "attr"
+	}
+	switch output {
+	case "label", "label_kind", "files", "attr":
+	default:
+		return fmt.Errorf("unsupported output format: %s", cmd.Output)
+	}
+	libs, err := bazelmake.Query(cfg, cmd.Args.Expr)
+	if err != nil {
+		return err
+	}
+	for _, lib := range libs {
+		switch output {
+		case "label":
+			fmt.Fprintln(w, lib.FQDN())
+		case "label_kind":
+			fmt.Fprintf(w, "%s rule %s\n", lib.Kind, lib.FQDN())
+		case "files":
+			for _, src := range lib.SourcePaths(cfg.Root) {
+				fmt.Fprintln(w, src)
+			}
+			for _, hdr := range lib.HeaderPaths(cfg.Root) {
+				fmt.Fprintln(w, hdr)
+			}
+		case "attr":
+			values, exists := lib.Attributes[attr]
+			if !exists {
+				continue
+			}
+			fmt.Fprintf(w, "%s %s=[%s]\n", lib.FQDN(), attr, strings.Join(values, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+type SizeCommand struct {
+	By   string `description:"group the bytes by library or source" long:"by" default:"library" choice:"library" choice:"source"`
+	Sort string `description:"sort the entries by size, code, data or name" long:"sort" default:"size" choice:"size" choice:"code" choice:"data" choice:"name"`
+	JSON bool   `description:"write the report as JSON" long:"json"`
+	Args struct {
+		Artifact string `positional-arg-name:"artifact" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func runSize(w io.Writer, cfg *bazelmake.Config, cmd *SizeCommand) error {
+	project, err := bazelmake.NewProject(cfg)
+	if err != nil {
+		return err
+	}
+	var artifact *bazelmake.Artifact
+	for _, a := range project.Artifacts {
+		if a.Name() == cmd.Args.Artifact {
+			artifact = a
+		}
+	}
+	if artifact == nil {
+		return fmt.Errorf("unknown artifact: %s", cmd.Args.Artifact)
+	}
+	report, err := artifact.SizeReport(bazelmake.SizeGroup(cmd.By))
+	if err != nil {
+		return err
+	}
+	if err := report.Sort(bazelmake.SizeOrder(cmd.Sort)); err != nil {
+		return err
+	}
+	if cmd.JSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "CODE\tDATA\tTOTAL\t%\t  NAME")
+	for _, e := range report.Entries {
+		name := e.Name
+		if e.External {
+			name += " (external)"
+		}
+		if len(e.Ambiguous) != 0 {
+			name += " (one of " + strings.Join(e.Ambiguous, ", ") + ")"
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%s\t  %s\n", e.Code, e.Data, e.Size(), percent(e.Size(), report.FileSize), name)
+	}
+	fmt.Fprintf(tw, "%d\t%d\t%d\t%s\t  %s (%d bytes)\n", report.Code, report.Data, report.Code+report.Data,
+		percent(report.Code+report.Data, report.FileSize), report.Artifact, report.FileSize)
+	return tw.Flush()
+}
+
+func percent(n, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", float64(n)*100/float64(total))
+}
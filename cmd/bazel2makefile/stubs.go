@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+type StubsCommand struct {
+	Output string   `description:"path of the C source of the stubs" short:"o" long:"output" required:"yes"`
+	Stubs  []string `description:"MODULE:NAME=RETURN of imports defined to return the value" long:"stub"`
+	Traps  []string `description:"MODULE:NAME of imports defined to trap" long:"trap"`
+	Args   struct {
+		Objects []string `positional-arg-name:"object"`
+	} `positional-args:"yes"`
+}
+
+func runStubs(cmd *StubsCommand) error {
+	var imports []*bazelmake.ImportConfig
+	for _, arg := range cmd.Stubs {
+		imp, err := bazelmake.ParseImportArgument(arg, bazelmake.ImportStub)
+		if err != nil {
+			return err
+		}
+		imports = append(imports, imp)
+	}
+	for _, arg := range cmd.Traps {
+		imp, err := bazelmake.ParseImportArgument(arg, bazelmake.ImportTrap)
+		if err != nil {
+			return err
+		}
+		imports = append(imports, imp)
+	}
+	return bazelmake.WriteImportStubs(cmd.Output, cmd.Args.Objects, imports)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+type TestCommand struct {
+	BuildCommand
+	JUnit   string        `description:"write the JUnit XML report to the file" long:"junit" default:"test.xml"`
+	Timeout time.Duration `description:"override the timeout of every test decided by its size and timeout attributes like 30s" long:"timeout"`
+	Output  bool          `description:"print the output of the failed tests" long:"output"`
+	Args    struct {
+		Pattern string `positional-arg-name:"pattern" description:"label pattern of the cc_test targets like //absl/strings/... or //absl/strings:str_cat_test"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func runTest(w io.Writer, cfg *bazelmake.Config, cmd *TestCommand) error {
+	cfg, err := cfg.WithTests(cmd.Args.Pattern)
+	if err != nil {
+		return err
+	}
+	if err := bazelmake.WriteCompatFiles(cfg); err != nil {
+		return err
+	}
+	project, err := bazelmake.NewProject(cfg)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := build(ctx, project, &cmd.BuildCommand); err != nil {
+		return err
+	}
+	results, err := bazelmake.RunTests(ctx, project, &bazelmake.TestOption{
+		Jobs:    cmd.Jobs,
+		Timeout: cmd.Timeout,
+	})
+	if err != nil {
+		return err
+	}
+	var failed int
+	for _, result := range results {
+		status := result.Status()
+		fmt.Fprintf(w, "%-7s %s (%.1fs)\n", status, result.Test.FQDN(), result.Duration().Seconds())
+		if status == bazelmake.TestPassed {
+			continue
+		}
+		failed++
+		for _, shard := range result.Shards {
+			if shard.Status == bazelmake.TestPassed {
+				continue
+			}
+			fmt.Fprintf(w, "  shard %d of %d: %s\n", shard.Index+1, shard.Total, shard.Message)
+			if cmd.Output {
+				w.Write(shard.Output)
+			}
+		}
+	}
+	f, err := os.Create(cmd.JUnit)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := bazelmake.WriteJUnitReport(f, results); err != nil {
+		return err
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d tests failed", failed, len(results))
+	}
+	return nil
+}
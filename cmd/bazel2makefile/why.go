@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/goccy/go-wasmbind-tools/bazelmake"
+)
+
+type WhyCommand struct {
+	MaxPaths int `description:"stop after printing the number of paths. 0 prints every path" long:"max-paths" default:"100"`
+	Args     struct {
+		Query string `positional-arg-name:"label-or-file" description:"label like @repo//path/to:name or source/header path"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+func runWhy(w io.Writer, cfg *bazelmake.Config, cmd *WhyCommand) error {
+	result, err := bazelmake.Why(cfg, cmd.Args.Query, cmd.MaxPaths)
+	if err != nil {
+		return err
+	}
+	if result.ConfigSource {
+		fmt.Fprintf(w, "%s is listed in sources of the config\n", result.Query)
+	}
+	for _, lib := range result.Matches {
+		if lib.FQDN() == result.Query {
+			continue
+		}
+		fmt.Fprintf(w, "%s is provided by %s\n", result.Query, lib.FQDN())
+	}
+	if len(result.Paths) == 0 {
+		if !result.ConfigSource {
+			fmt.Fprintf(w, "%s is not reachable from the configured targets\n", result.Query)
+		}
+		return nil
+	}
+	for i, path := range result.Paths {
+		fmt.Fprintf(w, "\npath %d:\n", i+1)
+		for depth, lib := range path.Libraries {
+			if depth == 0 {
+				fmt.Fprintf(w, "  %s\n", lib.FQDN())
+				continue
+			}
+			fmt.Fprintf(w, "  -> %s\n", lib.FQDN())
+		}
+		fmt.Fprintln(w, "  cut by ignoring any of:")
+		for _, cut := range path.Cuts {
+			fmt.Fprintf(w, "    - path: %s\n      name: %s\n", cut.Path, cut.Name)
+		}
+	}
+	if result.Truncated {
+		fmt.Fprintf(w, "\nstopped after %d paths. use --max-paths to print more\n", len(result.Paths))
+	}
+	fmt.Fprintln(w)
+	if len(result.Cuts) == 0 {
+		fmt.Fprintln(w, "no single ignore rule cuts every path")
+		return nil
+	}
+	if result.Truncated {
+		fmt.Fprintln(w, "ignore rules cutting every listed path:")
+	} else {
+		fmt.Fprintln(w, "ignore rules cutting every path:")
+	}
+	for _, cut := range result.Cuts {
+		fmt.Fprintf(w, "  - path: %s\n    name: %s\n", cut.Path, cut.Name)
+	}
+	return nil
+}
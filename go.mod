@@ -4,12 +4,13 @@ go 1.21.0
 
 require (
 	github.com/bazelbuild/buildtools v0.0.0-20231115204819-d4c9dccdfbb1
+	github.com/fatih/color v1.10.0
 	github.com/goccy/go-yaml v1.11.2
 	github.com/jessevdk/go-flags v1.5.0
+	github.com/tetratelabs/wazero v1.8.2
 )
 
 require (
-	github.com/fatih/color v1.10.0 // indirect
 	github.com/mattn/go-colorable v0.1.8 // indirect
 	github.com/mattn/go-isatty v0.0.12 // indirect
 	golang.org/x/sys v0.6.0 // indirect
@@ -0,0 +1,131 @@
+package wasm
+
+import (
+	"fmt"
+	"io"
+)
+
+// Symbol kinds of the linking section.
+const (
+	SymbolFunction byte = 0
+	SymbolData     byte = 1
+	SymbolGlobal   byte = 2
+	SymbolSection  byte = 3
+	SymbolTag      byte = 4
+	SymbolTable    byte = 5
+)
+
+// Symbol flags of the linking section.
+const (
+	SymbolBindingWeak      uint32 = 0x1
+	SymbolBindingLocal     uint32 = 0x2
+	SymbolVisibilityHidden uint32 = 0x4
+	SymbolUndefined        uint32 = 0x10
+	SymbolExported         uint32 = 0x20
+	SymbolExplicitName     uint32 = 0x40
+	SymbolNoStrip          uint32 = 0x80
+)
+
+// linkingSymbolTable is the subsection ID of the symbol table.
+const linkingSymbolTable = 8
+
+// Symbol is an entry of the symbol table of a relocatable object.
+type Symbol struct {
+	Kind  byte
+	Flags uint32
+	// Name is empty for section symbols and undefined symbols without an explicit name.
+	Name string
+	// Index is the function, global, tag or table index. It is not set for data symbols.
+	Index uint32
+}
+
+// IsDefined reports whether the symbol is defined in the object.
+func (s *Symbol) IsDefined() bool {
+	return s.Flags&SymbolUndefined == 0
+}
+
+// IsGlobal reports whether the symbol is visible from other objects.
+func (s *Symbol) IsGlobal() bool {
+	return s.Flags&SymbolBindingLocal == 0
+}
+
+func (m *Module) decodeLinkingSection(r *reader) error {
+	version, err := r.u32()
+	if err != nil {
+		return err
+	}
+	if version != 2 {
+		return fmt.Errorf("unsupported linking section version %d", version)
+	}
+	for r.pos < len(r.b) {
+		id, err := r.byte()
+		if err != nil {
+			return err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return err
+		}
+		end := r.pos + int(size)
+		if end > len(r.b) {
+			return io.ErrUnexpectedEOF
+		}
+		if id == linkingSymbolTable {
+			sr := &reader{b: r.b[r.pos:end]}
+			if err := sr.vec(func() error {
+				sym, err := sr.symbol()
+				if err != nil {
+					return err
+				}
+				m.Symbols = append(m.Symbols, sym)
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		r.pos = end
+	}
+	return nil
+}
+
+func (r *reader) symbol() (*Symbol, error) {
+	kind, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	flags, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	sym := &Symbol{Kind: kind, Flags: flags}
+	switch kind {
+	case SymbolFunction, SymbolGlobal, SymbolTag, SymbolTable:
+		if sym.Index, err = r.u32(); err != nil {
+			return nil, err
+		}
+		if sym.IsDefined() || flags&SymbolExplicitName != 0 {
+			if sym.Name, err = r.name(); err != nil {
+				return nil, err
+			}
+		}
+	case SymbolData:
+		if sym.Name, err = r.name(); err != nil {
+			return nil, err
+		}
+		if sym.IsDefined() {
+			// segment index, offset and size.
+			for i := 0; i < 3; i++ {
+				if _, err := r.u64(); err != nil {
+					return nil, err
+				}
+			}
+		}
+	case SymbolSection:
+		if sym.Index, err = r.u32(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported symbol kind %d", kind)
+	}
+	return sym, nil
+}
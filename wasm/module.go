@@ -0,0 +1,483 @@
+// Package wasm reads the parts of WebAssembly binaries needed to post-process linked modules and relocatable objects.
+package wasm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var magic = []byte{0x00, 0x61, 0x73, 0x6d}
+
+// Section IDs.
+const (
+	SectionCustom   byte = 0
+	SectionType     byte = 1
+	SectionImport   byte = 2
+	SectionFunction byte = 3
+	SectionTable    byte = 4
+	SectionMemory   byte = 5
+	SectionGlobal   byte = 6
+	SectionExport   byte = 7
+	SectionStart    byte = 8
+	SectionElement  byte = 9
+	SectionCode     byte = 10
+	SectionData     byte = 11
+	SectionDataCnt  byte = 12
+	SectionTag      byte = 13
+)
+
+// External kinds of imports and exports.
+const (
+	ExternalFunction byte = 0
+	ExternalTable    byte = 1
+	ExternalMemory   byte = 2
+	ExternalGlobal   byte = 3
+	ExternalTag      byte = 4
+)
+
+// Value types.
+const (
+	ValueI32       byte = 0x7f
+	ValueI64       byte = 0x7e
+	ValueF32       byte = 0x7d
+	ValueF64       byte = 0x7c
+	ValueV128      byte = 0x7b
+	ValueFuncref   byte = 0x70
+	ValueExternref byte = 0x6f
+)
+
+// ValueTypeName returns the name of a value type in the text format.
+func ValueTypeName(t byte) string {
+	switch t {
+	case ValueI32:
+		return "i32"
+	case ValueI64:
+		return "i64"
+	case ValueF32:
+		return "f32"
+	case ValueF64:
+		return "f64"
+	case ValueV128:
+		return "v128"
+	case ValueFuncref:
+		return "funcref"
+	case ValueExternref:
+		return "externref"
+	}
+	return fmt.Sprintf("0x%02x", t)
+}
+
+// Section is a section of a module. Offset and Size locate the payload in the binary.
+type Section struct {
+	ID byte
+	// Name is the name of a custom section.
+	Name    string
+	Offset  int
+	Size    int
+	Payload []byte
+}
+
+type FuncType struct {
+	Params  []byte
+	Results []byte
+}
+
+func (t *FuncType) String() string {
+	var b bytes.Buffer
+	b.WriteString("(")
+	for i, p := range t.Params {
+		if i != 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(ValueTypeName(p))
+	}
+	b.WriteString(") -> (")
+	for i, r := range t.Results {
+		if i != 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(ValueTypeName(r))
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+type Import struct {
+	Module string
+	Name   string
+	Kind   byte
+	// TypeIndex is the index of the function type of a function import.
+	TypeIndex uint32
+}
+
+type Export struct {
+	Name  string
+	Kind  byte
+	Index uint32
+}
+
+// Module is a decoded WebAssembly binary.
+type Module struct {
+	Sections []*Section
+	Types    []*FuncType
+	Imports  []*Import
+	// Functions are the type indices of the functions defined in the module.
+	Functions []uint32
+	Exports   []*Export
+	// CodeSizes are the sizes of the bodies of the defined functions.
+	CodeSizes []int
+	// FunctionNames maps function indices, which count imported functions first, to the names in the name section.
+	FunctionNames map[uint32]string
+	// Symbols are the symbols of a relocatable object in the linking section.
+	Symbols []*Symbol
+}
+
+// ReadFile decodes the WebAssembly binary at path.
+func ReadFile(path string) (*Module, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := Decode(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Decode decodes a WebAssembly binary.
+func Decode(b []byte) (*Module, error) {
+	if len(b) < 8 || !bytes.Equal(b[:4], magic) {
+		return nil, errors.New("not a WebAssembly binary")
+	}
+	m := &Module{}
+	r := &reader{b: b, pos: 8}
+	for r.pos < len(b) {
+		id, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		if r.pos+int(size) > len(b) {
+			return nil, fmt.Errorf("section %d exceeds the binary", id)
+		}
+		sec := &Section{ID: id, Offset: r.pos, Size: int(size), Payload: b[r.pos : r.pos+int(size)]}
+		r.pos += int(size)
+		if id == SectionCustom {
+			sr := &reader{b: sec.Payload}
+			name, err := sr.name()
+			if err != nil {
+				return nil, err
+			}
+			sec.Name = name
+		}
+		m.Sections = append(m.Sections, sec)
+		if err := m.decodeSection(sec); err != nil {
+			return nil, fmt.Errorf("failed to decode section %d %s: %w", sec.ID, sec.Name, err)
+		}
+	}
+	return m, nil
+}
+
+// CustomSection returns the custom section of name or nil.
+func (m *Module) CustomSection(name string) *Section {
+	for _, sec := range m.Sections {
+		if sec.ID == SectionCustom && sec.Name == name {
+			return sec
+		}
+	}
+	return nil
+}
+
+// ImportedFunctions returns the number of imported functions, which precede the defined functions in the index space.
+func (m *Module) ImportedFunctions() int {
+	var n int
+	for _, imp := range m.Imports {
+		if imp.Kind == ExternalFunction {
+			n++
+		}
+	}
+	return n
+}
+
+// FunctionType returns the type of the function at index in the function index space.
+func (m *Module) FunctionType(index uint32) (*FuncType, error) {
+	var typeIndex uint32
+	imported := uint32(m.ImportedFunctions())
+	if index < imported {
+		var i uint32
+		for _, imp := range m.Imports {
+			if imp.Kind != ExternalFunction {
+				continue
+			}
+			if i == index {
+				typeIndex = imp.TypeIndex
+				break
+			}
+			i++
+		}
+	} else {
+		if int(index-imported) >= len(m.Functions) {
+			return nil, fmt.Errorf("function index %d is out of range", index)
+		}
+		typeIndex = m.Functions[index-imported]
+	}
+	if int(typeIndex) >= len(m.Types) {
+		return nil, fmt.Errorf("type index %d is out of range", typeIndex)
+	}
+	return m.Types[typeIndex], nil
+}
+
+func (m *Module) decodeSection(sec *Section) error {
+	r := &reader{b: sec.Payload}
+	switch sec.ID {
+	case SectionType:
+		return r.vec(func() error {
+			form, err := r.byte()
+			if err != nil {
+				return err
+			}
+			if form != 0x60 {
+				return fmt.Errorf("unsupported type form 0x%02x", form)
+			}
+			params, err := r.bytes()
+			if err != nil {
+				return err
+			}
+			results, err := r.bytes()
+			if err != nil {
+				return err
+			}
+			m.Types = append(m.Types, &FuncType{Params: params, Results: results})
+			return nil
+		})
+	case SectionImport:
+		return r.vec(func() error {
+			imp := &Import{}
+			var err error
+			if imp.Module, err = r.name(); err != nil {
+				return err
+			}
+			if imp.Name, err = r.name(); err != nil {
+				return err
+			}
+			if imp.Kind, err = r.byte(); err != nil {
+				return err
+			}
+			switch imp.Kind {
+			case ExternalFunction:
+				imp.TypeIndex, err = r.u32()
+			case ExternalTable:
+				if _, err = r.byte(); err == nil {
+					err = r.limits()
+				}
+			case ExternalMemory:
+				err = r.limits()
+			case ExternalGlobal:
+				if _, err = r.byte(); err == nil {
+					_, err = r.byte()
+				}
+			case ExternalTag:
+				if _, err = r.byte(); err == nil {
+					_, err = r.u32()
+				}
+			default:
+				err = fmt.Errorf("unsupported import kind %d", imp.Kind)
+			}
+			if err != nil {
+				return err
+			}
+			m.Imports = append(m.Imports, imp)
+			return nil
+		})
+	case SectionFunction:
+		return r.vec(func() error {
+			idx, err := r.u32()
+			if err != nil {
+				return err
+			}
+			m.Functions = append(m.Functions, idx)
+			return nil
+		})
+	case SectionExport:
+		return r.vec(func() error {
+			exp := &Export{}
+			var err error
+			if exp.Name, err = r.name(); err != nil {
+				return err
+			}
+			if exp.Kind, err = r.byte(); err != nil {
+				return err
+			}
+			if exp.Index, err = r.u32(); err != nil {
+				return err
+			}
+			m.Exports = append(m.Exports, exp)
+			return nil
+		})
+	case SectionCode:
+		return r.vec(func() error {
+			size, err := r.u32()
+			if err != nil {
+				return err
+			}
+			if r.pos+int(size) > len(r.b) {
+				return io.ErrUnexpectedEOF
+			}
+			r.pos += int(size)
+			m.CodeSizes = append(m.CodeSizes, int(size))
+			return nil
+		})
+	case SectionCustom:
+		if _, err := r.name(); err != nil {
+			return err
+		}
+		switch sec.Name {
+		case "name":
+			return m.decodeNameSection(r)
+		case "linking":
+			return m.decodeLinkingSection(r)
+		}
+	}
+	return nil
+}
+
+func (m *Module) decodeNameSection(r *reader) error {
+	m.FunctionNames = make(map[uint32]string)
+	for r.pos < len(r.b) {
+		id, err := r.byte()
+		if err != nil {
+			return err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return err
+		}
+		end := r.pos + int(size)
+		if end > len(r.b) {
+			return io.ErrUnexpectedEOF
+		}
+		// subsection 1 is the function names.
+		if id == 1 {
+			sr := &reader{b: r.b[r.pos:end]}
+			if err := sr.vec(func() error {
+				idx, err := sr.u32()
+				if err != nil {
+					return err
+				}
+				name, err := sr.name()
+				if err != nil {
+					return err
+				}
+				m.FunctionNames[idx] = name
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		r.pos = end
+	}
+	return nil
+}
+
+type reader struct {
+	b   []byte
+	pos int
+}
+
+func (r *reader) byte() (byte, error) {
+	if r.pos >= len(r.b) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	b := r.b[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *reader) u32() (uint32, error) {
+	v, err := r.u64()
+	if err != nil {
+		return 0, err
+	}
+	if v > 0xffffffff {
+		return 0, errors.New("integer overflows u32")
+	}
+	return uint32(v), nil
+}
+
+func (r *reader) u64() (uint64, error) {
+	var (
+		v     uint64
+		shift uint
+	)
+	for {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return v, nil
+		}
+		shift += 7
+		if shift >= 64 {
+			return 0, errors.New("integer is too long")
+		}
+	}
+}
+
+func (r *reader) bytes() ([]byte, error) {
+	n, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	if r.pos+int(n) > len(r.b) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := r.b[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+func (r *reader) name() (string, error) {
+	b, err := r.bytes()
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (r *reader) limits() error {
+	flags, err := r.byte()
+	if err != nil {
+		return err
+	}
+	if _, err := r.u64(); err != nil {
+		return err
+	}
+	if flags&0x1 != 0 {
+		if _, err := r.u64(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *reader) vec(f func() error) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
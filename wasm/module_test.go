@@ -0,0 +1,81 @@
+package wasm_test
+
+import (
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/wasm"
+)
+
+func section(id byte, payload ...byte) []byte {
+	return append([]byte{id, byte(len(payload))}, payload...)
+}
+
+func TestDecode(t *testing.T) {
+	b := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	// (i32, i32) -> (i32) and () -> ()
+	b = append(b, section(wasm.SectionType, 2, 0x60, 2, 0x7f, 0x7f, 1, 0x7f, 0x60, 0, 0)...)
+	b = append(b, section(wasm.SectionImport, 1, 3, 'e', 'n', 'v', 3, 'a', 'd', 'd', 0x00, 0)...)
+	b = append(b, section(wasm.SectionFunction, 1, 1)...)
+	b = append(b, section(wasm.SectionExport, 1, 3, 'r', 'u', 'n', 0x00, 1)...)
+	b = append(b, section(wasm.SectionCode, 1, 2, 0, 0x0b)...)
+	b = append(b, section(wasm.SectionCustom, 4, 'n', 'a', 'm', 'e', 1, 6, 1, 1, 3, 'r', 'u', 'n')...)
+	m, err := wasm.Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Imports) != 1 || m.Imports[0].Module != "env" || m.Imports[0].Name != "add" {
+		t.Fatalf("unexpected imports: %+v", m.Imports)
+	}
+	typ, err := m.FunctionType(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := typ.String(); got != "(i32, i32) -> (i32)" {
+		t.Fatalf("unexpected type of the import: %s", got)
+	}
+	typ, err = m.FunctionType(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := typ.String(); got != "() -> ()" {
+		t.Fatalf("unexpected type of run: %s", got)
+	}
+	if len(m.Exports) != 1 || m.Exports[0].Name != "run" || m.Exports[0].Index != 1 {
+		t.Fatalf("unexpected exports: %+v", m.Exports)
+	}
+	if len(m.CodeSizes) != 1 || m.CodeSizes[0] != 2 {
+		t.Fatalf("unexpected code sizes: %v", m.CodeSizes)
+	}
+	if m.FunctionNames[1] != "run" {
+		t.Fatalf("unexpected function names: %v", m.FunctionNames)
+	}
+	if m.CustomSection("name") == nil {
+		t.Fatal("failed to find the name section")
+	}
+	if _, err := wasm.Decode([]byte("\x7fELF")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestStripCustomSections(t *testing.T) {
+	b := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	b = append(b, section(wasm.SectionType, 1, 0x60, 0, 0)...)
+	b = append(b, section(wasm.SectionCustom, 4, 'n', 'a', 'm', 'e', 1, 1, 0)...)
+	b = append(b, section(wasm.SectionCustom, 9, 'p', 'r', 'o', 'd', 'u', 'c', 'e', 'r', 's', 0)...)
+	stripped, err := wasm.StripCustomSections(b, func(name string) bool {
+		return name == "name"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := wasm.Decode(stripped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Sections) != 2 || m.CustomSection("name") == nil || len(m.Types) != 1 {
+		t.Fatalf("unexpected sections: %+v", m.Sections)
+	}
+	if len(stripped) != len(b)-13 {
+		t.Fatalf("unexpected size: %d", len(stripped))
+	}
+}
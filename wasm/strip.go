@@ -0,0 +1,34 @@
+package wasm
+
+// StripCustomSections returns b without the custom sections whose names keep does not accept.
+func StripCustomSections(b []byte, keep func(name string) bool) ([]byte, error) {
+	m, err := Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	ret := append([]byte{}, b[:8]...)
+	for _, sec := range m.Sections {
+		if sec.ID == SectionCustom && !keep(sec.Name) {
+			continue
+		}
+		ret = append(ret, sec.ID)
+		ret = appendU32(ret, uint32(sec.Size))
+		ret = append(ret, sec.Payload...)
+	}
+	return ret, nil
+}
+
+// appendU32 appends v in unsigned LEB128.
+func appendU32(b []byte, v uint32) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			return b
+		}
+	}
+}
@@ -0,0 +1,406 @@
+// Package wasmbind generates Go packages calling the exports of WebAssembly modules with wazero.
+package wasmbind
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"go/format"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/goccy/go-wasmbind-tools/wasm"
+)
+
+// Type is the Go type of a parameter or a result.
+type Type string
+
+const (
+	TypeI32 Type = "i32"
+	TypeU32 Type = "u32"
+	TypeI64 Type = "i64"
+	TypeU64 Type = "u64"
+	TypeF32 Type = "f32"
+	TypeF64 Type = "f64"
+	// TypeString and TypeBytes are copied into memory allocated by Options.Malloc.
+	// They are passed as a pointer and a length, and the memory is freed after the call.
+	TypeString Type = "string"
+	TypeBytes  Type = "bytes"
+	// TypeCString is a string terminated by NUL passed as a pointer.
+	// A result of TypeCString is read from memory owned by the module and is not freed.
+	TypeCString Type = "cstring"
+)
+
+// Param is a parameter of a function.
+type Param struct {
+	Name string `yaml:"name" json:"name"`
+	Type Type   `yaml:"type" json:"type"`
+}
+
+// Function describes the Go signature of an exported function.
+type Function struct {
+	// Name is the name of the export.
+	Name string `yaml:"name" json:"name"`
+	// GoName is the name of the method. It defaults to Name in CamelCase.
+	GoName  string   `yaml:"go_name" json:"go_name,omitempty"`
+	Params  []*Param `yaml:"params" json:"params"`
+	Results []Type   `yaml:"results" json:"results"`
+}
+
+// Options configures the generated package.
+type Options struct {
+	Package string
+	// WasmFile is the file name of the module embedded in the package.
+	WasmFile string
+	// Functions are the bound exports. Every exported function is bound with the types of the module if it is empty.
+	Functions []*Function
+	// Malloc and Free are the exports managing the memory of string and bytes parameters.
+	// They default to malloc and free.
+	Malloc string
+	Free   string
+	// Structs and Enums generate the Go types of the C API.
+	Structs []*Struct
+	Enums   []*Enum
+}
+
+//go:embed templates/bind.go.tmpl
+var bindTemplate string
+
+// reservedNames are the methods of the generated Module.
+var reservedNames = map[string]struct{}{
+	"Close":        {},
+	"Memory":       {},
+	"Malloc":       {},
+	"Free":         {},
+	"WriteBytes":   {},
+	"WriteString":  {},
+	"ReadBytes":    {},
+	"ReadString":   {},
+	"ReadCString":  {},
+	"WriteCString": {},
+}
+
+// Generate returns the source of the package binding the exports of m.
+func Generate(m *wasm.Module, opts *Options) ([]byte, error) {
+	if !token.IsIdentifier(opts.Package) {
+		return nil, fmt.Errorf("invalid package name: %q", opts.Package)
+	}
+	malloc := opts.Malloc
+	if malloc == "" {
+		malloc = "malloc"
+	}
+	free := opts.Free
+	if free == "" {
+		free = "free"
+	}
+	exports := make(map[string]*wasm.Export)
+	for _, exp := range m.Exports {
+		if exp.Kind == wasm.ExternalFunction {
+			exports[exp.Name] = exp
+		}
+	}
+	funcs := opts.Functions
+	if len(funcs) == 0 {
+		var err error
+		funcs, err = moduleFunctions(m, malloc, free)
+		if err != nil {
+			return nil, err
+		}
+	}
+	data := &bindData{
+		Package:  opts.Package,
+		WasmFile: opts.WasmFile,
+		Malloc:   malloc,
+		Free:     free,
+	}
+	for _, imp := range m.Imports {
+		if imp.Module == "wasi_snapshot_preview1" {
+			data.WASI = true
+		}
+	}
+	if _, exists := exports["_initialize"]; exists {
+		data.StartFunction = "_initialize"
+	}
+	types, err := newBindTypes(opts.Structs, opts.Enums)
+	if err != nil {
+		return nil, err
+	}
+	data.Structs = types.structs
+	data.Enums = types.enums
+	data.UsesMath = types.usesMath()
+	names := make(map[string]string)
+	for _, fn := range funcs {
+		exp, exists := exports[fn.Name]
+		if !exists {
+			return nil, fmt.Errorf("%s is not exported by the module", fn.Name)
+		}
+		typ, err := m.FunctionType(exp.Index)
+		if err != nil {
+			return nil, err
+		}
+		f, err := newBindFunction(fn, typ)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := types.methods[f.GoName]; exists {
+			return nil, fmt.Errorf("%s conflicts with the method %s. specify go_name", fn.Name, f.GoName)
+		}
+		if _, exists := reservedNames[f.GoName]; exists {
+			return nil, fmt.Errorf("%s conflicts with the method %s. specify go_name", fn.Name, f.GoName)
+		}
+		if name, exists := names[f.GoName]; exists {
+			return nil, fmt.Errorf("both %s and %s are bound to %s. specify go_name", name, fn.Name, f.GoName)
+		}
+		names[f.GoName] = fn.Name
+		if f.UsesMemory {
+			data.UsesMemory = true
+		}
+		data.Functions = append(data.Functions, f)
+	}
+	_, hasMalloc := exports[malloc]
+	_, hasFree := exports[free]
+	data.HasAllocator = hasMalloc && hasFree
+	if data.UsesMemory && !data.HasAllocator {
+		return nil, fmt.Errorf("%s and %s must be exported to pass string or bytes parameters", malloc, free)
+	}
+	tmpl, err := template.New("").Parse(bindTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format the generated source: %w", err)
+	}
+	return src, nil
+}
+
+// moduleFunctions returns the exported functions with the types of the module.
+func moduleFunctions(m *wasm.Module, malloc, free string) ([]*Function, error) {
+	var ret []*Function
+	for _, exp := range m.Exports {
+		if exp.Kind != wasm.ExternalFunction || strings.HasPrefix(exp.Name, "_") {
+			continue
+		}
+		if exp.Name == malloc || exp.Name == free {
+			continue
+		}
+		typ, err := m.FunctionType(exp.Index)
+		if err != nil {
+			return nil, err
+		}
+		fn := &Function{Name: exp.Name}
+		for i, p := range typ.Params {
+			t, err := valueType(p)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", exp.Name, err)
+			}
+			fn.Params = append(fn.Params, &Param{Name: fmt.Sprintf("p%d", i), Type: t})
+		}
+		for _, r := range typ.Results {
+			t, err := valueType(r)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", exp.Name, err)
+			}
+			fn.Results = append(fn.Results, t)
+		}
+		ret = append(ret, fn)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
+
+func valueType(t byte) (Type, error) {
+	switch t {
+	case wasm.ValueI32:
+		return TypeI32, nil
+	case wasm.ValueI64:
+		return TypeI64, nil
+	case wasm.ValueF32:
+		return TypeF32, nil
+	case wasm.ValueF64:
+		return TypeF64, nil
+	}
+	return "", fmt.Errorf("unsupported value type %s", wasm.ValueTypeName(t))
+}
+
+// goName converts a symbol like parse_json or COLOR_RED to ParseJson or ColorRed.
+func goName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if strings.ToUpper(part) == part {
+			part = strings.ToLower(part)
+		}
+		r := []rune(part)
+		b.WriteRune(unicode.ToUpper(r[0]))
+		b.WriteString(string(r[1:]))
+	}
+	ret := b.String()
+	if ret == "" || !unicode.IsLetter([]rune(ret)[0]) {
+		ret = "X" + ret
+	}
+	return ret
+}
+
+type bindData struct {
+	Package  string
+	WasmFile string
+	Malloc   string
+	Free     string
+	// WASI is true if the module imports wasi_snapshot_preview1.
+	WASI bool
+	// StartFunction is called on instantiation instead of _start.
+	StartFunction string
+	HasAllocator  bool
+	UsesMemory    bool
+	Functions     []*bindFunction
+	Structs       []*bindStruct
+	Enums         []*bindEnum
+	UsesMath      bool
+}
+
+type bindFunction struct {
+	Name       string
+	GoName     string
+	Field      string
+	Params     []*bindParam
+	Result     *bindResult
+	UsesMemory bool
+}
+
+type bindParam struct {
+	Name   string
+	GoType string
+	// Writer is the method copying the parameter into memory. It is empty for numbers.
+	Writer string
+	// Args are the expressions of the wasm arguments.
+	Args []string
+}
+
+type bindResult struct {
+	GoType string
+	Zero   string
+	// Decode is the expression converting results[0].
+	Decode string
+	// DecodeError is true if Decode returns an error too.
+	DecodeError bool
+}
+
+// paramNames are the identifiers the generated methods use besides the predeclared ones.
+// The imports other than api are not referenced in the methods.
+var paramNames = map[string]struct{}{
+	"ctx":     {},
+	"m":       {},
+	"err":     {},
+	"results": {},
+	"api":     {},
+}
+
+func newBindFunction(fn *Function, typ *wasm.FuncType) (*bindFunction, error) {
+	f := &bindFunction{Name: fn.Name, GoName: fn.GoName}
+	if f.GoName == "" {
+		f.GoName = goName(fn.Name)
+	}
+	if !token.IsIdentifier(f.GoName) || !token.IsExported(f.GoName) {
+		return nil, fmt.Errorf("invalid go_name of %s: %q", fn.Name, f.GoName)
+	}
+	f.Field = "fn" + f.GoName
+	var params []byte
+	names := make(map[string]struct{})
+	for i, p := range fn.Params {
+		name := p.Name
+		if name == "" {
+			name = fmt.Sprintf("p%d", i)
+		} else {
+			r := []rune(goName(name))
+			name = string(unicode.ToLower(r[0])) + string(r[1:])
+		}
+		if _, exists := paramNames[name]; exists || token.IsKeyword(name) || types.Universe.Lookup(name) != nil {
+			name += "_"
+		}
+		if _, exists := names[name]; exists {
+			return nil, fmt.Errorf("duplicate parameter of %s: %s", fn.Name, name)
+		}
+		names[name] = struct{}{}
+		param := &bindParam{Name: name}
+		switch p.Type {
+		case TypeI32, TypeU32, TypeI64, TypeU64, TypeF32, TypeF64:
+			param.GoType = numberTypes[p.Type].goType
+			param.Args = []string{fmt.Sprintf(numberTypes[p.Type].encode, name)}
+			params = append(params, numberTypes[p.Type].value)
+		case TypeString, TypeBytes:
+			param.GoType = "string"
+			param.Writer = "WriteString"
+			if p.Type == TypeBytes {
+				param.GoType = "[]byte"
+				param.Writer = "WriteBytes"
+			}
+			param.Args = []string{fmt.Sprintf("uint64(%sPtr)", name), fmt.Sprintf("uint64(len(%s))", name)}
+			params = append(params, wasm.ValueI32, wasm.ValueI32)
+			f.UsesMemory = true
+		case TypeCString:
+			param.GoType = "string"
+			param.Writer = "WriteCString"
+			param.Args = []string{fmt.Sprintf("uint64(%sPtr)", name)}
+			params = append(params, wasm.ValueI32)
+			f.UsesMemory = true
+		default:
+			return nil, fmt.Errorf("unsupported type of %s parameter %s: %q", fn.Name, p.Name, p.Type)
+		}
+		f.Params = append(f.Params, param)
+	}
+	for _, param := range f.Params {
+		if _, exists := names[param.Name+"Ptr"]; exists && param.Writer != "" {
+			return nil, fmt.Errorf("parameter %sPtr of %s collides with the pointer of %s", param.Name, fn.Name, param.Name)
+		}
+	}
+	var results []byte
+	switch len(fn.Results) {
+	case 0:
+	case 1:
+		if fn.Results[0] == TypeCString {
+			f.Result = &bindResult{GoType: "string", Zero: `""`, Decode: "m.ReadCString(api.DecodeU32(results[0]))", DecodeError: true}
+			results = append(results, wasm.ValueI32)
+			break
+		}
+		t, exists := numberTypes[fn.Results[0]]
+		if !exists {
+			return nil, fmt.Errorf("unsupported result type of %s: %q", fn.Name, fn.Results[0])
+		}
+		f.Result = &bindResult{GoType: t.goType, Zero: "0", Decode: t.decode}
+		results = append(results, t.value)
+	default:
+		return nil, fmt.Errorf("%s has multiple results, which are not supported", fn.Name)
+	}
+	expected := &wasm.FuncType{Params: params, Results: results}
+	if !bytes.Equal(typ.Params, params) || !bytes.Equal(typ.Results, results) {
+		return nil, fmt.Errorf("signature of %s mismatches the module: expected %s but the module has %s", fn.Name, expected, typ)
+	}
+	return f, nil
+}
+
+var numberTypes = map[Type]struct {
+	value  byte
+	goType string
+	// encode and decode are the formats of the conversions from and to the uint64 of api.Function.
+	encode string
+	decode string
+}{
+	TypeI32: {value: wasm.ValueI32, goType: "int32", encode: "api.EncodeI32(%s)", decode: "api.DecodeI32(results[0])"},
+	TypeU32: {value: wasm.ValueI32, goType: "uint32", encode: "api.EncodeU32(%s)", decode: "api.DecodeU32(results[0])"},
+	TypeI64: {value: wasm.ValueI64, goType: "int64", encode: "api.EncodeI64(%s)", decode: "int64(results[0])"},
+	TypeU64: {value: wasm.ValueI64, goType: "uint64", encode: "%s", decode: "results[0]"},
+	TypeF32: {value: wasm.ValueF32, goType: "float32", encode: "api.EncodeF32(%s)", decode: "api.DecodeF32(results[0])"},
+	TypeF64: {value: wasm.ValueF64, goType: "float64", encode: "api.EncodeF64(%s)", decode: "api.DecodeF64(results[0])"},
+}
@@ -0,0 +1,344 @@
+package wasmbind_test
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-wasmbind-tools/wasm"
+	"github.com/goccy/go-wasmbind-tools/wasmbind"
+)
+
+func section(id byte, payload ...byte) []byte {
+	return append([]byte{id, byte(len(payload))}, payload...)
+}
+
+func name(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+func export(s string, index byte) []byte {
+	return append(name(s), wasm.ExternalFunction, index)
+}
+
+// createModule returns a module exporting
+//
+//	0 _initialize () -> ()
+//	1 malloc      (i32) -> (i32)
+//	2 free        (i32) -> ()
+//	3 count_words (i32, i32) -> (i32)
+//	4 scale       (f64) -> (f64)
+func createModule(t *testing.T) *wasm.Module {
+	t.Helper()
+	b := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	b = append(b, section(wasm.SectionType,
+		5,
+		0x60, 0, 0,
+		0x60, 1, 0x7f, 1, 0x7f,
+		0x60, 1, 0x7f, 0,
+		0x60, 2, 0x7f, 0x7f, 1, 0x7f,
+		0x60, 1, 0x7c, 1, 0x7c,
+	)...)
+	b = append(b, section(wasm.SectionFunction, 5, 0, 1, 2, 3, 4)...)
+	var exports []byte
+	exports = append(exports, 5)
+	for i, s := range []string{"_initialize", "malloc", "free", "count_words", "scale"} {
+		exports = append(exports, export(s, byte(i))...)
+	}
+	b = append(b, section(wasm.SectionExport, exports...)...)
+	m, err := wasm.Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// sourceImporter type-checks the imports of the generated packages like wazero from the module cache.
+var sourceImporter = importer.ForCompiler(token.NewFileSet(), "source", nil)
+
+// checkSource parses and type-checks the generated source.
+func checkSource(t *testing.T, src []byte) {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "bind.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("failed to parse the generated source: %v\n%s", err, src)
+	}
+	conf := types.Config{Importer: sourceImporter}
+	if _, err := conf.Check(f.Name.Name, fset, []*ast.File{f}, nil); err != nil {
+		t.Fatalf("failed to type-check the generated source: %v\n%s", err, src)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	m := createModule(t)
+	t.Run("module types", func(t *testing.T) {
+		src, err := wasmbind.Generate(m, &wasmbind.Options{Package: "words", WasmFile: "words.wasm"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{
+			"//go:embed words.wasm",
+			`config = config.WithStartFunctions("_initialize")`,
+			"func (m *Module) CountWords(ctx context.Context, p0 int32, p1 int32) (int32, error) {",
+			"func (m *Module) Scale(ctx context.Context, p0 float64) (float64, error) {",
+			"func (m *Module) Malloc(ctx context.Context, size uint32) (uint32, error) {",
+		} {
+			if !strings.Contains(string(src), expected) {
+				t.Fatalf("failed to find %q in\n%s", expected, src)
+			}
+		}
+		if strings.Contains(string(src), "wasi_snapshot_preview1") {
+			t.Fatal("unexpected WASI")
+		}
+		checkSource(t, src)
+	})
+	t.Run("configured functions", func(t *testing.T) {
+		src, err := wasmbind.Generate(m, &wasmbind.Options{
+			Package:  "words",
+			WasmFile: "words.wasm",
+			Functions: []*wasmbind.Function{
+				{
+					Name:    "count_words",
+					Params:  []*wasmbind.Param{{Name: "text", Type: wasmbind.TypeString}},
+					Results: []wasmbind.Type{wasmbind.TypeU32},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{
+			"func (m *Module) CountWords(ctx context.Context, text string) (uint32, error) {",
+			"textPtr, err := m.WriteString(ctx, text)",
+			"defer m.Free(ctx, textPtr)",
+			"results, err := m.fnCountWords.Call(ctx, uint64(textPtr), uint64(len(text)))",
+			"return api.DecodeU32(results[0]), nil",
+		} {
+			if !strings.Contains(string(src), expected) {
+				t.Fatalf("failed to find %q in\n%s", expected, src)
+			}
+		}
+		if strings.Contains(string(src), "Scale") {
+			t.Fatal("unexpected binding of scale")
+		}
+		checkSource(t, src)
+	})
+	t.Run("idl", func(t *testing.T) {
+		src, err := wasmbind.Generate(m, &wasmbind.Options{
+			Package:  "words",
+			WasmFile: "words.wasm",
+			Functions: []*wasmbind.Function{
+				{Name: "count_words", Params: []*wasmbind.Param{{Name: "text", Type: wasmbind.TypeCString}, {Name: "n", Type: wasmbind.TypeU32}}, Results: []wasmbind.Type{wasmbind.TypeCString}},
+			},
+			Enums: []*wasmbind.Enum{
+				{Name: "words_status", Values: []*wasmbind.EnumValue{{Name: "WORDS_OK"}, {Name: "WORDS_ERROR", Value: -1}}},
+			},
+			Structs: []*wasmbind.Struct{
+				{
+					Name:  "words_point",
+					Size:  16,
+					Align: 8,
+					Fields: []*wasmbind.Field{
+						{Name: "x", Type: wasmbind.TypeI32, Size: 1},
+						{Name: "y", Type: wasmbind.TypeF64, Offset: 8, Size: 8},
+					},
+				},
+				{Name: "words_array", Size: 16, Align: 4, Fields: []*wasmbind.Field{{Name: "v", Size: 16}}},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{
+			"func (m *Module) CountWords(ctx context.Context, text string, n uint32) (string, error) {",
+			"textPtr, err := m.WriteCString(ctx, text)",
+			"return m.ReadCString(api.DecodeU32(results[0]))",
+			"WordsError WordsStatus = -1",
+			"type WordsPoint struct {\n\tX int8\n\tY float64\n}",
+			"v.Y = math.Float64frombits(binary.LittleEndian.Uint64(b[8:]))",
+			"b[0] = byte(v.X)",
+			"func (m *Module) WriteWordsPoint(ctx context.Context, v *WordsPoint) (uint32, error) {",
+		} {
+			if !strings.Contains(string(src), expected) {
+				t.Fatalf("failed to find %q in\n%s", expected, src)
+			}
+		}
+		if strings.Contains(string(src), "WordsArray") {
+			t.Fatal("unexpected struct with an array")
+		}
+		checkSource(t, src)
+	})
+	t.Run("reserved parameter names", func(t *testing.T) {
+		src, err := wasmbind.Generate(m, &wasmbind.Options{
+			Package:  "words",
+			WasmFile: "words.wasm",
+			Functions: []*wasmbind.Function{
+				{Name: "count_words", Params: []*wasmbind.Param{{Name: "len", Type: wasmbind.TypeCString}, {Name: "api", Type: wasmbind.TypeU32}}, Results: []wasmbind.Type{wasmbind.TypeU32}},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "func (m *Module) CountWords(ctx context.Context, len_ string, api_ uint32) (uint32, error) {"
+		if !strings.Contains(string(src), expected) {
+			t.Fatalf("failed to find %q in\n%s", expected, src)
+		}
+		checkSource(t, src)
+	})
+	t.Run("pointer collision", func(t *testing.T) {
+		_, err := wasmbind.Generate(m, &wasmbind.Options{
+			Package:  "words",
+			WasmFile: "words.wasm",
+			Functions: []*wasmbind.Function{
+				{Name: "count_words", Params: []*wasmbind.Param{{Name: "a", Type: wasmbind.TypeCString}, {Name: "a_ptr", Type: wasmbind.TypeU32}}, Results: []wasmbind.Type{wasmbind.TypeU32}},
+			},
+		})
+		if err == nil || err.Error() != "parameter aPtr of count_words collides with the pointer of a" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	t.Run("signature mismatch", func(t *testing.T) {
+		_, err := wasmbind.Generate(m, &wasmbind.Options{
+			Package:  "words",
+			WasmFile: "words.wasm",
+			Functions: []*wasmbind.Function{
+				{Name: "scale", Params: []*wasmbind.Param{{Name: "v", Type: wasmbind.TypeF32}}, Results: []wasmbind.Type{wasmbind.TypeF64}},
+			},
+		})
+		if err == nil || !strings.Contains(err.Error(), "expected (f32) -> (f64) but the module has (f64) -> (f64)") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	t.Run("reserved name", func(t *testing.T) {
+		_, err := wasmbind.Generate(m, &wasmbind.Options{
+			Package:   "words",
+			WasmFile:  "words.wasm",
+			Functions: []*wasmbind.Function{{Name: "free", Params: []*wasmbind.Param{{Type: wasmbind.TypeI32}}}},
+		})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+// TestGenerateCall builds the package generated from a module adding two numbers and calls the export through wazero.
+func TestGenerateCall(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a program with the go command")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command is not found")
+	}
+	// _initialize () -> () and add (i32, i32) -> (i32).
+	b := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	b = append(b, section(wasm.SectionType, 2, 0x60, 0, 0, 0x60, 2, 0x7f, 0x7f, 1, 0x7f)...)
+	b = append(b, section(wasm.SectionFunction, 2, 0, 1)...)
+	b = append(b, section(wasm.SectionExport, append(append([]byte{2}, export("_initialize", 0)...), export("add", 1)...)...)...)
+	b = append(b, section(wasm.SectionCode, 2, 2, 0x00, 0x0b, 7, 0x00, 0x20, 0, 0x20, 1, 0x6a, 0x0b)...)
+	m, err := wasm.Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := wasmbind.Generate(m, &wasmbind.Options{Package: "adder", WasmFile: "adder.wasm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	goSum, err := os.ReadFile(filepath.Join("..", "go.sum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"go.mod":           []byte("module bindtest\n\ngo 1.21\n\nrequire github.com/tetratelabs/wazero v1.8.2\n"),
+		"go.sum":           goSum,
+		"adder/adder.go":   src,
+		"adder/adder.wasm": b,
+		"main.go": []byte(`package main
+
+import (
+	"context"
+	"fmt"
+
+	"bindtest/adder"
+)
+
+func main() {
+	ctx := context.Background()
+	m, err := adder.New(ctx, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer m.Close(ctx)
+	v, err := m.Add(ctx, 40, 2)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Print(v)
+}
+`),
+	}
+	for path, content := range files {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(goCmd, "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to run the generated binding: %v\n%s", err, out)
+	}
+	if string(out) != "42" {
+		t.Fatalf("unexpected result: %s", out)
+	}
+}
+
+func TestGenerateHost(t *testing.T) {
+	src, err := wasmbind.GenerateHost("words", []*wasmbind.HostFunction{
+		{Module: "env", Name: "now_ms", Type: &wasm.FuncType{Results: []byte{wasm.ValueI64}}},
+		{Module: "env", Name: "log_msg", Type: &wasm.FuncType{Params: []byte{wasm.ValueI32, wasm.ValueI32}}},
+		{Module: "js", Name: "div", Type: &wasm.FuncType{Params: []byte{wasm.ValueF64, wasm.ValueF64}, Results: []byte{wasm.ValueF64, wasm.ValueI32}}},
+		{Module: "wasi:io/poll", Name: "[method]pollable.block", Type: &wasm.FuncType{Params: []byte{wasm.ValueI32}}},
+		{Module: "wasi:io/poll", Name: "3d-poll", Type: &wasm.FuncType{Results: []byte{wasm.ValueI32}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"type EnvHost interface {\n\tLogMsg(ctx context.Context, mod api.Module, p0 int32, p1 int32)\n\tNowMs(ctx context.Context, mod api.Module) int64\n}",
+		"Div(ctx context.Context, mod api.Module, p0 float64, p1 float64) (float64, int32)",
+		`NewFunctionBuilder().WithFunc(host.NowMs).Export("now_ms").`,
+		"func InstantiateJs(ctx context.Context, r wazero.Runtime, host JsHost) (api.Module, error) {",
+		"type WasiIoPollHost interface {\n\tX3dPoll(ctx context.Context, mod api.Module) int32\n\tMethodPollableBlock(ctx context.Context, mod api.Module, p0 int32)\n}",
+		`return r.NewHostModuleBuilder("wasi:io/poll").`,
+		`NewFunctionBuilder().WithFunc(host.MethodPollableBlock).Export("[method]pollable.block").`,
+	} {
+		if !strings.Contains(string(src), expected) {
+			t.Fatalf("generated source does not contain %q:\n%s", expected, src)
+		}
+	}
+	checkSource(t, src)
+	t.Run("name conflict", func(t *testing.T) {
+		_, err := wasmbind.GenerateHost("words", []*wasmbind.HostFunction{
+			{Module: "env", Name: "log_msg", Type: &wasm.FuncType{}},
+			{Module: "env", Name: "logMsg", Type: &wasm.FuncType{}},
+		})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package wasmbind
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"go/format"
+	"go/token"
+	"sort"
+	"text/template"
+
+	"github.com/goccy/go-wasmbind-tools/wasm"
+)
+
+// HostFunction is a function imported by a module and implemented by the host.
+type HostFunction struct {
+	Module string
+	Name   string
+	Type   *wasm.FuncType
+}
+
+//go:embed templates/host.go.tmpl
+var hostTemplate string
+
+var hostTypes = map[byte]string{
+	wasm.ValueI32: "int32",
+	wasm.ValueI64: "int64",
+	wasm.ValueF32: "float32",
+	wasm.ValueF64: "float64",
+}
+
+type hostModule struct {
+	Name      string
+	GoName    string
+	Functions []*hostFunction
+}
+
+type hostFunction struct {
+	Name    string
+	GoName  string
+	Params  []string
+	Results []string
+}
+
+// GenerateHost returns the source of the package implementing the imports of a module with wazero host modules.
+// Every module gets an interface of its functions and a function instantiating it in a runtime.
+func GenerateHost(pkg string, funcs []*HostFunction) ([]byte, error) {
+	if !token.IsIdentifier(pkg) {
+		return nil, fmt.Errorf("invalid package name: %q", pkg)
+	}
+	moduleMap := make(map[string]*hostModule)
+	var modules []*hostModule
+	for _, fn := range funcs {
+		mod, exists := moduleMap[fn.Module]
+		if !exists {
+			mod = &hostModule{Name: fn.Module, GoName: goName(fn.Module)}
+			moduleMap[fn.Module] = mod
+			modules = append(modules, mod)
+		}
+		f := &hostFunction{Name: fn.Name, GoName: goName(fn.Name)}
+		for _, p := range fn.Type.Params {
+			t, exists := hostTypes[p]
+			if !exists {
+				return nil, fmt.Errorf("%s.%s: unsupported value type %s", fn.Module, fn.Name, wasm.ValueTypeName(p))
+			}
+			f.Params = append(f.Params, t)
+		}
+		for _, r := range fn.Type.Results {
+			t, exists := hostTypes[r]
+			if !exists {
+				return nil, fmt.Errorf("%s.%s: unsupported value type %s", fn.Module, fn.Name, wasm.ValueTypeName(r))
+			}
+			f.Results = append(f.Results, t)
+		}
+		mod.Functions = append(mod.Functions, f)
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Name < modules[j].Name
+	})
+	goNames := make(map[string]string)
+	for _, mod := range modules {
+		if name, exists := goNames[mod.GoName]; exists {
+			return nil, fmt.Errorf("both modules %s and %s are named %s", name, mod.Name, mod.GoName)
+		}
+		goNames[mod.GoName] = mod.Name
+		sort.Slice(mod.Functions, func(i, j int) bool {
+			return mod.Functions[i].Name < mod.Functions[j].Name
+		})
+		names := make(map[string]string)
+		for _, fn := range mod.Functions {
+			if name, exists := names[fn.GoName]; exists {
+				return nil, fmt.Errorf("both %s.%s and %s.%s are named %s", mod.Name, name, mod.Name, fn.Name, fn.GoName)
+			}
+			names[fn.GoName] = fn.Name
+		}
+	}
+	tmpl, err := template.New("").Parse(hostTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, struct {
+		Package string
+		Modules []*hostModule
+	}{Package: pkg, Modules: modules}); err != nil {
+		return nil, err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format the generated source: %w", err)
+	}
+	return src, nil
+}
@@ -0,0 +1,83 @@
+package wasmbind
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/goccy/go-yaml"
+)
+
+// IDL describes the C API of a module for the generator.
+type IDL struct {
+	Functions []*Function `yaml:"functions"`
+	Structs   []*Struct   `yaml:"structs"`
+	Enums     []*Enum     `yaml:"enums"`
+}
+
+// Struct is a C struct in the layout of wasm32.
+type Struct struct {
+	Name   string   `yaml:"name"`
+	Size   uint32   `yaml:"size"`
+	Align  uint32   `yaml:"align"`
+	Fields []*Field `yaml:"fields"`
+}
+
+// Field is a member of a struct.
+// Type is empty unless the member is a number or a pointer, which are the members readable from Go.
+type Field struct {
+	Name   string `yaml:"name"`
+	CType  string `yaml:"ctype"`
+	Type   Type   `yaml:"type,omitempty"`
+	Offset uint32 `yaml:"offset"`
+	Size   uint32 `yaml:"size"`
+}
+
+// Enum is a C enum, which is an i32 in wasm32.
+type Enum struct {
+	Name   string       `yaml:"name"`
+	Values []*EnumValue `yaml:"values"`
+}
+
+type EnumValue struct {
+	Name  string `yaml:"name"`
+	Value int64  `yaml:"value"`
+}
+
+// FunctionNames returns the names of Functions, which are the exports of the module.
+func (idl *IDL) FunctionNames() []string {
+	ret := make([]string, 0, len(idl.Functions))
+	for _, fn := range idl.Functions {
+		ret = append(ret, fn.Name)
+	}
+	return ret
+}
+
+// UsesMemory reports whether a function passes strings or bytes, which requires the allocator of the module.
+func (idl *IDL) UsesMemory() bool {
+	for _, fn := range idl.Functions {
+		for _, p := range fn.Params {
+			if p.Type == TypeString || p.Type == TypeBytes || p.Type == TypeCString {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadIDL reads the IDL in YAML.
+func ReadIDL(path string) (*IDL, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var idl IDL
+	if err := yaml.UnmarshalWithOptions(content, &idl, yaml.Strict()); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return &idl, nil
+}
+
+// Marshal encodes idl in YAML.
+func (idl *IDL) Marshal() ([]byte, error) {
+	return yaml.Marshal(idl)
+}
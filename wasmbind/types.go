@@ -0,0 +1,150 @@
+package wasmbind
+
+import (
+	"fmt"
+)
+
+type bindTypes struct {
+	structs []*bindStruct
+	enums   []*bindEnum
+	// methods are the methods of Module generated for the structs.
+	methods map[string]struct{}
+}
+
+type bindEnum struct {
+	GoName string
+	Values []*bindEnumValue
+}
+
+type bindEnumValue struct {
+	GoName string
+	Value  int64
+}
+
+type bindStruct struct {
+	Name   string
+	GoName string
+	Size   uint32
+	Fields []*bindField
+}
+
+type bindField struct {
+	GoName string
+	GoType string
+	// Read and Write are the statements converting the field from and to b.
+	Read  string
+	Write string
+}
+
+// fieldTypes are the Go types of the fields by their type and size.
+var fieldTypes = map[Type]map[uint32]string{
+	TypeI32: {1: "int8", 2: "int16", 4: "int32"},
+	TypeU32: {1: "uint8", 2: "uint16", 4: "uint32"},
+	TypeI64: {8: "int64"},
+	TypeU64: {8: "uint64"},
+	TypeF32: {4: "float32"},
+	TypeF64: {8: "float64"},
+}
+
+func newBindTypes(structs []*Struct, enums []*Enum) (*bindTypes, error) {
+	ret := &bindTypes{methods: make(map[string]struct{})}
+	names := map[string]string{"Module": "Module", "New": "New"}
+	define := func(goName, name string) error {
+		if other, exists := names[goName]; exists {
+			return fmt.Errorf("both %s and %s are named %s in Go", other, name, goName)
+		}
+		names[goName] = name
+		return nil
+	}
+	for _, enum := range enums {
+		e := &bindEnum{GoName: goName(enum.Name)}
+		if err := define(e.GoName, enum.Name); err != nil {
+			return nil, err
+		}
+		for _, v := range enum.Values {
+			value := &bindEnumValue{GoName: goName(v.Name), Value: v.Value}
+			if err := define(value.GoName, v.Name); err != nil {
+				return nil, err
+			}
+			e.Values = append(e.Values, value)
+		}
+		ret.enums = append(ret.enums, e)
+	}
+	for _, st := range structs {
+		s, err := newBindStruct(st)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			// the struct has members not readable from Go.
+			continue
+		}
+		if err := define(s.GoName, st.Name); err != nil {
+			return nil, err
+		}
+		for _, prefix := range []string{"Read", "Put", "Write"} {
+			ret.methods[prefix+s.GoName] = struct{}{}
+		}
+		ret.structs = append(ret.structs, s)
+	}
+	return ret, nil
+}
+
+func newBindStruct(st *Struct) (*bindStruct, error) {
+	if len(st.Fields) == 0 {
+		return nil, nil
+	}
+	s := &bindStruct{Name: st.Name, GoName: goName(st.Name), Size: st.Size}
+	names := make(map[string]string)
+	for _, field := range st.Fields {
+		goType, exists := fieldTypes[field.Type][field.Size]
+		if !exists {
+			return nil, nil
+		}
+		if field.Offset+field.Size > st.Size {
+			return nil, fmt.Errorf("field %s of %s exceeds the size of the struct", field.Name, st.Name)
+		}
+		f := &bindField{GoName: goName(field.Name), GoType: goType}
+		if other, exists := names[f.GoName]; exists {
+			return nil, fmt.Errorf("both %s and %s of %s are named %s in Go", other, field.Name, st.Name, f.GoName)
+		}
+		names[f.GoName] = field.Name
+		f.Read, f.Write = fieldConversions(f.GoName, goType, field.Offset)
+		s.Fields = append(s.Fields, f)
+	}
+	return s, nil
+}
+
+// fieldConversions returns the statements reading the field from b and writing it to b in little endian.
+func fieldConversions(name, goType string, offset uint32) (string, string) {
+	switch goType {
+	case "int8", "uint8":
+		return fmt.Sprintf("v.%s = %s(b[%d])", name, goType, offset),
+			fmt.Sprintf("b[%d] = byte(v.%s)", offset, name)
+	case "float32":
+		return fmt.Sprintf("v.%s = math.Float32frombits(binary.LittleEndian.Uint32(b[%d:]))", name, offset),
+			fmt.Sprintf("binary.LittleEndian.PutUint32(b[%d:], math.Float32bits(v.%s))", offset, name)
+	case "float64":
+		return fmt.Sprintf("v.%s = math.Float64frombits(binary.LittleEndian.Uint64(b[%d:]))", name, offset),
+			fmt.Sprintf("binary.LittleEndian.PutUint64(b[%d:], math.Float64bits(v.%s))", offset, name)
+	}
+	bits := map[string]string{
+		"int16": "16", "uint16": "16",
+		"int32": "32", "uint32": "32",
+		"int64": "64", "uint64": "64",
+	}[goType]
+	return fmt.Sprintf("v.%s = %s(binary.LittleEndian.Uint%s(b[%d:]))", name, goType, bits, offset),
+		fmt.Sprintf("binary.LittleEndian.PutUint%s(b[%d:], uint%s(v.%s))", bits, offset, bits, name)
+}
+
+// usesMath reports whether a struct has floating point members.
+func (t *bindTypes) usesMath() bool {
+	for _, s := range t.structs {
+		for _, f := range s.Fields {
+			if f.GoType == "float32" || f.GoType == "float64" {
+				return true
+			}
+		}
+	}
+	return false
+}